@@ -83,6 +83,34 @@ def gen_bootstrap_conf(args):
             ["--http_request_timeout_s",
              str(args.http_request_timeout_s)])
 
+    if args.max_heap_size_bytes:
+        cmd.extend(["--max_heap_size_bytes", str(args.max_heap_size_bytes)])
+    if args.overload_shrink_heap_threshold is not None:
+        cmd.extend(["--overload_shrink_heap_threshold",
+                    str(args.overload_shrink_heap_threshold)])
+    if args.overload_disable_keepalive_threshold is not None:
+        cmd.extend(["--overload_disable_keepalive_threshold",
+                    str(args.overload_disable_keepalive_threshold)])
+    if args.overload_stop_accepting_requests_threshold is not None:
+        cmd.extend(["--overload_stop_accepting_requests_threshold",
+                    str(args.overload_stop_accepting_requests_threshold)])
+    if args.max_downstream_connections:
+        cmd.extend(["--max_downstream_connections",
+                    str(args.max_downstream_connections)])
+    if args.admin_address:
+        cmd.extend(["--admin_address", args.admin_address])
+    if args.statsd_address:
+        cmd.extend(["--statsd_address", args.statsd_address])
+    if args.dogstatsd_address:
+        cmd.extend(["--dogstatsd_address", args.dogstatsd_address])
+    if args.stats_port:
+        cmd.extend(["--stats_port", str(args.stats_port)])
+    # The stats are tagged with the service config ID only for a fixed
+    # rollout.
+    if args.service:
+        cmd.extend(["--service", args.service])
+    if args.version:
+        cmd.extend(["--service_config_id", args.version])
 
     bootstrap_file = DEFAULT_CONFIG_DIR + BOOTSTRAP_CONFIG
     cmd.append(bootstrap_file)
@@ -293,6 +321,437 @@ environment variable or by passing "-k" flag to this script.
         Only works when --cors_preset is in use. Enable the CORS header
         Access-Control-Allow-Credentials. By default, this header is disabled.
         ''')
+    parser.add_argument(
+        '--cors_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with CORS policies for individual operations or
+        APIs. They override the --cors_preset policy for the routes of the
+        selected methods, and the "espv2.cors_policy" options of the service
+        config.
+        ''')
+    parser.add_argument(
+        '--rate_limit_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with local token bucket rate limits for operations
+        or APIs, optionally keyed by API key, JWT subject or client IP.
+        It can also enforce the quota limits of the service config locally.
+        Requests over a limit get 429 with a Retry-After header.
+        ''')
+    parser.add_argument(
+        '--rate_limit_failure_mode_deny',
+        action='store_true',
+        help='''
+        Reject requests to operations with rate limits when the limits cannot
+        be checked. By default they are allowed.
+        ''')
+
+    parser.add_argument(
+        '--max_request_body_bytes',
+        default=None, type=int,
+        help='''
+        Maximum size of request bodies in bytes. Larger requests are rejected
+        with 413. By default request bodies are unlimited.
+        ''')
+    parser.add_argument(
+        '--request_body_limits_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with request body size limits for operations or
+        APIs, overriding --max_request_body_bytes.
+        ''')
+
+    parser.add_argument(
+        '--enable_response_compression',
+        action='store_true',
+        help='''
+        Enable gzip compression of responses to clients that accept it.
+        Streaming methods and responses that are already compressed are not
+        compressed.
+        ''')
+    parser.add_argument(
+        '--response_compression_min_content_length',
+        default=None, type=int,
+        help='''
+        Minimum response length in bytes to be compressed. Default is 30.
+        ''')
+    parser.add_argument(
+        '--response_compression_content_types',
+        default=None,
+        help='''
+        A list of content types (separated by comma) to be compressed. The
+        default includes application/json.
+        ''')
+    parser.add_argument(
+        '--response_compression_level',
+        default=None,
+        choices=['default', 'best', 'speed'],
+        help='''
+        Gzip compression level. Default is "default".
+        ''')
+
+    parser.add_argument(
+        '--header_rules_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with rules to add, set and remove request headers
+        sent to the backend and response headers sent to the client, globally
+        or for operations or APIs. Headers to remove must be exact names.
+        ''')
+
+    parser.add_argument(
+        '--api_version_routing_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with a backend address for each API version.
+        Requests to the methods of an API are routed to the backend of its
+        version, optionally only when a request header selects that version.
+        ''')
+
+    parser.add_argument(
+        '--canary_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with a canary backend and the percentage of
+        requests sent to it, globally or for operations or APIs. The file is
+        watched, so weights can be changed without a service config rollout.
+        ''')
+
+    parser.add_argument(
+        '--mirror_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with backends that get a copy of a percentage of
+        the requests, globally or for operations or APIs. Their responses are
+        discarded.
+        ''')
+
+    parser.add_argument(
+        '--fault_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with delays and aborts injected into a percentage
+        of the requests to operations or APIs. Meant for resilience testing,
+        not for production.
+        ''')
+
+    parser.add_argument(
+        '--ext_authz_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with a gRPC or HTTP external authorization service
+        that must approve requests after JWT authentication, its timeout,
+        whether requests are allowed when it fails, the headers sent to it and
+        the operations or APIs it does not check.
+        ''')
+
+    parser.add_argument(
+        '--jwt_claims_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with claims the verified JWT must have for
+        operations or APIs. Requests without them are rejected with 403.
+        ''')
+
+    parser.add_argument(
+        '--jwks_files',
+        default=None,
+        help='''
+        A list of provider_id=path (separated by comma) of local JWKS files
+        used instead of the jwks_uri of the authentication providers. The
+        files are watched, so keys can be rotated without a service config
+        rollout.
+        ''')
+
+    parser.add_argument(
+        '--jwt_headers_config_path',
+        default=None,
+        help='''
+        Path to a JSON file mapping claims of the verified JWT to request
+        headers sent to the backend, and setting the header and the encoding
+        (base64url or base64) of the forwarded JWT payload of each
+        authentication provider.
+        ''')
+
+    parser.add_argument(
+        '--jwt_cookies',
+        default=None,
+        help='''
+        A list of provider_id=cookie_name (separated by comma) of cookies the
+        JWTs of the authentication providers are also read from, besides
+        their JWT locations in the service config.
+        ''')
+    parser.add_argument(
+        '--api_key_cookies',
+        default=None,
+        help='''
+        A list of cookie names (separated by comma) the API keys of all the
+        methods are also read from, after their API key locations in the
+        service config or the default ones.
+        ''')
+
+    parser.add_argument(
+        '--access_log',
+        default=None,
+        help='''
+        Path of the access log of the requests, such as /dev/stdout. The
+        access log is off by default.
+        ''')
+    parser.add_argument(
+        '--access_log_format',
+        default=None,
+        choices=['json', 'text'],
+        help='''
+        Format of the access log, "json" for one JSON object per request or
+        "text" for one line of key=value pairs per request. Default is json.
+        ''')
+
+    parser.add_argument(
+        '--ssl_server_root_certs_path',
+        default=None,
+        help='''
+        Path to the root certificates used to validate the client
+        certificates of HTTPS requests. Requires --ssl_server_cert_path or
+        --ssl_port.
+        ''')
+    parser.add_argument(
+        '--ssl_server_require_client_cert',
+        action='store_true',
+        help='''
+        Reject the HTTPS connections without a valid client certificate.
+        Requires --ssl_server_root_certs_path, and --http_to_https_redirect
+        with --ssl_port.
+        ''')
+    parser.add_argument(
+        '--ssl_server_client_sans',
+        default=None,
+        help='''
+        The subject alt names allowed in the client certificates, separated
+        by comma. Requires --ssl_server_root_certs_path, and
+        --http_to_https_redirect with --ssl_port.
+        ''')
+
+    parser.add_argument(
+        '--ssl_server_certs_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with more certificates of the HTTPS listener,
+        each with the server names it is served to with SNI. The certificate
+        in --ssl_server_cert_path is served to the other clients.
+        ''')
+
+    parser.add_argument(
+        '--enable_sds',
+        action='store_true',
+        help='''
+        Serve the certificates, the keys and the root certificates of the
+        listeners and the clusters to Envoy as SDS secrets. The files are
+        watched, so certificates are rotated without restarts.
+        ''')
+
+    parser.add_argument(
+        '--ssl_server_cipher_suites',
+        default=None,
+        help='''
+        Cipher suites of TLS 1.0-1.2 allowed for downstream connections in
+        order of preference, separated by comma. Suites of equal preference
+        can be grouped as [SUITE1|SUITE2].
+        ''')
+    parser.add_argument(
+        '--ssl_server_ecdh_curves',
+        default=None,
+        help='''
+        ECDH curves allowed for downstream connections, separated by comma,
+        among X25519, P-256, P-384 and P-521.
+        ''')
+    parser.add_argument(
+        '--ssl_server_session_timeout',
+        default=None,
+        help='''
+        Lifetime of the TLS sessions of downstream connections, such as 1h.
+        Default is 2 hours.
+        ''')
+    parser.add_argument(
+        '--ssl_server_disable_session_tickets',
+        action='store_true',
+        help='''
+        Do not issue TLS session tickets to downstream clients.
+        ''')
+    parser.add_argument(
+        '--ssl_client_cipher_suites',
+        default=None,
+        help='''
+        Cipher suites allowed for upstream connections, in the format of
+        --ssl_server_cipher_suites.
+        ''')
+    parser.add_argument(
+        '--ssl_client_ecdh_curves',
+        default=None,
+        help='''
+        ECDH curves allowed for upstream connections, in the format of
+        --ssl_server_ecdh_curves.
+        ''')
+    parser.add_argument(
+        '--ssl_client_disable_session_resumption',
+        action='store_true',
+        help='''
+        Do not resume TLS sessions of upstream connections.
+        ''')
+
+    parser.add_argument(
+        '--backend_tls_config_path',
+        default=None,
+        help='''
+        Path to a JSON file with TLS settings of individual backends, keyed
+        by backend address, such as their root certificates, client
+        certificate and SNI.
+        ''')
+
+    parser.add_argument(
+        '--http_idle_timeout',
+        default=None,
+        help='''
+        Downstream connections without active requests for this long
+        are closed, such as 30m. Default is 1 hour.
+        ''')
+    parser.add_argument(
+        '--stream_idle_timeout',
+        default=None,
+        help='''
+        Requests without activity in either direction for this long
+        are reset. Default is 5 minutes.
+        ''')
+    parser.add_argument(
+        '--streaming_method_idle_timeout',
+        default=None,
+        help='''
+        Idle timeout of the requests to streaming methods, replacing
+        --stream_idle_timeout for them.
+        ''')
+    parser.add_argument(
+        '--request_timeout',
+        default=None,
+        help='''
+        Time to receive the whole request. By default, it is
+        unlimited.
+        ''')
+    parser.add_argument(
+        '--max_connection_duration',
+        default=None,
+        help='''
+        Downstream connections are drained after being open this long.
+        By default, it is unlimited.
+        ''')
+    parser.add_argument(
+        '--http2_max_concurrent_streams',
+        default=None,
+        type=int,
+        help='''
+        Maximum concurrent streams of a downstream HTTP/2 connection.
+        ''')
+    parser.add_argument(
+        '--http2_initial_stream_window_size',
+        default=None,
+        type=int,
+        help='''
+        Initial flow-control window of the streams of downstream
+        HTTP/2 connections in bytes.
+        ''')
+    parser.add_argument(
+        '--http2_initial_connection_window_size',
+        default=None,
+        type=int,
+        help='''
+        Initial flow-control window of downstream HTTP/2 connections
+        in bytes.
+        ''')
+
+    parser.add_argument(
+        '--max_heap_size_bytes',
+        default=None,
+        type=int,
+        help='''
+        Enables the overload manager of Envoy, which monitors the heap usage
+        against this size and sheds load as it grows.
+        ''')
+    parser.add_argument(
+        '--overload_shrink_heap_threshold',
+        default=None,
+        type=float,
+        help='''
+        Ratio of the max heap size at which Envoy releases free memory to the
+        system. 0 turns it off. Default is 0.95.
+        ''')
+    parser.add_argument(
+        '--overload_disable_keepalive_threshold',
+        default=None,
+        type=float,
+        help='''
+        Ratio of the max heap size at which Envoy stops keeping downstream
+        HTTP connections alive. 0 turns it off, which is the default.
+        ''')
+    parser.add_argument(
+        '--overload_stop_accepting_requests_threshold',
+        default=None,
+        type=float,
+        help='''
+        Ratio of the max heap size at which Envoy rejects new requests with
+        503. 0 turns it off. Default is 0.98.
+        ''')
+    parser.add_argument(
+        '--max_downstream_connections',
+        default=None,
+        type=int,
+        help='''
+        Global limit of the downstream connections of all the listeners.
+        By default, it is unlimited.
+        ''')
+
+    parser.add_argument(
+        '--enable_proxy_protocol',
+        action='store_true',
+        help='''
+        Read the client address from the PROXY protocol header that a TCP
+        load balancer sends at the start of each connection. Connections
+        without the header are rejected. Set --envoy_use_remote_address too,
+        so that the address is appended to x-forwarded-for.
+        --envoy_xff_num_trusted_hops is 0 unless set.
+        ''')
+
+    parser.add_argument(
+        '--admin_address',
+        default=None,
+        help='''
+        Address the Envoy admin interface is served on. Default is 0.0.0.0.
+        Set it to a loopback address, such as 127.0.0.1, to serve only the
+        stats on --stats_port to other hosts.
+        ''')
+    parser.add_argument(
+        '--statsd_address',
+        default=None,
+        help='''
+        UDP address of a statsd server, as ip:port, the stats of Envoy are
+        flushed to.
+        ''')
+    parser.add_argument(
+        '--dogstatsd_address',
+        default=None,
+        help='''
+        UDP address of a DogStatsD server, as ip:port, the stats of Envoy are
+        flushed to with their tags.
+        ''')
+    parser.add_argument(
+        '--stats_port',
+        default=None,
+        type=int,
+        help='''
+        Serve the stats of Envoy in Prometheus format at /stats/prometheus on
+        this port, without the rest of the admin interface. Requires
+        --status_port. The stats are fetched from the admin interface at
+        --admin_address, or at the loopback address if it is a wildcard one.
+        ''')
+
     parser.add_argument(
         '--check_metadata',
         action='store_true',
@@ -314,7 +773,8 @@ environment variable or by passing "-k" flag to this script.
         '--envoy_xff_num_trusted_hops',
         default=None,
         help='''Envoy HttpConnectionManager configuration, please refer to envoy
-        documentation for detailed information. The default value is 2.''')
+        documentation for detailed information. The default value is 2, or 0
+        with --enable_proxy_protocol.''')
 
     parser.add_argument(
         '--log_request_headers',
@@ -579,11 +1039,15 @@ environment variable or by passing "-k" flag to this script.
         Please use the flag --listener_port.''')
 
     parser.add_argument('--ssl_port', default=None, type=int, help='''
-        This flag added for backward compatible for ESPv1 and will be deprecated.
-        Please use the flag --ssl_server_cert_path instead. When configured, ESPv2
-        accepts HTTP/1.x and HTTP/2 secure connections on this port,
-        Requires the certificate and key files /etc/nginx/ssl/nginx.crt and
-        /etc/nginx/ssl/nginx.key''')
+        Port of an HTTPS listener, besides the plaintext listener on
+        listener_port. It uses the certificate in --ssl_server_cert_path,
+        or the certificate and key files in /etc/nginx/ssl as in ESPv1 if
+        --ssl_server_cert_path is not set.''')
+
+    parser.add_argument('--http_to_https_redirect', action='store_true',
+        help='''
+        Redirect the requests to the plaintext listener to the HTTPS listener
+        on --ssl_port, except health checks.''')
 
     parser.add_argument('-t', '--tls_mutual_auth', action='store_true', help='''
         This flag added for backward compatible for ESPv1 and will be deprecated.
@@ -646,8 +1110,8 @@ def enforce_conflict_args(args):
             # for non gcp case, disable tracing if tracing project id is not provided.
             args.disable_tracing = True
 
-    if args.ssl_port and args.ssl_server_cert_path:
-        return "Flag --ssl_port is going to be deprecated, please use --ssl_server_cert_path only."
+    if args.http_to_https_redirect and not args.ssl_port:
+        return "Flag --http_to_https_redirect requires --ssl_port."
     if args.tls_mutual_auth and args.ssl_client_cert_path:
         return "Flag --tls_mutual_auth is going to be deprecated, please use --ssl_client_cert_path only."
     if args.ssl_client_root_certs_file and args.enable_grpc_backend_ssl:
@@ -723,8 +1187,11 @@ def gen_proxy_config(args):
     if args.ssl_server_cert_path:
         proxy_conf.extend(["--ssl_server_cert_path", str(args.ssl_server_cert_path)])
     if args.ssl_port:
-        proxy_conf.extend(["--ssl_server_cert_path", "/etc/nginx/ssl"])
-        proxy_conf.extend(["--listener_port", str(args.ssl_port)])
+        if not args.ssl_server_cert_path:
+            proxy_conf.extend(["--ssl_server_cert_path", "/etc/nginx/ssl"])
+        proxy_conf.extend(["--ssl_port", str(args.ssl_port)])
+    if args.http_to_https_redirect:
+        proxy_conf.append("--http_to_https_redirect")
     if args.ssl_client_cert_path:
         proxy_conf.extend(["--ssl_client_cert_path", str(args.ssl_client_cert_path)])
     if args.enable_grpc_backend_ssl and args.grpc_backend_ssl_root_certs_file:
@@ -863,6 +1330,118 @@ def gen_proxy_config(args):
         if args.cors_allow_credentials:
             proxy_conf.append("--cors_allow_credentials")
 
+    if args.cors_config_path:
+        proxy_conf.extend(["--cors_config_path", args.cors_config_path])
+
+    if args.rate_limit_config_path:
+        proxy_conf.extend(["--rate_limit_config_path", args.rate_limit_config_path])
+    if args.rate_limit_failure_mode_deny:
+        proxy_conf.append("--rate_limit_failure_mode_deny")
+
+    if args.max_request_body_bytes:
+        proxy_conf.extend(["--max_request_body_bytes", str(args.max_request_body_bytes)])
+    if args.request_body_limits_config_path:
+        proxy_conf.extend(["--request_body_limits_config_path", args.request_body_limits_config_path])
+
+    if args.enable_response_compression:
+        proxy_conf.append("--enable_response_compression")
+    if args.response_compression_min_content_length is not None:
+        proxy_conf.extend(["--response_compression_min_content_length",
+                           str(args.response_compression_min_content_length)])
+    if args.response_compression_content_types:
+        proxy_conf.extend(["--response_compression_content_types",
+                           args.response_compression_content_types])
+    if args.response_compression_level:
+        proxy_conf.extend(["--response_compression_level", args.response_compression_level])
+
+    if args.header_rules_config_path:
+        proxy_conf.extend(["--header_rules_config_path", args.header_rules_config_path])
+
+    if args.api_version_routing_config_path:
+        proxy_conf.extend(["--api_version_routing_config_path", args.api_version_routing_config_path])
+
+    if args.canary_config_path:
+        proxy_conf.extend(["--canary_config_path", args.canary_config_path])
+
+    if args.mirror_config_path:
+        proxy_conf.extend(["--mirror_config_path", args.mirror_config_path])
+
+    if args.fault_config_path:
+        proxy_conf.extend(["--fault_config_path", args.fault_config_path])
+
+    if args.ext_authz_config_path:
+        proxy_conf.extend(["--ext_authz_config_path", args.ext_authz_config_path])
+
+    if args.jwt_claims_config_path:
+        proxy_conf.extend(["--jwt_claims_config_path", args.jwt_claims_config_path])
+
+    if args.jwks_files:
+        proxy_conf.extend(["--jwks_files", args.jwks_files])
+
+    if args.jwt_headers_config_path:
+        proxy_conf.extend(["--jwt_headers_config_path", args.jwt_headers_config_path])
+
+    if args.jwt_cookies:
+        proxy_conf.extend(["--jwt_cookies", args.jwt_cookies])
+    if args.api_key_cookies:
+        proxy_conf.extend(["--api_key_cookies", args.api_key_cookies])
+
+    if args.access_log:
+        proxy_conf.extend(["--access_log", args.access_log])
+    if args.access_log_format:
+        proxy_conf.extend(["--access_log_format", args.access_log_format])
+
+    if args.ssl_server_root_certs_path:
+        proxy_conf.extend(["--ssl_server_root_certs_path", args.ssl_server_root_certs_path])
+    if args.ssl_server_require_client_cert:
+        proxy_conf.append("--ssl_server_require_client_cert")
+    if args.ssl_server_client_sans:
+        proxy_conf.extend(["--ssl_server_client_sans", args.ssl_server_client_sans])
+
+    if args.ssl_server_certs_config_path:
+        proxy_conf.extend(["--ssl_server_certs_config_path", args.ssl_server_certs_config_path])
+
+    if args.enable_sds:
+        proxy_conf.append("--enable_sds")
+
+    if args.ssl_server_cipher_suites:
+        proxy_conf.extend(["--ssl_server_cipher_suites", args.ssl_server_cipher_suites])
+    if args.ssl_server_ecdh_curves:
+        proxy_conf.extend(["--ssl_server_ecdh_curves", args.ssl_server_ecdh_curves])
+    if args.ssl_server_session_timeout:
+        proxy_conf.extend(["--ssl_server_session_timeout", args.ssl_server_session_timeout])
+    if args.ssl_server_disable_session_tickets:
+        proxy_conf.append("--ssl_server_disable_session_tickets")
+    if args.ssl_client_cipher_suites:
+        proxy_conf.extend(["--ssl_client_cipher_suites", args.ssl_client_cipher_suites])
+    if args.ssl_client_ecdh_curves:
+        proxy_conf.extend(["--ssl_client_ecdh_curves", args.ssl_client_ecdh_curves])
+    if args.ssl_client_disable_session_resumption:
+        proxy_conf.append("--ssl_client_disable_session_resumption")
+
+    if args.backend_tls_config_path:
+        proxy_conf.extend(["--backend_tls_config_path", args.backend_tls_config_path])
+
+    if args.http_idle_timeout:
+        proxy_conf.extend(["--http_idle_timeout", args.http_idle_timeout])
+    if args.stream_idle_timeout:
+        proxy_conf.extend(["--stream_idle_timeout", args.stream_idle_timeout])
+    if args.streaming_method_idle_timeout:
+        proxy_conf.extend(["--streaming_method_idle_timeout", args.streaming_method_idle_timeout])
+    if args.request_timeout:
+        proxy_conf.extend(["--request_timeout", args.request_timeout])
+    if args.max_connection_duration:
+        proxy_conf.extend(["--max_connection_duration", args.max_connection_duration])
+    if args.http2_max_concurrent_streams:
+        proxy_conf.extend(["--http2_max_concurrent_streams", str(args.http2_max_concurrent_streams)])
+    if args.http2_initial_stream_window_size:
+        proxy_conf.extend(["--http2_initial_stream_window_size", str(args.http2_initial_stream_window_size)])
+    if args.http2_initial_connection_window_size:
+        proxy_conf.extend(["--http2_initial_connection_window_size", str(args.http2_initial_connection_window_size)])
+
+    if args.enable_proxy_protocol:
+        proxy_conf.append("--enable_proxy_protocol")
+
     # Set credentials file from the environment variable
     if args.service_account_key is None and GOOGLE_CREDS_KEY in os.environ:
         args.service_account_key = os.environ[GOOGLE_CREDS_KEY]
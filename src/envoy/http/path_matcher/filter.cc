@@ -17,6 +17,7 @@
 #include "src/envoy/http/path_matcher/filter.h"
 
 #include "common/http/utility.h"
+#include "common/protobuf/protobuf.h"
 #include "src/api_proxy/path_matcher/variable_binding_utils.h"
 #include "src/envoy/utils/filter_state_utils.h"
 #include "src/envoy/utils/http_header_utils.h"
@@ -70,6 +71,12 @@ Envoy::Http::FilterHeadersStatus Filter::decodeHeaders(
       *decoder_callbacks_->streamInfo().filterState();
   utils::setStringFilterState(filter_state, utils::kOperation, *operation);
 
+  ProtobufWkt::Struct metadata;
+  (*metadata.mutable_fields())[kOperationMetadataKey].set_string_value(
+      *operation);
+  decoder_callbacks_->streamInfo().setDynamicMetadata(kPathMatcherFilterName,
+                                                      metadata);
+
   if (config_->needParameterExtraction(*operation)) {
     std::vector<VariableBinding> variable_bindings;
     operation = config_->findOperation(method, path, &variable_bindings);
@@ -24,6 +24,12 @@ namespace envoy {
 namespace http_filters {
 namespace path_matcher {
 
+constexpr char kPathMatcherFilterName[] = "envoy.filters.http.path_matcher";
+
+// Key of the operation in the dynamic metadata of the filter, which the
+// filters that cannot read the filter state use, such as Lua filters.
+constexpr char kOperationMetadataKey[] = "operation";
+
 class Filter : public Envoy::Http::PassThroughDecoderFilter,
                public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
  public:
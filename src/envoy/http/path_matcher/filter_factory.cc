@@ -25,8 +25,6 @@ namespace envoy {
 namespace http_filters {
 namespace path_matcher {
 
-constexpr char kPathMatcherFilterName[] = "envoy.filters.http.path_matcher";
-
 /**
  * Config registration for ESPv2 path matcher filter.
  */
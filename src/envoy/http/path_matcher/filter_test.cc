@@ -81,6 +81,13 @@ TEST_F(PathMatcherFilterTest, DecodeHeadersWithOperation) {
   EXPECT_EQ(utils::getStringFilterState(*mock_cb_.stream_info_.filter_state_,
                                         utils::kOperation),
             "1.cloudesf_testing_cloud_goog.Bar");
+  EXPECT_EQ(mock_cb_.stream_info_.dynamicMetadata()
+                .filter_metadata()
+                .at(kPathMatcherFilterName)
+                .fields()
+                .at(kOperationMetadataKey)
+                .string_value(),
+            "1.cloudesf_testing_cloud_goog.Bar");
   EXPECT_EQ(utils::getStringFilterState(*mock_cb_.stream_info_.filter_state_,
                                         utils::kQueryParams),
             Envoy::EMPTY_STRING);
@@ -161,6 +168,9 @@ TEST_F(PathMatcherFilterTest, DecodeHeadersNoMatch) {
   EXPECT_EQ(utils::getStringFilterState(*mock_cb_.stream_info_.filter_state_,
                                         utils::kOperation),
             Envoy::EMPTY_STRING);
+  EXPECT_EQ(mock_cb_.stream_info_.dynamicMetadata().filter_metadata().count(
+                kPathMatcherFilterName),
+            0U);
 
   EXPECT_EQ(0L, Envoy::TestUtility::findCounter(mock_factory_context_.scope_,
                                                 "path_matcher.allowed")
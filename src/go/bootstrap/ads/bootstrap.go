@@ -93,6 +93,25 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 			return "", fmt.Errorf("failed to create tracing config, error: %v", err)
 		}
 	}
+	if bt.OverloadManager, err = bootstrap.CreateOverloadManager(opts.CommonOptions); err != nil {
+		return "", fmt.Errorf("failed to create overload manager config, error: %v", err)
+	}
+	if bt.LayeredRuntime, err = bootstrap.CreateLayeredRuntime(opts.CommonOptions); err != nil {
+		return "", fmt.Errorf("failed to create runtime config, error: %v", err)
+	}
+
+	if bt.StatsSinks, err = bootstrap.CreateStatsSinks(opts.CommonOptions); err != nil {
+		return "", fmt.Errorf("failed to create stats sinks, error: %v", err)
+	}
+	bt.StatsConfig = bootstrap.CreateStatsConfig(opts.ServiceName, opts.ServiceConfigId)
+	statsListener, adminCluster, err := bootstrap.CreateStatsListener(opts.CommonOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create stats listener, error: %v", err)
+	}
+	if statsListener != nil {
+		bt.StaticResources.Listeners = append(bt.StaticResources.Listeners, statsListener)
+		bt.StaticResources.Clusters = append(bt.StaticResources.Clusters, adminCluster)
+	}
 
 	jsonStr, err := util.ProtoToJson(bt)
 	if err != nil {
@@ -183,6 +183,123 @@ func TestCreateBootstrapConfig(t *testing.T) {
             }
           }
         }
+      }`,
+		},
+		{
+			desc: "bootstrap with overload manager and connection limit",
+			args: map[string]string{
+				"disable_tracing":            "true",
+				"admin_port":                 "0",
+				"node":                       "test-node",
+				"max_heap_size_bytes":        "1073741824",
+				"max_downstream_connections": "10000",
+			},
+			wantConfig: `{
+			  "node": {
+          "id": "test-node",
+          "cluster": "test-node_cluster"
+        },
+        "staticResources": {
+          "clusters": [
+            {
+              "name": "ads_cluster",
+              "type": "STRICT_DNS",
+              "connectTimeout": "10s",
+              "loadAssignment": {
+                "clusterName": "127.0.0.1",
+                "endpoints": [
+                  {
+                    "lbEndpoints": [
+                      {
+                        "endpoint": {
+                          "address": {
+                            "socketAddress": {
+                              "address": "127.0.0.1",
+                              "portValue": 8790
+                            }
+                          }
+                        }
+                      }
+                    ]
+                  }
+                ]
+              },
+              "http2ProtocolOptions": {
+              }
+            }
+          ]
+        },
+        "dynamicResources": {
+          "ldsConfig": {
+            "ads": {
+            }
+          },
+          "cdsConfig": {
+            "ads": {
+            }
+          },
+          "adsConfig": {
+            "apiType": "GRPC",
+            "grpcServices": [
+              {
+                "envoyGrpc": {
+                  "clusterName": "ads_cluster"
+                }
+              }
+            ]
+          }
+        },
+        "admin": {},
+        "overloadManager": {
+          "refreshInterval": "0.250s",
+          "resourceMonitors": [
+            {
+              "name": "envoy.resource_monitors.fixed_heap",
+              "typedConfig": {
+                "@type": "type.googleapis.com/envoy.config.resource_monitor.fixed_heap.v2alpha.FixedHeapConfig",
+                "maxHeapSizeBytes": "1073741824"
+              }
+            }
+          ],
+          "actions": [
+            {
+              "name": "envoy.overload_actions.shrink_heap",
+              "triggers": [
+                {
+                  "name": "envoy.resource_monitors.fixed_heap",
+                  "threshold": {
+                    "value": 0.95
+                  }
+                }
+              ]
+            },
+            {
+              "name": "envoy.overload_actions.stop_accepting_requests",
+              "triggers": [
+                {
+                  "name": "envoy.resource_monitors.fixed_heap",
+                  "threshold": {
+                    "value": 0.98
+                  }
+                }
+              ]
+            }
+          ]
+        },
+        "layeredRuntime": {
+          "layers": [
+            {
+              "name": "static_layer",
+              "staticLayer": {
+                "overload.global_downstream_max_connections": 10000
+              }
+            },
+            {
+              "name": "admin_layer",
+              "adminLayer": {}
+            }
+          ]
+        }
       }`,
 		},
 	}
@@ -26,6 +26,8 @@ import (
 
 var (
 	AdsConnectTimeout = flag.Duration("ads_connect_timeout", 10*time.Second, "ads connect timeout in seconds")
+	ServiceName       = flag.String("service", "", "Name of the Endpoints service the stats are tagged with")
+	ServiceConfigId   = flag.String("service_config_id", "", "Service config ID the stats are tagged with, only for a fixed rollout")
 )
 
 func DefaultBootstrapperOptionsFromFlags() options.AdsBootstrapperOptions {
@@ -34,6 +36,8 @@ func DefaultBootstrapperOptionsFromFlags() options.AdsBootstrapperOptions {
 		CommonOptions:     common_option,
 		AdsConnectTimeout: *AdsConnectTimeout,
 		DiscoveryAddress:  fmt.Sprintf("127.0.0.1:%d", common_option.DiscoveryPort),
+		ServiceName:       *ServiceName,
+		ServiceConfigId:   *ServiceConfigId,
 	}
 
 	glog.Infof("ADS Bootstrapper options: %+v", opts)
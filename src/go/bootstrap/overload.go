@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/ptypes"
+
+	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+	overloadpb "github.com/envoyproxy/go-control-plane/envoy/config/overload/v2alpha"
+	fixedheappb "github.com/envoyproxy/go-control-plane/envoy/config/resource_monitor/fixed_heap/v2alpha"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+)
+
+const (
+	fixedHeapResourceMonitor = "envoy.resource_monitors.fixed_heap"
+	overloadRefreshInterval  = 250 * time.Millisecond
+
+	globalDownstreamMaxConnectionsKey = "overload.global_downstream_max_connections"
+)
+
+// CreateOverloadManager outputs the overload manager for bootstrap config,
+// which monitors the heap usage against the max heap size and takes the
+// actions whose thresholds are reached. It is nil without a max heap size.
+func CreateOverloadManager(opts options.CommonOptions) (*overloadpb.OverloadManager, error) {
+	actions := []struct {
+		name      string
+		threshold float64
+	}{
+		{"envoy.overload_actions.shrink_heap", opts.OverloadShrinkHeapThreshold},
+		{"envoy.overload_actions.disable_http_keepalive", opts.OverloadDisableKeepaliveThreshold},
+		{"envoy.overload_actions.stop_accepting_requests", opts.OverloadStopAcceptingRequestsThreshold},
+	}
+	for _, action := range actions {
+		if action.threshold < 0 || action.threshold > 1 {
+			return nil, fmt.Errorf("threshold %v of overload action %s must be between 0 and 1", action.threshold, action.name)
+		}
+	}
+	if opts.MaxHeapSizeBytes == 0 {
+		return nil, nil
+	}
+
+	fixedHeap, err := ptypes.MarshalAny(&fixedheappb.FixedHeapConfig{
+		MaxHeapSizeBytes: opts.MaxHeapSizeBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	overloadManager := &overloadpb.OverloadManager{
+		RefreshInterval: ptypes.DurationProto(overloadRefreshInterval),
+		ResourceMonitors: []*overloadpb.ResourceMonitor{
+			{
+				Name: fixedHeapResourceMonitor,
+				ConfigType: &overloadpb.ResourceMonitor_TypedConfig{
+					TypedConfig: fixedHeap,
+				},
+			},
+		},
+	}
+	// Actions with a 0 threshold are off.
+	for _, action := range actions {
+		if action.threshold == 0 {
+			continue
+		}
+		overloadManager.Actions = append(overloadManager.Actions, &overloadpb.OverloadAction{
+			Name: action.name,
+			Triggers: []*overloadpb.Trigger{
+				{
+					Name: fixedHeapResourceMonitor,
+					TriggerOneof: &overloadpb.Trigger_Threshold{
+						Threshold: &overloadpb.ThresholdTrigger{
+							Value: action.threshold,
+						},
+					},
+				},
+			},
+		})
+	}
+	return overloadManager, nil
+}
+
+// CreateLayeredRuntime outputs the runtime for bootstrap config with the
+// global limit of downstream connections, which Envoy only reads from the
+// runtime. The admin layer keeps the runtime modifiable through the admin
+// interface. It is nil without a limit.
+func CreateLayeredRuntime(opts options.CommonOptions) (*bootstrappb.LayeredRuntime, error) {
+	if opts.MaxDownstreamConnections < 0 {
+		return nil, fmt.Errorf("max downstream connections %d cannot be negative", opts.MaxDownstreamConnections)
+	}
+	if opts.MaxDownstreamConnections == 0 {
+		return nil, nil
+	}
+
+	return &bootstrappb.LayeredRuntime{
+		Layers: []*bootstrappb.RuntimeLayer{
+			{
+				Name: "static_layer",
+				LayerSpecifier: &bootstrappb.RuntimeLayer_StaticLayer{
+					StaticLayer: &structpb.Struct{
+						Fields: map[string]*structpb.Value{
+							globalDownstreamMaxConnectionsKey: {
+								Kind: &structpb.Value_NumberValue{
+									NumberValue: float64(opts.MaxDownstreamConnections),
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name: "admin_layer",
+				LayerSpecifier: &bootstrappb.RuntimeLayer_AdminLayer_{
+					AdminLayer: &bootstrappb.RuntimeLayer_AdminLayer{},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+func TestCreateOverloadManager(t *testing.T) {
+	testData := []struct {
+		desc                           string
+		maxHeapSizeBytes               uint64
+		shrinkHeapThreshold            float64
+		disableKeepaliveThreshold      float64
+		stopAcceptingRequestsThreshold float64
+		wantOverloadManager            string
+		wantError                      string
+	}{
+		{
+			desc:                           "Overload manager is disabled without a max heap size",
+			shrinkHeapThreshold:            0.95,
+			stopAcceptingRequestsThreshold: 0.98,
+		},
+		{
+			desc:                           "Overload manager with the default actions",
+			maxHeapSizeBytes:               1073741824,
+			shrinkHeapThreshold:            0.95,
+			stopAcceptingRequestsThreshold: 0.98,
+			wantOverloadManager: `{
+				"refreshInterval": "0.250s",
+				"resourceMonitors": [
+					{
+						"name": "envoy.resource_monitors.fixed_heap",
+						"typedConfig": {
+							"@type": "type.googleapis.com/envoy.config.resource_monitor.fixed_heap.v2alpha.FixedHeapConfig",
+							"maxHeapSizeBytes": "1073741824"
+						}
+					}
+				],
+				"actions": [
+					{
+						"name": "envoy.overload_actions.shrink_heap",
+						"triggers": [
+							{
+								"name": "envoy.resource_monitors.fixed_heap",
+								"threshold": {
+									"value": 0.95
+								}
+							}
+						]
+					},
+					{
+						"name": "envoy.overload_actions.stop_accepting_requests",
+						"triggers": [
+							{
+								"name": "envoy.resource_monitors.fixed_heap",
+								"threshold": {
+									"value": 0.98
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+		{
+			desc:                      "Overload manager only disabling keepalive",
+			maxHeapSizeBytes:          536870912,
+			disableKeepaliveThreshold: 0.9,
+			wantOverloadManager: `{
+				"refreshInterval": "0.250s",
+				"resourceMonitors": [
+					{
+						"name": "envoy.resource_monitors.fixed_heap",
+						"typedConfig": {
+							"@type": "type.googleapis.com/envoy.config.resource_monitor.fixed_heap.v2alpha.FixedHeapConfig",
+							"maxHeapSizeBytes": "536870912"
+						}
+					}
+				],
+				"actions": [
+					{
+						"name": "envoy.overload_actions.disable_http_keepalive",
+						"triggers": [
+							{
+								"name": "envoy.resource_monitors.fixed_heap",
+								"threshold": {
+									"value": 0.9
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+		{
+			desc:                           "Fail with a threshold over 1",
+			maxHeapSizeBytes:               1073741824,
+			stopAcceptingRequestsThreshold: 98,
+			wantError:                      "threshold 98 of overload action envoy.overload_actions.stop_accepting_requests must be between 0 and 1",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.MaxHeapSizeBytes = tc.maxHeapSizeBytes
+		opts.OverloadShrinkHeapThreshold = tc.shrinkHeapThreshold
+		opts.OverloadDisableKeepaliveThreshold = tc.disableKeepaliveThreshold
+		opts.OverloadStopAcceptingRequestsThreshold = tc.stopAcceptingRequestsThreshold
+
+		got, err := CreateOverloadManager(opts)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test (%s): failed, got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantOverloadManager == "" {
+			if got != nil {
+				t.Errorf("Test (%s): failed, got overload manager: %v, want nil", tc.desc, got)
+			}
+			continue
+		}
+
+		gotJson, err := util.ProtoToJson(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantOverloadManager, gotJson); err != nil {
+			t.Errorf("Test (%s): failed, \n %v", tc.desc, err)
+		}
+	}
+}
+
+func TestCreateLayeredRuntime(t *testing.T) {
+	testData := []struct {
+		desc                     string
+		maxDownstreamConnections int
+		wantLayeredRuntime       string
+		wantError                string
+	}{
+		{
+			desc: "Runtime is not set without a connection limit",
+		},
+		{
+			desc:                     "Runtime with the connection limit",
+			maxDownstreamConnections: 10000,
+			wantLayeredRuntime: `{
+				"layers": [
+					{
+						"name": "static_layer",
+						"staticLayer": {
+							"overload.global_downstream_max_connections": 10000
+						}
+					},
+					{
+						"name": "admin_layer",
+						"adminLayer": {}
+					}
+				]
+			}`,
+		},
+		{
+			desc:                     "Fail with a negative connection limit",
+			maxDownstreamConnections: -1,
+			wantError:                "max downstream connections -1 cannot be negative",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.MaxDownstreamConnections = tc.maxDownstreamConnections
+
+		got, err := CreateLayeredRuntime(opts)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test (%s): failed, got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantLayeredRuntime == "" {
+			if got != nil {
+				t.Errorf("Test (%s): failed, got runtime: %v, want nil", tc.desc, got)
+			}
+			continue
+		}
+
+		gotJson, err := util.ProtoToJson(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantLayeredRuntime, gotJson); err != nil {
+			t.Errorf("Test (%s): failed, \n %v", tc.desc, err)
+		}
+	}
+}
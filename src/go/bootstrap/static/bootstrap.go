@@ -30,6 +30,13 @@ import (
 // id is the service configuration ID. It is generated when deploying
 // service config to ServiceManagement Server, example: 2017-02-13r0.
 func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts options.ConfigGeneratorOptions) (*bootstrappb.Bootstrap, error) {
+	if opts.EnableSds {
+		return nil, fmt.Errorf("SDS secrets are served by the config manager, which cannot be used with a static bootstrap config")
+	}
+	if opts.RateLimitConfigPath != "" {
+		return nil, fmt.Errorf("rate limits are served by the config manager, which cannot be used with a static bootstrap config")
+	}
+
 	bt := &bootstrappb.Bootstrap{
 		Node:  bootstrap.CreateNode(opts.CommonOptions),
 		Admin: bootstrap.CreateAdmin(opts.CommonOptions),
@@ -54,6 +61,25 @@ func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts opt
 			return nil, fmt.Errorf("failed to create tracing config, error: %v", err)
 		}
 	}
+	if bt.OverloadManager, err = bootstrap.CreateOverloadManager(opts.CommonOptions); err != nil {
+		return nil, fmt.Errorf("failed to create overload manager config, error: %v", err)
+	}
+	if bt.LayeredRuntime, err = bootstrap.CreateLayeredRuntime(opts.CommonOptions); err != nil {
+		return nil, fmt.Errorf("failed to create runtime config, error: %v", err)
+	}
+
+	if bt.StatsSinks, err = bootstrap.CreateStatsSinks(opts.CommonOptions); err != nil {
+		return nil, fmt.Errorf("failed to create stats sinks, error: %v", err)
+	}
+	bt.StatsConfig = bootstrap.CreateStatsConfig(serviceInfo.Name, serviceInfo.ConfigID)
+	statsListener, adminCluster, err := bootstrap.CreateStatsListener(opts.CommonOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stats listener, error: %v", err)
+	}
+	if statsListener != nil {
+		listeners = append(listeners, statsListener)
+		clusters = append(clusters, adminCluster)
+	}
 
 	bt.StaticResources = &bootstrappb.Bootstrap_StaticResources{
 		Listeners: listeners,
@@ -153,6 +153,38 @@ func TestServiceToBootstrapConfig(t *testing.T) {
 	}
 }
 
+func TestServiceToBootstrapConfigWithConfigManagerOptions(t *testing.T) {
+	testData := []struct {
+		desc      string
+		optMod    func(opts *options.ConfigGeneratorOptions)
+		wantError string
+	}{
+		{
+			desc: "Fail with SDS",
+			optMod: func(opts *options.ConfigGeneratorOptions) {
+				opts.EnableSds = true
+			},
+			wantError: "SDS secrets are served by the config manager, which cannot be used with a static bootstrap config",
+		},
+		{
+			desc: "Fail with rate limits",
+			optMod: func(opts *options.ConfigGeneratorOptions) {
+				opts.RateLimitConfigPath = "rate_limits.json"
+			},
+			wantError: "rate limits are served by the config manager, which cannot be used with a static bootstrap config",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		tc.optMod(&opts)
+		_, err := ServiceToBootstrapConfig(&confpb.Service{}, FakeConfigID, opts)
+		if err == nil || err.Error() != tc.wantError {
+			t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantError)
+		}
+	}
+}
+
 func bootstrapToJson(protoMsg *bootstrappb.Bootstrap) (string, error) {
 	// Marshal both protos back to json-strings to pretty print them
 	marshaler := &jsonpb.Marshaler{
@@ -0,0 +1,262 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	routerpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v2"
+)
+
+const (
+	statsdSinkName    = "envoy.stat_sinks.statsd"
+	dogStatsdSinkName = "envoy.stat_sinks.dog_statsd"
+
+	statsListenerName   = "stats_listener"
+	statsStatPrefix     = "stats_http"
+	adminClusterName    = "admin_cluster"
+	prometheusStatsPath = "/stats/prometheus"
+
+	// Tags of all the stats, named like the attributes of the service in
+	// Stackdriver.
+	serviceNameTag     = "service_name"
+	serviceConfigIdTag = "service_config_id"
+)
+
+// CreateStatsSinks outputs the statsd and DogStatsD sinks for bootstrap
+// config, which Envoy flushes the stats to over UDP.
+func CreateStatsSinks(opts options.CommonOptions) ([]*metricspb.StatsSink, error) {
+	var sinks []*metricspb.StatsSink
+	if opts.StatsdAddress != "" {
+		address, err := makeUdpAddress(opts.StatsdAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statsd address: %v", err)
+		}
+		sink, err := makeStatsSink(statsdSinkName, &metricspb.StatsdSink{
+			StatsdSpecifier: &metricspb.StatsdSink_Address{
+				Address: address,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if opts.DogStatsdAddress != "" {
+		address, err := makeUdpAddress(opts.DogStatsdAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DogStatsD address: %v", err)
+		}
+		sink, err := makeStatsSink(dogStatsdSinkName, &metricspb.DogStatsdSink{
+			DogStatsdSpecifier: &metricspb.DogStatsdSink_Address{
+				Address: address,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func makeStatsSink(name string, config proto.Message) (*metricspb.StatsSink, error) {
+	typedConfig, err := ptypes.MarshalAny(config)
+	if err != nil {
+		return nil, err
+	}
+	return &metricspb.StatsSink{
+		Name: name,
+		ConfigType: &metricspb.StatsSink_TypedConfig{
+			TypedConfig: typedConfig,
+		},
+	}, nil
+}
+
+// makeUdpAddress parses an address as ip:port, since Envoy does not resolve
+// the hostnames of UDP addresses.
+func makeUdpAddress(address string) (*corepb.Address, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("%s must be an IP address and a port", address)
+	}
+	portValue, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %s: %v", address, err)
+	}
+	return &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Protocol: corepb.SocketAddress_UDP,
+				Address:  host,
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: uint32(portValue),
+				},
+			},
+		},
+	}, nil
+}
+
+// CreateStatsConfig outputs the stats config for bootstrap config, which tags
+// all the stats with the service name and the service config ID that are not
+// empty. It is nil if both are empty.
+func CreateStatsConfig(serviceName, configID string) *metricspb.StatsConfig {
+	var tags []*metricspb.TagSpecifier
+	if serviceName != "" {
+		tags = append(tags, &metricspb.TagSpecifier{
+			TagName: serviceNameTag,
+			TagValue: &metricspb.TagSpecifier_FixedValue{
+				FixedValue: serviceName,
+			},
+		})
+	}
+	if configID != "" {
+		tags = append(tags, &metricspb.TagSpecifier{
+			TagName: serviceConfigIdTag,
+			TagValue: &metricspb.TagSpecifier_FixedValue{
+				FixedValue: configID,
+			},
+		})
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return &metricspb.StatsConfig{
+		StatsTags: tags,
+	}
+}
+
+// CreateStatsListener outputs the listener serving the stats in Prometheus
+// format on the stats port, and the cluster of the admin interface it gets
+// them from, at the admin address or at the loopback address if it is a
+// wildcard one. Only the Prometheus stats of the admin interface are served,
+// so the admin address can be a loopback one to keep the rest private. Both
+// are nil without a stats port.
+func CreateStatsListener(opts options.CommonOptions) (*v2pb.Listener, *v2pb.Cluster, error) {
+	if opts.StatsPort == 0 {
+		return nil, nil, nil
+	}
+	if opts.AdminPort == 0 {
+		return nil, nil, fmt.Errorf("stats port %d requires the admin port", opts.StatsPort)
+	}
+	if opts.StatsPort == opts.AdminPort {
+		return nil, nil, fmt.Errorf("stats port %d must be different from the admin port", opts.StatsPort)
+	}
+
+	router, err := ptypes.MarshalAny(&routerpb.Router{})
+	if err != nil {
+		return nil, nil, err
+	}
+	httpConMgr, err := ptypes.MarshalAny(&hcmpb.HttpConnectionManager{
+		CodecType:  hcmpb.HttpConnectionManager_AUTO,
+		StatPrefix: statsStatPrefix,
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{
+			RouteConfig: &v2pb.RouteConfiguration{
+				Name: "stats_route",
+				VirtualHosts: []*routepb.VirtualHost{
+					{
+						Name:    "stats",
+						Domains: []string{"*"},
+						Routes: []*routepb.Route{
+							{
+								Match: &routepb.RouteMatch{
+									PathSpecifier: &routepb.RouteMatch_Path{
+										Path: prometheusStatsPath,
+									},
+								},
+								Action: &routepb.Route_Route{
+									Route: &routepb.RouteAction{
+										ClusterSpecifier: &routepb.RouteAction_Cluster{
+											Cluster: adminClusterName,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		HttpFilters: []*hcmpb.HttpFilter{
+			{
+				Name:       util.Router,
+				ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: router},
+			},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener := &v2pb.Listener{
+		Name: statsListenerName,
+		Address: &corepb.Address{
+			Address: &corepb.Address_SocketAddress{
+				SocketAddress: &corepb.SocketAddress{
+					Address: "0.0.0.0",
+					PortSpecifier: &corepb.SocketAddress_PortValue{
+						PortValue: uint32(opts.StatsPort),
+					},
+				},
+			},
+		},
+		FilterChains: []*listenerpb.FilterChain{
+			{
+				Filters: []*listenerpb.Filter{
+					{
+						Name:       util.HTTPConnectionManager,
+						ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: httpConMgr},
+					},
+				},
+			},
+		},
+	}
+	cluster := &v2pb.Cluster{
+		Name:                 adminClusterName,
+		ConnectTimeout:       ptypes.DurationProto(time.Second),
+		ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_STATIC},
+		LoadAssignment:       util.CreateLoadAssignment(adminLoopbackAddress(opts.AdminAddress), uint32(opts.AdminPort)),
+	}
+	return listener, cluster, nil
+}
+
+// adminLoopbackAddress returns the address the admin interface is reached on
+// from the same host.
+func adminLoopbackAddress(adminAddress string) string {
+	switch adminAddress {
+	case "0.0.0.0":
+		return "127.0.0.1"
+	case "::":
+		return "::1"
+	}
+	return adminAddress
+}
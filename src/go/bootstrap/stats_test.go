@@ -0,0 +1,318 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+)
+
+func TestCreateStatsSinks(t *testing.T) {
+	testData := []struct {
+		desc             string
+		statsdAddress    string
+		dogStatsdAddress string
+		wantStatsSinks   string
+		wantError        string
+	}{
+		{
+			desc:           "No stats sinks by default",
+			wantStatsSinks: `{}`,
+		},
+		{
+			desc:             "Both statsd and DogStatsD sinks",
+			statsdAddress:    "127.0.0.1:8125",
+			dogStatsdAddress: "[::1]:8126",
+			wantStatsSinks: `{
+				"statsSinks": [
+					{
+						"name": "envoy.stat_sinks.statsd",
+						"typedConfig": {
+							"@type": "type.googleapis.com/envoy.config.metrics.v2.StatsdSink",
+							"address": {
+								"socketAddress": {
+									"protocol": "UDP",
+									"address": "127.0.0.1",
+									"portValue": 8125
+								}
+							}
+						}
+					},
+					{
+						"name": "envoy.stat_sinks.dog_statsd",
+						"typedConfig": {
+							"@type": "type.googleapis.com/envoy.config.metrics.v2.DogStatsdSink",
+							"address": {
+								"socketAddress": {
+									"protocol": "UDP",
+									"address": "::1",
+									"portValue": 8126
+								}
+							}
+						}
+					}
+				]
+			}`,
+		},
+		{
+			desc:          "Fail with a hostname as statsd address",
+			statsdAddress: "statsd.example.com:8125",
+			wantError:     "invalid statsd address: statsd.example.com:8125 must be an IP address and a port",
+		},
+		{
+			desc:             "Fail with a DogStatsD address without port",
+			dogStatsdAddress: "127.0.0.1",
+			wantError:        "invalid DogStatsD address: address 127.0.0.1: missing port in address",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsdAddress = tc.statsdAddress
+		opts.DogStatsdAddress = tc.dogStatsdAddress
+
+		got, err := CreateStatsSinks(opts)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test (%s): failed, got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotJson, err := util.ProtoToJson(&bootstrappb.Bootstrap{StatsSinks: got})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantStatsSinks, gotJson); err != nil {
+			t.Errorf("Test (%s): failed, \n %v", tc.desc, err)
+		}
+	}
+}
+
+func TestCreateStatsConfig(t *testing.T) {
+	testData := []struct {
+		desc            string
+		serviceName     string
+		configID        string
+		wantStatsConfig string
+	}{
+		{
+			desc: "Stats config is not set without service name and config ID",
+		},
+		{
+			desc:        "Stats config with the service name and config ID tags",
+			serviceName: "bookstore.endpoints.project123.cloud.goog",
+			configID:    "2019-12-16r0",
+			wantStatsConfig: `{
+				"statsTags": [
+					{
+						"tagName": "service_name",
+						"fixedValue": "bookstore.endpoints.project123.cloud.goog"
+					},
+					{
+						"tagName": "service_config_id",
+						"fixedValue": "2019-12-16r0"
+					}
+				]
+			}`,
+		},
+		{
+			desc:        "Stats config with only the service name tag",
+			serviceName: "bookstore.endpoints.project123.cloud.goog",
+			wantStatsConfig: `{
+				"statsTags": [
+					{
+						"tagName": "service_name",
+						"fixedValue": "bookstore.endpoints.project123.cloud.goog"
+					}
+				]
+			}`,
+		},
+	}
+
+	for _, tc := range testData {
+		got := CreateStatsConfig(tc.serviceName, tc.configID)
+		if tc.wantStatsConfig == "" {
+			if got != nil {
+				t.Errorf("Test (%s): failed, got stats config: %v, want nil", tc.desc, got)
+			}
+			continue
+		}
+
+		gotJson, err := util.ProtoToJson(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantStatsConfig, gotJson); err != nil {
+			t.Errorf("Test (%s): failed, \n %v", tc.desc, err)
+		}
+	}
+}
+
+func TestCreateStatsListener(t *testing.T) {
+	testData := []struct {
+		desc         string
+		statsPort    int
+		adminAddress string
+		adminPort    int
+		wantListener string
+		wantCluster  string
+		wantError    string
+	}{
+		{
+			desc:         "Stats listener is not set without a stats port",
+			adminAddress: "0.0.0.0",
+			adminPort:    8001,
+		},
+		{
+			desc:         "Stats listener getting the stats from the admin interface",
+			statsPort:    9901,
+			adminAddress: "0.0.0.0",
+			adminPort:    8001,
+			wantListener: `{
+				"name": "stats_listener",
+				"address": {
+					"socketAddress": {
+						"address": "0.0.0.0",
+						"portValue": 9901
+					}
+				},
+				"filterChains": [
+					{
+						"filters": [
+							{
+								"name": "envoy.filters.network.http_connection_manager",
+								"typedConfig": {
+									"@type": "type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager",
+									"statPrefix": "stats_http",
+									"routeConfig": {
+										"name": "stats_route",
+										"virtualHosts": [
+											{
+												"name": "stats",
+												"domains": ["*"],
+												"routes": [
+													{
+														"match": {
+															"path": "/stats/prometheus"
+														},
+														"route": {
+															"cluster": "admin_cluster"
+														}
+													}
+												]
+											}
+										]
+									},
+									"httpFilters": [
+										{
+											"name": "envoy.filters.http.router",
+											"typedConfig": {
+												"@type": "type.googleapis.com/envoy.config.filter.http.router.v2.Router"
+											}
+										}
+									]
+								}
+							}
+						]
+					}
+				]
+			}`,
+			wantCluster: `{
+				"name": "admin_cluster",
+				"type": "STATIC",
+				"connectTimeout": "1s",
+				"loadAssignment": {
+					"clusterName": "127.0.0.1",
+					"endpoints": [
+						{
+							"lbEndpoints": [
+								{
+									"endpoint": {
+										"address": {
+											"socketAddress": {
+												"address": "127.0.0.1",
+												"portValue": 8001
+											}
+										}
+									}
+								}
+							]
+						}
+					]
+				}
+			}`,
+		},
+		{
+			desc:         "Fail without the admin port",
+			statsPort:    9901,
+			adminAddress: "0.0.0.0",
+			wantError:    "stats port 9901 requires the admin port",
+		},
+		{
+			desc:         "Fail with the admin port as stats port",
+			statsPort:    8001,
+			adminAddress: "0.0.0.0",
+			adminPort:    8001,
+			wantError:    "stats port 8001 must be different from the admin port",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsPort = tc.statsPort
+		opts.AdminAddress = tc.adminAddress
+		opts.AdminPort = tc.adminPort
+
+		gotListener, gotCluster, err := CreateStatsListener(opts)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test (%s): failed, got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantListener == "" {
+			if gotListener != nil || gotCluster != nil {
+				t.Errorf("Test (%s): failed, got listener: %v, cluster: %v, want nil", tc.desc, gotListener, gotCluster)
+			}
+			continue
+		}
+
+		gotListenerJson, err := util.ProtoToJson(gotListener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantListener, gotListenerJson); err != nil {
+			t.Errorf("Test (%s): failed, listener: \n %v", tc.desc, err)
+		}
+		gotClusterJson, err := util.ProtoToJson(gotCluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantCluster, gotClusterJson); err != nil {
+			t.Errorf("Test (%s): failed, cluster: \n %v", tc.desc, err)
+		}
+	}
+}
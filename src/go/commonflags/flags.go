@@ -59,6 +59,25 @@ var (
 
 	BackendAuthIamServiceAccount = flag.String("backend_auth_iam_service_account", "", "The service account used to fetch identity token for the Backend Auth from Google Cloud IAM")
 	BackendAuthIamDelegates      = flag.String("backend_auth_iam_delegates", "", "The sequence of service accounts in a delegation chain used to fetch identity token for the Backend Auth from Google Cloud IAM. The multiple delegates should be separated by \",\" and the flag only applies when BackendAuthIamServiceAccount is not empty.")
+
+	MaxHeapSizeBytes = flag.Uint64("max_heap_size_bytes", 0, `Enables the overload manager of Envoy, which monitors the heap usage against this size
+	and sheds load as it grows, instead of running out of memory.`)
+	OverloadShrinkHeapThreshold = flag.Float64("overload_shrink_heap_threshold", 0.95, `Ratio of the max heap size at which Envoy releases free memory to
+	the system. 0 turns it off.`)
+	OverloadDisableKeepaliveThreshold = flag.Float64("overload_disable_keepalive_threshold", 0, `Ratio of the max heap size at which Envoy stops keeping
+	downstream HTTP connections alive. 0 turns it off.`)
+	OverloadStopAcceptingRequestsThreshold = flag.Float64("overload_stop_accepting_requests_threshold", 0.98, `Ratio of the max heap size at which Envoy
+	rejects new requests with 503. 0 turns it off.`)
+	MaxDownstreamConnections = flag.Int("max_downstream_connections", 0, `Global limit of the downstream connections of all the listeners. Connections over
+	it are closed. By default, it is unlimited.`)
+
+	StatsdAddress    = flag.String("statsd_address", "", `UDP address of a statsd server, as ip:port, the stats of Envoy are flushed to.`)
+	DogStatsdAddress = flag.String("dogstatsd_address", "", `UDP address of a DogStatsD server, as ip:port, the stats of Envoy are flushed to with
+	their tags.`)
+	StatsPort = flag.Int("stats_port", 0, `Serves the stats of Envoy in Prometheus format at /stats/prometheus on this port if it is not 0, without
+	the rest of the admin interface. Requires --admin_port, which the stats are fetched from at --admin_address, or at the loopback
+	address if it is a wildcard one. Set --admin_address to a loopback address, such as 127.0.0.1, to keep the rest of the admin
+	interface private.`)
 )
 
 func DefaultCommonOptionsFromFlags() options.CommonOptions {
@@ -81,6 +100,16 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 		TracingMaxNumLinks:         *TracingMaxNumLinks,
 		MetadataURL:                *MetadataURL,
 		IamURL:                     *IamURL,
+
+		MaxHeapSizeBytes:                       *MaxHeapSizeBytes,
+		OverloadShrinkHeapThreshold:            *OverloadShrinkHeapThreshold,
+		OverloadDisableKeepaliveThreshold:      *OverloadDisableKeepaliveThreshold,
+		OverloadStopAcceptingRequestsThreshold: *OverloadStopAcceptingRequestsThreshold,
+		MaxDownstreamConnections:               *MaxDownstreamConnections,
+
+		StatsdAddress:    *StatsdAddress,
+		DogStatsdAddress: *DogStatsdAddress,
+		StatsPort:        *StatsPort,
 	}
 	if *BackendAuthIamServiceAccount != "" {
 		opts.BackendAuthCredentials = &options.IAMCredentialsOptions{
@@ -75,6 +75,43 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
 		clusters = append(clusters, brClusters...)
 	}
 
+	avClusters, err := makeApiVersionClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if avClusters != nil {
+		clusters = append(clusters, avClusters...)
+	}
+
+	canaryClusters, err := makeCanaryClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if canaryClusters != nil {
+		clusters = append(clusters, canaryClusters...)
+	}
+
+	mirrorClusters, err := makeMirrorClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if mirrorClusters != nil {
+		clusters = append(clusters, mirrorClusters...)
+	}
+
+	extAuthzCluster, err := makeExtAuthzCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if extAuthzCluster != nil {
+		clusters = append(clusters, extAuthzCluster)
+	}
+
+	rlCluster := makeRateLimitCluster(serviceInfo)
+	if rlCluster != nil {
+		clusters = append(clusters, rlCluster)
+	}
+
 	providerClusters, err := makeJwtProviderClusters(serviceInfo)
 	if err != nil {
 		return nil, err
@@ -103,7 +140,7 @@ func makeMetadataCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
 	}
 
 	if scheme == "https" {
-		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil)
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil, makeUpstreamTlsParams(serviceInfo.Options))
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 				c.Name, err)
@@ -136,7 +173,7 @@ func makeIamCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
 	}
 
 	if scheme == "https" {
-		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil)
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil, makeUpstreamTlsParams(serviceInfo.Options))
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 				c.Name, err)
@@ -153,6 +190,10 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, erro
 	generatedClusters := map[string]bool{}
 
 	for _, provider := range authn.GetProviders() {
+		if _, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			// Local JWKS are inlined into the JWT Authn filter config.
+			continue
+		}
 		jwksUri := provider.GetJwksUri()
 		clusterName, err := util.ExtraAddressFromURI(jwksUri)
 		if err != nil {
@@ -181,7 +222,7 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, erro
 			LoadAssignment:       util.CreateLoadAssignment(hostname, port),
 		}
 		if scheme == "https" {
-			transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil)
+			transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil, makeUpstreamTlsParams(serviceInfo.Options))
 			if err != nil {
 				return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 					c.Name, err)
@@ -212,7 +253,13 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 		if isHttp2 {
 			alpnProtocols = []string{"h2"}
 		}
-		transportSocket, err := util.CreateUpstreamTransportSocket(brc.Hostname, opt.RootCertsPath, opt.SslClientCertPath, alpnProtocols)
+		var transportSocket *corepb.TransportSocket
+		var err error
+		if brc.Tls != nil {
+			transportSocket, err = makeBackendTlsTransportSocket(opt, brc, alpnProtocols)
+		} else {
+			transportSocket, err = util.CreateUpstreamTransportSocket(brc.Hostname, opt.RootCertsPath, opt.SslClientCertPath, alpnProtocols, makeUpstreamTlsParams(*opt))
+		}
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 				brc.ClusterName, err)
@@ -237,6 +284,28 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 	return c, nil
 }
 
+// makeBackendTlsTransportSocket creates the TransportSocket of a backend with
+// its own TLS settings, falling back to the global ones for the settings it
+// does not have.
+func makeBackendTlsTransportSocket(opt *options.ConfigGeneratorOptions, brc *sc.BackendRoutingCluster, alpnProtocols []string) (*corepb.TransportSocket, error) {
+	tls := brc.Tls
+	rootCertsPath := tls.RootCertsPath
+	if rootCertsPath == "" {
+		rootCertsPath = opt.RootCertsPath
+	}
+	sni := tls.Sni
+	if sni == "" {
+		sni = brc.Hostname
+	}
+	params := makeUpstreamTlsParams(*opt)
+	params.ServerSans = tls.SubjectAltNames
+
+	if tls.ClientCertPath == "" {
+		return util.CreateUpstreamTransportSocket(sni, rootCertsPath, opt.SslClientCertPath, alpnProtocols, params)
+	}
+	return util.CreateUpstreamTransportSocketWithCert(sni, rootCertsPath, tls.ClientCertPath, tls.ClientKeyPath, alpnProtocols, params)
+}
+
 func makeCatchAllBackendCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
 	c, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.CatchAllBackend)
 	if err != nil {
@@ -277,7 +346,7 @@ func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, erro
 	}
 
 	if scheme == "https" {
-		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil)
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.RootCertsPath, "", nil, makeUpstreamTlsParams(serviceInfo.Options))
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 				c.Name, err)
@@ -288,6 +357,36 @@ func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, erro
 	return c, nil
 }
 
+func makeExtAuthzCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
+	if serviceInfo.ExtAuthz == nil {
+		return nil, nil
+	}
+
+	c, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.ExtAuthz.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Add external authorization cluster configuration: %v", c)
+	return c, nil
+}
+
+// makeRateLimitCluster makes the cluster of the rate limit server, which is
+// served by the config manager on the discovery port.
+func makeRateLimitCluster(serviceInfo *sc.ServiceInfo) *v2pb.Cluster {
+	if !hasMethodRateLimits(serviceInfo) {
+		return nil
+	}
+
+	return &v2pb.Cluster{
+		Name:                 util.RateLimitClusterName,
+		LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+		ConnectTimeout:       ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_STATIC},
+		Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+		LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", uint32(serviceInfo.Options.DiscoveryPort)),
+	}
+}
+
 func makeBackendRoutingClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
 	var brClusters []*v2pb.Cluster
 
@@ -302,3 +401,60 @@ func makeBackendRoutingClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, e
 	}
 	return brClusters, nil
 }
+
+func makeApiVersionClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
+	var avClusters []*v2pb.Cluster
+
+	for _, v := range serviceInfo.ApiVersionClusters {
+		c, err := makeBackendCluster(&serviceInfo.Options, v)
+		if err != nil {
+			return nil, err
+		}
+
+		avClusters = append(avClusters, c)
+		glog.Infof("Add API version cluster configuration for %v: %v", v.ClusterName, c)
+	}
+	return avClusters, nil
+}
+
+func makeCanaryClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
+	var canaryClusters []*v2pb.Cluster
+
+	for _, v := range serviceInfo.CanaryClusters {
+		c, err := makeBackendCluster(&serviceInfo.Options, v)
+		if err != nil {
+			return nil, err
+		}
+
+		canaryClusters = append(canaryClusters, c)
+		glog.Infof("Add canary cluster configuration for %v: %v", v.ClusterName, c)
+	}
+	return canaryClusters, nil
+}
+
+func makeMirrorClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
+	var mirrorClusters []*v2pb.Cluster
+
+	for _, v := range serviceInfo.MirrorClusters {
+		c, err := makeBackendCluster(&serviceInfo.Options, v)
+		if err != nil {
+			return nil, err
+		}
+
+		mirrorClusters = append(mirrorClusters, c)
+		glog.Infof("Add mirror cluster configuration for %v: %v", v.ClusterName, c)
+	}
+	return mirrorClusters, nil
+}
+
+// makeUpstreamTlsParams makes the parameters of the TLS connections of the
+// clusters.
+func makeUpstreamTlsParams(opts options.ConfigGeneratorOptions) *util.UpstreamTlsParams {
+	return &util.UpstreamTlsParams{
+		TlsParams: util.TlsParams{
+			CipherSuites: splitList(opts.SslClientCipherSuites),
+			EcdhCurves:   splitList(opts.SslClientEcdhCurves),
+		},
+		DisableSessionResumption: opts.SslClientDisableSessionResumption,
+	}
+}
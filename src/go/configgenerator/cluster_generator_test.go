@@ -15,6 +15,7 @@
 package configgenerator
 
 import (
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -41,12 +42,12 @@ var (
 )
 
 func createTransportSocket(hostname string) *corepb.TransportSocket {
-	transportSocket, _ := util.CreateUpstreamTransportSocket(hostname, util.DefaultRootCAPaths, "", nil)
+	transportSocket, _ := util.CreateUpstreamTransportSocket(hostname, util.DefaultRootCAPaths, "", nil, nil)
 	return transportSocket
 }
 
 func createH2TransportSocket(hostname string) *corepb.TransportSocket {
-	transportSocket, _ := util.CreateUpstreamTransportSocket(hostname, util.DefaultRootCAPaths, "", []string{"h2"})
+	transportSocket, _ := util.CreateUpstreamTransportSocket(hostname, util.DefaultRootCAPaths, "", []string{"h2"}, nil)
 	return transportSocket
 }
 
@@ -579,6 +580,157 @@ func TestMakeBackendRoutingCluster(t *testing.T) {
 	}
 }
 
+func TestMakeApiVersionClusters(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name:    "endpoints.examples.bookstore.v1.Bookstore",
+				Version: "v1",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+			{
+				Name:    "endpoints.examples.bookstore.v2.Bookstore",
+				Version: "v2",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	apiVersionRoutingConfig := `{
+		"backends": [
+			{"version": "v1", "address": "http://bookstore-v1:8080"},
+			{"version": "v2", "address": "grpcs://bookstore-v2"}
+		]
+	}`
+	wantedClusters := []*v2pb.Cluster{
+		{
+			Name:                 "bookstore.endpoints.project123.cloud.goog_version_v1",
+			ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+			ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_LOGICAL_DNS},
+			LoadAssignment:       util.CreateLoadAssignment("bookstore-v1", 8080),
+		},
+		{
+			Name:                 "bookstore.endpoints.project123.cloud.goog_version_v2",
+			ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+			ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_LOGICAL_DNS},
+			LoadAssignment:       util.CreateLoadAssignment("bookstore-v2", 443),
+			TransportSocket:      createH2TransportSocket("bookstore-v2"),
+			Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+		},
+	}
+
+	path := writeTempConfigFile(t, apiVersionRoutingConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:80"
+	opts.ApiVersionRoutingConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := makeApiVersionClusters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(clusters, wantedClusters, cmp.Comparer(proto.Equal)) {
+		t.Errorf("makeApiVersionClusters got: %v, want: %v", clusters, wantedClusters)
+	}
+}
+
+func TestMakeBackendRoutingClustersWithTls(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Address:  "https://internal.example.com:8443/shelves",
+					Selector: testApiName + ".ListShelves",
+				},
+				{
+					Address:  "https://public.example.com",
+					Selector: testApiName + ".CreateShelf",
+				},
+			},
+		},
+	}
+	backendTlsConfig := `{
+		"backends": {
+			"internal.example.com:8443": {
+				"root_certs_path": "/etc/ssl/internal/ca.crt",
+				"client_cert_path": "/etc/ssl/internal/client.crt",
+				"client_key_path": "/etc/ssl/internal/client.key",
+				"subject_alt_names": ["spiffe://example.com/internal"],
+				"sni": "internal.svc"
+			}
+		}
+	}`
+	internalTransportSocket, err := util.CreateUpstreamTransportSocketWithCert("internal.svc", "/etc/ssl/internal/ca.crt",
+		"/etc/ssl/internal/client.crt", "/etc/ssl/internal/client.key", nil, &util.UpstreamTlsParams{
+			ServerSans: []string{"spiffe://example.com/internal"},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantedClusters := []*v2pb.Cluster{
+		{
+			Name:                 "internal.example.com:8443",
+			ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+			ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_LOGICAL_DNS},
+			LoadAssignment:       util.CreateLoadAssignment("internal.example.com", 8443),
+			TransportSocket:      internalTransportSocket,
+		},
+		{
+			Name:                 "public.example.com:443",
+			ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+			ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_LOGICAL_DNS},
+			LoadAssignment:       util.CreateLoadAssignment("public.example.com", 443),
+			TransportSocket:      createTransportSocket("public.example.com"),
+		},
+	}
+
+	path := writeTempConfigFile(t, backendTlsConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:80"
+	opts.BackendTlsConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := makeBackendRoutingClusters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(clusters, wantedClusters, cmp.Comparer(proto.Equal)) {
+		t.Errorf("makeBackendRoutingClusters got: %v, want: %v", clusters, wantedClusters)
+	}
+}
+
 func TestMakeJwtProviderClusters(t *testing.T) {
 	testData := []struct {
 		desc            string
@@ -654,6 +806,31 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "No cluster for Auth Provider with local JWKS",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer_1",
+					JwksUri: `data:application/json,{"keys":[]}`,
+				},
+			},
+			wantedClusters: []*v2pb.Cluster{
+				{
+					Name:                 "metadata.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{Type: v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("metadata.com", 443),
+					TransportSocket:      createTransportSocket("metadata.com"),
+				},
+			},
+		},
 	}
 	for i, tc := range testData {
 		fakeServiceConfig := &confpb.Service{
@@ -17,6 +17,7 @@ package configgenerator
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
@@ -34,37 +35,298 @@ import (
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	listenerpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	filelogpb "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
+	accesslogpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/accesslog/v2"
+	bufpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	compressorpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/compressor/v2"
+	eapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	faultpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/fault/v2"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/grpc_stats/v2alpha"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
 	hcpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/health_check/v2"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	luapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	rlpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	ratelimitpb "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v2"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
 	anypb "github.com/golang/protobuf/ptypes/any"
 	durationpb "github.com/golang/protobuf/ptypes/duration"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
 )
 
 const (
-	statPrefix = "ingress_http"
+	statPrefix         = "ingress_http"
+	redirectStatPrefix = "ingress_http_redirect"
+
+	// Bounds of the HTTP/2 settings Envoy accepts.
+	maxHttp2Value      = 2147483647
+	minHttp2WindowSize = 65535
 )
 
-// MakeListeners provides dynamic listeners for Envoy
+// MakeListeners provides dynamic listeners for Envoy. With an SSL port, there
+// is an HTTPS listener on it besides the plaintext listener on the listener
+// port, which serves the same requests or redirects them to HTTPS.
 func MakeListeners(serviceInfo *sc.ServiceInfo) ([]*v2pb.Listener, error) {
-	listener, err := makeListener(serviceInfo)
+	opts := serviceInfo.Options
+	if opts.SslPort != 0 && opts.SslServerCertPath == "" {
+		return nil, fmt.Errorf("SSL port %d requires the SSL server cert path", opts.SslPort)
+	}
+	if opts.SslPort != 0 && opts.SslPort == opts.ListenerPort {
+		return nil, fmt.Errorf("SSL port %d must be different from the listener port", opts.SslPort)
+	}
+	if opts.HttpToHttpsRedirect && opts.SslPort == 0 {
+		return nil, fmt.Errorf("HTTP to HTTPS redirect requires the SSL port")
+	}
+	if opts.SslServerRootCertsPath != "" && opts.SslServerCertPath == "" {
+		return nil, fmt.Errorf("SSL server root certs path requires the SSL server cert path")
+	}
+	// The plaintext listener serves the same requests without client
+	// certificates, unless it redirects them to the HTTPS listener.
+	if (opts.SslServerRequireClientCert || opts.SslServerClientSans != "") && opts.SslPort != 0 && !opts.HttpToHttpsRedirect {
+		return nil, fmt.Errorf("client certificates required on the SSL port %d require HTTP to HTTPS redirect", opts.SslPort)
+	}
+
+	httpConMgr, err := makeHttpConnectionManager(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SslServerCertPath == "" {
+		listener, err := makeListener(serviceInfo, "http_listener", opts.ListenerPort, httpConMgr, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*v2pb.Listener{listener}, nil
+	}
+
+	transportSockets, err := makeServerTransportSockets(serviceInfo)
 	if err != nil {
 		return nil, err
 	}
-	return []*v2pb.Listener{listener}, nil
+	if opts.SslPort == 0 {
+		listener, err := makeListener(serviceInfo, "https_listener", opts.ListenerPort, httpConMgr, transportSockets)
+		if err != nil {
+			return nil, err
+		}
+		return []*v2pb.Listener{listener}, nil
+	}
+
+	httpsListener, err := makeListener(serviceInfo, "https_listener", opts.SslPort, httpConMgr, transportSockets)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HttpToHttpsRedirect {
+		if httpConMgr, err = makeRedirectHttpConnectionManager(serviceInfo); err != nil {
+			return nil, err
+		}
+	}
+	httpListener, err := makeListener(serviceInfo, "http_listener", opts.ListenerPort, httpConMgr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []*v2pb.Listener{httpListener, httpsListener}, nil
+}
+
+// serverTransportSocket is a downstream transport socket of the HTTPS listener,
+// for the clients requesting one of the server names with SNI, or for all the
+// other clients without server names.
+type serverTransportSocket struct {
+	serverNames     []string
+	transportSocket *corepb.TransportSocket
+}
+
+// makeServerTransportSockets makes the transport sockets of the certificates
+// selected by SNI, followed by the default one of the SSL server cert path.
+func makeServerTransportSockets(serviceInfo *sc.ServiceInfo) ([]*serverTransportSocket, error) {
+	opts := serviceInfo.Options
+	params := &util.DownstreamTlsParams{
+		TlsParams: util.TlsParams{
+			MinimumProtocol: opts.SslMinimumProtocol,
+			MaximumProtocol: opts.SslMaximumProtocol,
+			CipherSuites:    splitList(opts.SslServerCipherSuites),
+			EcdhCurves:      splitList(opts.SslServerEcdhCurves),
+		},
+		ClientRootCertsPath:   opts.SslServerRootCertsPath,
+		RequireClientCert:     opts.SslServerRequireClientCert,
+		ClientSans:            splitList(opts.SslServerClientSans),
+		SessionTimeout:        opts.SslServerSessionTimeout,
+		DisableSessionTickets: opts.SslServerDisableSessionTickets,
+	}
+
+	var transportSockets []*serverTransportSocket
+	for _, cert := range serviceInfo.ServerCertificates {
+		transportSocket, err := util.CreateDownstreamTransportSocketWithCert(cert.CertPath, cert.KeyPath, params)
+		if err != nil {
+			return nil, err
+		}
+		transportSockets = append(transportSockets, &serverTransportSocket{
+			serverNames:     cert.ServerNames,
+			transportSocket: transportSocket,
+		})
+	}
+
+	transportSocket, err := util.CreateDownstreamTransportSocket(opts.SslServerCertPath, params)
+	if err != nil {
+		return nil, err
+	}
+	return append(transportSockets, &serverTransportSocket{
+		transportSocket: transportSocket,
+	}), nil
+}
+
+// makeListener provides a dynamic listener for Envoy, serving the requests with
+// the HTTP connection manager. It is a TLS listener with transport sockets,
+// which have a filter chain each.
+func makeListener(serviceInfo *sc.ServiceInfo, name string, port int, httpConMgr *hcmpb.HttpConnectionManager, transportSockets []*serverTransportSocket) (*v2pb.Listener, error) {
+	// HTTP filter configuration
+	httpFilterConfig, err := ptypes.MarshalAny(httpConMgr)
+	if err != nil {
+		return nil, err
+	}
+	filters := []*listenerpb.Filter{
+		{
+			Name:       util.HTTPConnectionManager,
+			ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: httpFilterConfig},
+		},
+	}
+
+	var filterChains []*listenerpb.FilterChain
+	var listenerFilters []*listenerpb.ListenerFilter
+	// PROXY protocol filter replaces the addresses of the connections with
+	// the ones in the PROXY protocol header, before any other filter reads
+	// them.
+	if serviceInfo.Options.EnableProxyProtocol {
+		listenerFilters = append(listenerFilters, &listenerpb.ListenerFilter{
+			Name: util.ProxyProtocol,
+		})
+	}
+	needTlsInspector := false
+	for _, transportSocket := range transportSockets {
+		filterChain := &listenerpb.FilterChain{
+			Filters:         filters,
+			TransportSocket: transportSocket.transportSocket,
+		}
+		if len(transportSocket.serverNames) > 0 {
+			filterChain.FilterChainMatch = &listenerpb.FilterChainMatch{
+				ServerNames: transportSocket.serverNames,
+			}
+			needTlsInspector = true
+		}
+		filterChains = append(filterChains, filterChain)
+	}
+	// TLS Inspector filter reads SNI for the filter chains to match.
+	if needTlsInspector {
+		listenerFilters = append(listenerFilters, &listenerpb.ListenerFilter{
+			Name: util.TLSInspector,
+		})
+	}
+	if len(filterChains) == 0 {
+		filterChains = append(filterChains, &listenerpb.FilterChain{
+			Filters: filters,
+		})
+	}
+
+	return &v2pb.Listener{
+		Name: name,
+		Address: &corepb.Address{
+			Address: &corepb.Address_SocketAddress{
+				SocketAddress: &corepb.SocketAddress{
+					Address: serviceInfo.Options.ListenerAddress,
+					PortSpecifier: &corepb.SocketAddress_PortValue{
+						PortValue: uint32(port),
+					},
+				},
+			},
+		},
+		FilterChains:    filterChains,
+		ListenerFilters: listenerFilters,
+	}, nil
+}
+
+// splitList splits a flag of values separated by comma, ignoring empty ones.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// makeRedirectHttpConnectionManager makes the HTTP connection manager of the
+// plaintext listener redirecting requests to the HTTPS listener. Health checks
+// are still answered.
+func makeRedirectHttpConnectionManager(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpConnectionManager, error) {
+	httpFilters := []*hcmpb.HttpFilter{}
+	if serviceInfo.Options.Healthz != "" {
+		hcFilter, err := makeHealthCheckFilter(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		httpFilters = append(httpFilters, hcFilter)
+	}
+	httpFilters = append(httpFilters, makeRouterFilter(serviceInfo.Options))
+
+	httpConMgr := &hcmpb.HttpConnectionManager{
+		CodecType:  hcmpb.HttpConnectionManager_AUTO,
+		StatPrefix: redirectStatPrefix,
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{
+			RouteConfig: &v2pb.RouteConfiguration{
+				Name: "local_redirect_route",
+				VirtualHosts: []*routepb.VirtualHost{
+					{
+						Name:    "redirect",
+						Domains: []string{"*"},
+						Routes: []*routepb.Route{
+							{
+								Match: &routepb.RouteMatch{
+									PathSpecifier: &routepb.RouteMatch_Prefix{
+										Prefix: "/",
+									},
+								},
+								Action: &routepb.Route_Redirect{
+									Redirect: &routepb.RedirectAction{
+										SchemeRewriteSpecifier: &routepb.RedirectAction_HttpsRedirect{
+											HttpsRedirect: true,
+										},
+										PortRedirect: uint32(serviceInfo.Options.SslPort),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		HttpFilters: httpFilters,
+	}
+	if err := setConnectionLimits(httpConMgr, serviceInfo.Options); err != nil {
+		return nil, err
+	}
+	return httpConMgr, nil
 }
 
-// makeListener provides a dynamic listener for Envoy
-func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
+// makeHttpConnectionManager makes the HTTP connection manager with the HTTP
+// filters and the routes of the service.
+func makeHttpConnectionManager(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpConnectionManager, error) {
 	httpFilters := []*hcmpb.HttpFilter{}
 
-	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" {
+	// Add Lua filter recording the fields of the access log if needed. It is
+	// the first filter, so requests rejected by the other filters have them.
+	if serviceInfo.Options.AccessLogPath != "" {
+		accessLogFilter := makeAccessLogFilter(serviceInfo)
+		httpFilters = append(httpFilters, accessLogFilter)
+		jsonStr, _ := util.ProtoToJson(accessLogFilter)
+		glog.Infof("adding Access Log Filter config: %v", jsonStr)
+	}
+
+	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" || hasMethodCorsPolicy(serviceInfo) {
 		corsFilter := &hcmpb.HttpFilter{
 			Name: util.CORS,
 		}
@@ -73,6 +335,22 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		glog.Infof("adding CORS Filter config: %v", jsonStr)
 	}
 
+	// Add Gzip filter if needed. It is ahead of gRPC Transcoder filter, so it
+	// compresses the transcoded responses. It does not compress responses that
+	// already have a Content-Encoding. For streaming methods, it is wrapped by
+	// Lua filters hiding the Accept-Encoding header from it.
+	if serviceInfo.Options.EnableResponseCompression {
+		compressionFilters, err := makeResponseCompressionFilters(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		for _, filter := range compressionFilters {
+			httpFilters = append(httpFilters, filter)
+			jsonStr, _ := util.ProtoToJson(filter)
+			glog.Infof("adding Response Compression Filter config: %v", jsonStr)
+		}
+	}
+
 	// Add Path Matcher filter. The following filters rely on the dynamic
 	// metadata populated by Path Matcher filter.
 	// * Jwt Authentication filter
@@ -98,8 +376,16 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		glog.V(1).Infof("adding Healthz filter config: %v", jsonStr)
 	}
 
-	// Add JWT Authn filter if needed.
+	// Add JWT Authn filter if needed, behind the Lua filter copying the JWTs
+	// in cookies to headers.
 	if !serviceInfo.Options.SkipJwtAuthnFilter {
+		if len(serviceInfo.JwtCookies) > 0 {
+			jwtCookiesFilter := makeJwtCookiesFilter(serviceInfo)
+			httpFilters = append(httpFilters, jwtCookiesFilter)
+			jsonStr, _ := util.ProtoToJson(jwtCookiesFilter)
+			glog.Infof("adding JWT Cookies Filter config: %v", jsonStr)
+		}
+
 		jwtAuthnFilter := makeJwtAuthnFilter(serviceInfo)
 		if jwtAuthnFilter != nil {
 			httpFilters = append(httpFilters, jwtAuthnFilter)
@@ -108,6 +394,43 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		}
 	}
 
+	// Add Lua filter setting the JWT claim headers if needed. It is right
+	// behind JWT Authn filter, so the following filters see the headers.
+	if len(serviceInfo.JwtClaimHeaders) > 0 || hasBase64JwtPayloadHeaders(serviceInfo) {
+		jwtHeadersFilter := makeJwtHeadersFilter(serviceInfo)
+		httpFilters = append(httpFilters, jwtHeadersFilter)
+		jsonStr, _ := util.ProtoToJson(jwtHeadersFilter)
+		glog.Infof("adding JWT Headers Filter config: %v", jsonStr)
+	}
+
+	// Add Lua filter checking the JWT claims if needed. It is behind JWT Authn
+	// filter, since it checks the claims of the verified JWT payloads.
+	if hasMethodClaimRequirements(serviceInfo) {
+		jwtClaimsFilter := makeJwtClaimsFilter(serviceInfo)
+		httpFilters = append(httpFilters, jwtClaimsFilter)
+		jsonStr, _ := util.ProtoToJson(jwtClaimsFilter)
+		glog.Infof("adding JWT Claims Filter config: %v", jsonStr)
+	}
+
+	// Add External Authorization filter if needed. It is behind JWT Authn
+	// filter, so the authorization service gets the verified JWT payloads.
+	if serviceInfo.ExtAuthz != nil {
+		extAuthzFilter := makeExtAuthzFilter(serviceInfo)
+		httpFilters = append(httpFilters, extAuthzFilter)
+		jsonStr, _ := util.ProtoToJson(extAuthzFilter)
+		glog.Infof("adding External Authorization Filter config: %v", jsonStr)
+	}
+
+	// Add Rate Limit filter if needed. It is behind JWT Authn filter, since
+	// limits keyed by JWT subject read the forwarded JWT payload, and ahead of
+	// Service Control filter, so limited requests are rejected locally.
+	if hasMethodRateLimits(serviceInfo) {
+		rateLimitFilter := makeRateLimitFilter(serviceInfo)
+		httpFilters = append(httpFilters, rateLimitFilter)
+		jsonStr, _ := util.ProtoToJson(rateLimitFilter)
+		glog.Infof("adding Rate Limit Filter config: %v", jsonStr)
+	}
+
 	// Add Service Control filter if needed.
 	if !serviceInfo.Options.SkipServiceControlFilter {
 		serviceControlFilter := makeServiceControlFilter(serviceInfo)
@@ -118,6 +441,15 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		}
 	}
 
+	// Add Buffer filter to limit the request body size if needed. It is ahead
+	// of gRPC Transcoder filter, so the size of the original body is limited.
+	if hasRequestBodyLimits(serviceInfo) {
+		bufferFilter := makeBufferFilter(serviceInfo)
+		httpFilters = append(httpFilters, bufferFilter)
+		jsonStr, _ := util.ProtoToJson(bufferFilter)
+		glog.Infof("adding Buffer Filter config: %v", jsonStr)
+	}
+
 	// Add gRPC Transcoder filter and gRPCWeb filter configs for gRPC backend.
 	if serviceInfo.GrpcSupportRequired {
 		transcoderFilter := makeTranscoderFilter(serviceInfo)
@@ -157,6 +489,16 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		glog.Infof("adding Backend Routing Filter config: %v", jsonStr)
 	}
 
+	// Add Fault filter if needed. It is right ahead of Router filter, so the
+	// injected faults look like backend failures to all the other filters,
+	// e.g. they are reported to Service Control.
+	if hasMethodFaults(serviceInfo) {
+		faultFilter := makeFaultFilter()
+		httpFilters = append(httpFilters, faultFilter)
+		jsonStr, _ := util.ProtoToJson(faultFilter)
+		glog.Infof("adding Fault Filter config: %v", jsonStr)
+	}
+
 	// Add Envoy Router filter so requests are routed upstream.
 	// Router filter should be the last.
 	routerFilter := makeRouterFilter(serviceInfo.Options)
@@ -186,6 +528,23 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 	if !serviceInfo.Options.DisableTracing {
 		httpConMgr.Tracing = &hcmpb.HttpConnectionManager_Tracing{}
 	}
+	// Replace the client cert header sent by clients with the verified client
+	// certificate, if any.
+	if serviceInfo.Options.SslServerRootCertsPath != "" {
+		httpConMgr.ForwardClientCertDetails = hcmpb.HttpConnectionManager_SANITIZE_SET
+		httpConMgr.SetCurrentClientCertDetails = &hcmpb.HttpConnectionManager_SetCurrentClientCertDetails{
+			Subject: &wrapperspb.BoolValue{Value: true},
+			Dns:     true,
+			Uri:     true,
+		}
+	}
+	if serviceInfo.Options.AccessLogPath != "" {
+		accessLog, err := makeAccessLog(serviceInfo.Options)
+		if err != nil {
+			return nil, err
+		}
+		httpConMgr.AccessLog = []*accesslogpb.AccessLog{accessLog}
+	}
 	if serviceInfo.Options.UnderscoresInHeaders {
 		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
 			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_ALLOW,
@@ -195,57 +554,783 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_REJECT_REQUEST,
 		}
 	}
+	if err := setConnectionLimits(httpConMgr, serviceInfo.Options); err != nil {
+		return nil, err
+	}
 
 	jsonStr, _ := util.ProtoToJson(httpConMgr)
 	glog.Infof("adding Http Connection Manager config: %v", jsonStr)
 	httpConMgr.HttpFilters = httpFilters
+	return httpConMgr, nil
+}
 
-	// HTTP filter configuration
-	httpFilterConfig, err := ptypes.MarshalAny(httpConMgr)
-	if err != nil {
-		return nil, err
+// setConnectionLimits sets the timeouts of the downstream connections and
+// requests, and the limits of the HTTP/2 connections, leaving the ones not
+// set to the defaults of Envoy.
+func setConnectionLimits(httpConMgr *hcmpb.HttpConnectionManager, opts options.ConfigGeneratorOptions) error {
+	if opts.HttpIdleTimeout > 0 || opts.MaxConnectionDuration > 0 {
+		if httpConMgr.CommonHttpProtocolOptions == nil {
+			httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{}
+		}
+		if opts.HttpIdleTimeout > 0 {
+			httpConMgr.CommonHttpProtocolOptions.IdleTimeout = ptypes.DurationProto(opts.HttpIdleTimeout)
+		}
+		if opts.MaxConnectionDuration > 0 {
+			httpConMgr.CommonHttpProtocolOptions.MaxConnectionDuration = ptypes.DurationProto(opts.MaxConnectionDuration)
+		}
+	}
+	if opts.StreamIdleTimeout > 0 {
+		httpConMgr.StreamIdleTimeout = ptypes.DurationProto(opts.StreamIdleTimeout)
+	}
+	if opts.RequestTimeout > 0 {
+		httpConMgr.RequestTimeout = ptypes.DurationProto(opts.RequestTimeout)
 	}
 
-	filterChain := &listenerpb.FilterChain{
-		Filters: []*listenerpb.Filter{
-			{
-				Name:       util.HTTPConnectionManager,
-				ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: httpFilterConfig},
+	if opts.Http2MaxConcurrentStreams == 0 && opts.Http2InitialStreamWindowSize == 0 && opts.Http2InitialConnectionWindowSize == 0 {
+		return nil
+	}
+	http2Options := &corepb.Http2ProtocolOptions{}
+	if opts.Http2MaxConcurrentStreams != 0 {
+		if opts.Http2MaxConcurrentStreams < 1 || opts.Http2MaxConcurrentStreams > maxHttp2Value {
+			return fmt.Errorf("HTTP/2 max concurrent streams %d must be between 1 and %d", opts.Http2MaxConcurrentStreams, maxHttp2Value)
+		}
+		http2Options.MaxConcurrentStreams = &wrapperspb.UInt32Value{Value: uint32(opts.Http2MaxConcurrentStreams)}
+	}
+	if opts.Http2InitialStreamWindowSize != 0 {
+		if opts.Http2InitialStreamWindowSize < minHttp2WindowSize || opts.Http2InitialStreamWindowSize > maxHttp2Value {
+			return fmt.Errorf("HTTP/2 initial stream window size %d must be between %d and %d", opts.Http2InitialStreamWindowSize, minHttp2WindowSize, maxHttp2Value)
+		}
+		http2Options.InitialStreamWindowSize = &wrapperspb.UInt32Value{Value: uint32(opts.Http2InitialStreamWindowSize)}
+	}
+	if opts.Http2InitialConnectionWindowSize != 0 {
+		if opts.Http2InitialConnectionWindowSize < minHttp2WindowSize || opts.Http2InitialConnectionWindowSize > maxHttp2Value {
+			return fmt.Errorf("HTTP/2 initial connection window size %d must be between %d and %d", opts.Http2InitialConnectionWindowSize, minHttp2WindowSize, maxHttp2Value)
+		}
+		http2Options.InitialConnectionWindowSize = &wrapperspb.UInt32Value{Value: uint32(opts.Http2InitialConnectionWindowSize)}
+	}
+	httpConMgr.Http2ProtocolOptions = http2Options
+	return nil
+}
+
+func hasMethodCorsPolicy(serviceInfo *sc.ServiceInfo) bool {
+	for _, method := range serviceInfo.Methods {
+		if method.CorsPolicy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMethodRateLimits(serviceInfo *sc.ServiceInfo) bool {
+	for _, method := range serviceInfo.Methods {
+		if len(method.RateLimits) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func makeRateLimitFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	rateLimit := &rlpb.RateLimit{
+		Domain: util.RateLimitDomain,
+		// Respond with RESOURCE_EXHAUSTED instead of UNAVAILABLE to gRPC clients.
+		RateLimitedAsResourceExhausted: true,
+		FailureModeDeny:                serviceInfo.Options.RateLimitFailureModeDeny,
+		RateLimitService: &ratelimitpb.RateLimitServiceConfig{
+			GrpcService: &corepb.GrpcService{
+				TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+						ClusterName: util.RateLimitClusterName,
+					},
+				},
 			},
 		},
 	}
+	rateLimitAny, _ := ptypes.MarshalAny(rateLimit)
+	return &hcmpb.HttpFilter{
+		Name:       util.RateLimit,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: rateLimitAny},
+	}
+}
 
-	listenerName := "http_listener"
+// luaCookieValueFunction returns the value of a cookie in the Cookie header,
+// or nil if it is not there.
+const luaCookieValueFunction = `local function cookie_value(cookies, name)
+  for cookie in string.gmatch(cookies, "[^;]+") do
+    local key, value = string.match(cookie, "^%s*([^=]-)%s*=%s*(.-)%s*$")
+    if key == name then
+      return (string.gsub(value, '^"(.*)"$', "%1"))
+    end
+  end
+  return nil
+end
+`
+
+// jwtCookiesLuaCode copies the JWTs in cookies to the headers JWT Authn filter
+// reads them from, after removing the ones sent by the client. The headers are
+// removed by JWT Authn filter once the JWTs are verified.
+const jwtCookiesLuaCode = `local jwt_cookies = {%s}
+
+%s
+function envoy_on_request(request_handle)
+  local headers = request_handle:headers()
+  local cookies = headers:get("cookie")
+  for _, jwt_cookie in ipairs(jwt_cookies) do
+    headers:remove(jwt_cookie.header)
+    local value = cookies and cookie_value(cookies, jwt_cookie.cookie)
+    if value and value ~= "" then
+      headers:add(jwt_cookie.header, value)
+    end
+  end
+end
+`
+
+// accessLogLuaCode records the path without the query, which may have API
+// keys or JWTs, and whether the request has an API key, in the dynamic
+// metadata for the access log.
+const accessLogLuaCode = `local api_key_queries = {%s}
+local api_key_headers = {%s}
+local api_key_cookies = {%s}
+
+%s
+local function has_query_param(query, name)
+  for param in string.gmatch(query, "[^&]+") do
+    local key, value = string.match(param, "^([^=]*)=(.*)$")
+    if key == name and value ~= "" then
+      return true
+    end
+  end
+  return false
+end
+
+local function has_api_key(headers, query)
+  for _, name in ipairs(api_key_queries) do
+    if has_query_param(query, name) then
+      return true
+    end
+  end
+  for _, name in ipairs(api_key_headers) do
+    if headers:get(name) then
+      return true
+    end
+  end
+  local cookies = headers:get("cookie")
+  for _, name in ipairs(api_key_cookies) do
+    if cookies and cookie_value(cookies, name) then
+      return true
+    end
+  end
+  return false
+end
+
+function envoy_on_request(request_handle)
+  local headers = request_handle:headers()
+  local path = headers:get(":path") or ""
+  local query = ""
+  local query_start = string.find(path, "?", 1, true)
+  if query_start then
+    path, query = string.sub(path, 1, query_start - 1), string.sub(path, query_start + 1)
+  end
+  local metadata = request_handle:streamInfo():dynamicMetadata()
+  metadata:set(%s, "path", path)
+  metadata:set(%s, "api_key_present", has_api_key(headers, query))
+end
+`
+
+// accessLogFields are the fields of each request in the access log, and the
+// command operators of their values.
+var accessLogFields = []struct {
+	name     string
+	operator string
+	// Whether the value is quoted in the text format, as it may have spaces.
+	quoted bool
+}{
+	{name: "start_time", operator: "%START_TIME%"},
+	{name: "method", operator: "%REQ(:METHOD)%"},
+	{name: "path", operator: "%DYNAMIC_METADATA(" + util.Lua + ":path)%", quoted: true},
+	{name: "protocol", operator: "%PROTOCOL%"},
+	{name: "response_code", operator: "%RESPONSE_CODE%"},
+	{name: "response_flags", operator: "%RESPONSE_FLAGS%"},
+	{name: "bytes_received", operator: "%BYTES_RECEIVED%"},
+	{name: "bytes_sent", operator: "%BYTES_SENT%"},
+	{name: "duration_ms", operator: "%DURATION%"},
+	{name: "upstream_cluster", operator: "%UPSTREAM_CLUSTER%"},
+	{name: "upstream_host", operator: "%UPSTREAM_HOST%"},
+	{name: "client_address", operator: "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"},
+	{name: "user_agent", operator: "%REQ(USER-AGENT)%", quoted: true},
+	{name: "request_id", operator: "%REQ(X-REQUEST-ID)%"},
+	{name: "operation", operator: "%FILTER_STATE(" + util.OperationFilterStateKey + ")%"},
+	{name: "jwt_subject", operator: "%DYNAMIC_METADATA(" + util.JwtAuthn + ":" + util.JwtPayloadMetadataName + ":sub)%"},
+	{name: "api_key_present", operator: "%DYNAMIC_METADATA(" + util.Lua + ":api_key_present)%"},
+}
 
-	if serviceInfo.Options.SslServerCertPath != "" {
-		listenerName = "https_listener"
-		transportSocket, err := util.CreateDownstreamTransportSocket(
-			serviceInfo.Options.SslServerCertPath,
-			serviceInfo.Options.SslMinimumProtocol,
-			serviceInfo.Options.SslMaximumProtocol,
-		)
-		if err != nil {
-			return nil, err
+func makeAccessLogFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	var queries, headers, cookies []string
+	seen := make(map[string]bool)
+	for _, operation := range serviceInfo.Operations {
+		for _, location := range serviceInfo.RateLimitApiKeyLocations(operation) {
+			switch {
+			case location.GetQuery() != "" && !seen["query:"+location.GetQuery()]:
+				seen["query:"+location.GetQuery()] = true
+				queries = append(queries, luaString(location.GetQuery()))
+			case location.GetHeader() != "" && !seen["header:"+strings.ToLower(location.GetHeader())]:
+				seen["header:"+strings.ToLower(location.GetHeader())] = true
+				headers = append(headers, luaString(strings.ToLower(location.GetHeader())))
+			case location.GetCookie() != "" && !seen["cookie:"+location.GetCookie()]:
+				seen["cookie:"+location.GetCookie()] = true
+				cookies = append(cookies, luaString(location.GetCookie()))
+			}
 		}
-		filterChain.TransportSocket = transportSocket
 	}
 
-	return &v2pb.Listener{
-		Name: listenerName,
-		Address: &corepb.Address{
-			Address: &corepb.Address_SocketAddress{
-				SocketAddress: &corepb.SocketAddress{
-					Address: serviceInfo.Options.ListenerAddress,
-					PortSpecifier: &corepb.SocketAddress_PortValue{
-						PortValue: uint32(serviceInfo.Options.ListenerPort),
+	luaAny, _ := ptypes.MarshalAny(&luapb.Lua{
+		InlineCode: fmt.Sprintf(accessLogLuaCode, strings.Join(queries, ", "), strings.Join(headers, ", "), strings.Join(cookies, ", "),
+			luaCookieValueFunction, luaString(util.Lua), luaString(util.Lua)),
+	})
+	return &hcmpb.HttpFilter{
+		Name:       util.Lua,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: luaAny},
+	}
+}
+
+func makeAccessLog(opts options.ConfigGeneratorOptions) (*accesslogpb.AccessLog, error) {
+	fileAccessLog := &filelogpb.FileAccessLog{
+		Path: opts.AccessLogPath,
+	}
+	switch opts.AccessLogFormat {
+	case "json":
+		jsonFormat := &structpb.Struct{
+			Fields: make(map[string]*structpb.Value),
+		}
+		for _, field := range accessLogFields {
+			jsonFormat.Fields[field.name] = &structpb.Value{
+				Kind: &structpb.Value_StringValue{
+					StringValue: field.operator,
+				},
+			}
+		}
+		fileAccessLog.AccessLogFormat = &filelogpb.FileAccessLog_TypedJsonFormat{
+			TypedJsonFormat: jsonFormat,
+		}
+	case "text":
+		var pairs []string
+		for _, field := range accessLogFields {
+			if field.quoted {
+				pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", field.name, field.operator))
+			} else {
+				pairs = append(pairs, fmt.Sprintf("%s=%s", field.name, field.operator))
+			}
+		}
+		fileAccessLog.AccessLogFormat = &filelogpb.FileAccessLog_Format{
+			Format: strings.Join(pairs, " ") + "\n",
+		}
+	default:
+		return nil, fmt.Errorf(`invalid access log format %q, must be "json" or "text"`, opts.AccessLogFormat)
+	}
+
+	fileAccessLogAny, err := ptypes.MarshalAny(fileAccessLog)
+	if err != nil {
+		return nil, err
+	}
+	return &accesslogpb.AccessLog{
+		Name:       util.FileAccessLog,
+		ConfigType: &accesslogpb.AccessLog_TypedConfig{TypedConfig: fileAccessLogAny},
+	}, nil
+}
+
+func makeJwtCookiesFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	var jwtCookies []string
+	seen := make(map[string]bool)
+	for _, provider := range serviceInfo.ServiceConfig().GetAuthentication().GetProviders() {
+		for _, cookie := range serviceInfo.JwtCookies[provider.GetId()] {
+			if !seen[cookie] {
+				seen[cookie] = true
+				jwtCookies = append(jwtCookies, fmt.Sprintf("{cookie = %s, header = %s}",
+					luaString(cookie), luaString(jwtCookieHeader(cookie))))
+			}
+		}
+	}
+
+	luaAny, _ := ptypes.MarshalAny(&luapb.Lua{
+		InlineCode: fmt.Sprintf(jwtCookiesLuaCode, strings.Join(jwtCookies, ", "), luaCookieValueFunction),
+	})
+	return &hcmpb.HttpFilter{
+		Name:       util.Lua,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: luaAny},
+	}
+}
+
+// jwtCookieHeader returns the request header the JWT in the cookie is copied
+// to.
+func jwtCookieHeader(cookie string) string {
+	return util.JwtCookieHeaderPrefix + strings.ToLower(cookie)
+}
+
+// jwtHeadersLuaCode sets the claim headers to the claims of the verified JWT
+// payload, which is in the metadata of JWT Authn filter, after removing the
+// ones sent by the client. It also re-encodes the payload headers with base64
+// encoding, as JWT Authn filter forwards the payloads base64url encoded.
+const jwtHeadersLuaCode = `local claim_headers = {%s}
+local base64_payload_headers = {%s}
+
+local function claim_value(payload, path)
+  local value = payload
+  for _, key in ipairs(path) do
+    if type(value) ~= "table" then
+      return nil
+    end
+    value = value[key]
+  end
+  if type(value) ~= "table" then
+    return value ~= nil and tostring(value) or nil
+  end
+  -- Objects and empty lists are not forwarded.
+  if #value == 0 then
+    return nil
+  end
+  local values = {}
+  for i, v in ipairs(value) do
+    if type(v) == "table" then
+      return nil
+    end
+    values[i] = tostring(v)
+  end
+  return table.concat(values, ",")
+end
+
+function envoy_on_request(request_handle)
+  local headers = request_handle:headers()
+  local metadata = request_handle:streamInfo():dynamicMetadata():get(%s)
+  local payload = metadata and metadata[%s]
+  for _, claim_header in ipairs(claim_headers) do
+    headers:remove(claim_header.name)
+    local value = payload and claim_value(payload, claim_header.path)
+    if value then
+      headers:add(claim_header.name, value)
+    end
+  end
+  for _, name in ipairs(base64_payload_headers) do
+    local value = headers:get(name)
+    if value then
+      value = value:gsub("%%-", "+"):gsub("_", "/")
+      headers:replace(name, value .. string.rep("=", (4 - #value %% 4) %% 4))
+    end
+  end
+end
+`
+
+func hasBase64JwtPayloadHeaders(serviceInfo *sc.ServiceInfo) bool {
+	for _, header := range serviceInfo.JwtPayloadHeaders {
+		if header.Encoding == sc.JwtPayloadEncodingBase64 {
+			return true
+		}
+	}
+	return false
+}
+
+func makeJwtHeadersFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	var claimHeaders []string
+	for _, claimHeader := range serviceInfo.JwtClaimHeaders {
+		var path []string
+		for _, key := range claimHeader.ClaimPath {
+			path = append(path, luaString(key))
+		}
+		claimHeaders = append(claimHeaders, fmt.Sprintf("{name = %s, path = {%s}}",
+			luaString(strings.ToLower(claimHeader.Header)), strings.Join(path, ", ")))
+	}
+
+	var payloadHeaders []string
+	seen := make(map[string]bool)
+	for _, provider := range serviceInfo.ServiceConfig().GetAuthentication().GetProviders() {
+		header := serviceInfo.JwtPayloadHeader(provider.GetId())
+		name := strings.ToLower(header.Name)
+		if header.Encoding == sc.JwtPayloadEncodingBase64 && !seen[name] {
+			seen[name] = true
+			payloadHeaders = append(payloadHeaders, luaString(name))
+		}
+	}
+
+	return makeLuaFilter(fmt.Sprintf(jwtHeadersLuaCode, strings.Join(claimHeaders, ", "), strings.Join(payloadHeaders, ", "),
+		luaString(util.JwtAuthn), luaString(util.JwtPayloadMetadataName)))
+}
+
+func hasMethodClaimRequirements(serviceInfo *sc.ServiceInfo) bool {
+	for _, method := range serviceInfo.Methods {
+		if len(method.ClaimRequirements) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtClaimsLuaCode rejects the requests to the operations with claim
+// requirements whose verified JWT payload, in the metadata of JWT Authn filter,
+// does not meet all of them. The operation is the one Path Matcher filter puts
+// in its metadata, so the requirements do not depend on the route the request
+// matches. Requests to other operations, or without an operation, are not
+// checked.
+const jwtClaimsLuaCode = `local operation_claims = {%s}
+
+local function claim_value(payload, path)
+  local value = payload
+  for _, key in ipairs(path) do
+    if type(value) ~= "table" then
+      return nil
+    end
+    value = value[key]
+  end
+  return value
+end
+
+-- Whether value is a list with the element, or a string of space-separated
+-- values with it.
+local function contains(value, element)
+  if type(value) == "table" then
+    for _, v in ipairs(value) do
+      if v == element then
+        return true
+      end
+    end
+  elseif type(value) == "string" then
+    for v in value:gmatch("%%S+") do
+      if v == element then
+        return true
+      end
+    end
+  end
+  return false
+end
+
+local function meets(value, claim)
+  if claim.exact ~= nil then
+    return value == claim.exact
+  elseif claim.contains ~= nil then
+    return contains(value, claim.contains)
+  elseif claim.prefix ~= nil then
+    return type(value) == "string" and value:sub(1, #claim.prefix) == claim.prefix
+  end
+  return contains(claim.any_of, value)
+end
+
+function envoy_on_request(request_handle)
+  local metadata = request_handle:streamInfo():dynamicMetadata()
+  local path_matcher = metadata:get(%s)
+  local operation = path_matcher and path_matcher[%s]
+  local claims = operation and operation_claims[operation]
+  if claims == nil then
+    return
+  end
+  local jwt_authn = metadata:get(%s)
+  local payload = jwt_authn and jwt_authn[%s]
+  for _, claim in ipairs(claims) do
+    if not meets(claim_value(payload, claim.path), claim) then
+      request_handle:respond({[":status"] = "403"},
+        "JWT claim \"" .. claim.name .. "\" does not meet the requirement of the operation.")
+      return
+    end
+  end
+end
+`
+
+func makeJwtClaimsFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	var operationClaims []string
+	for _, operation := range serviceInfo.Operations {
+		method := serviceInfo.Methods[operation]
+		if len(method.ClaimRequirements) == 0 {
+			continue
+		}
+		var claims []string
+		for _, claim := range method.ClaimRequirements {
+			claims = append(claims, luaClaimRequirement(claim))
+		}
+		operationClaims = append(operationClaims, fmt.Sprintf("[%s] = {%s}", luaString(operation), strings.Join(claims, ", ")))
+	}
+
+	return makeLuaFilter(fmt.Sprintf(jwtClaimsLuaCode, strings.Join(operationClaims, ", "),
+		luaString(util.PathMatcher), luaString(util.OperationMetadataKey),
+		luaString(util.JwtAuthn), luaString(util.JwtPayloadMetadataName)))
+}
+
+func luaClaimRequirement(claim *sc.ClaimRequirement) string {
+	var path []string
+	for _, key := range claim.ClaimPath {
+		path = append(path, luaString(key))
+	}
+
+	var match string
+	switch {
+	case claim.Exact != nil:
+		match = "exact = " + luaClaimValue(claim.Exact)
+	case claim.Contains != "":
+		match = "contains = " + luaString(claim.Contains)
+	case claim.Prefix != "":
+		match = "prefix = " + luaString(claim.Prefix)
+	default:
+		var values []string
+		for _, value := range claim.AnyOf {
+			values = append(values, luaClaimValue(value))
+		}
+		match = fmt.Sprintf("any_of = {%s}", strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("{name = %s, path = {%s}, %s}", luaString(claim.Claim), strings.Join(path, ", "), match)
+}
+
+// luaClaimValue returns the Lua literal of a claim value, which is a string, a
+// bool or a float64.
+func luaClaimValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return luaString(fmt.Sprint(value))
+}
+
+func makeExtAuthzFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	extAuthz := serviceInfo.ExtAuthz
+	extAuthzConfig := &eapb.ExtAuthz{
+		FailureModeAllow: extAuthz.FailOpen,
+	}
+	if extAuthz.Cluster.Protocol == util.GRPC {
+		extAuthzConfig.Services = &eapb.ExtAuthz_GrpcService{
+			GrpcService: &corepb.GrpcService{
+				TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+						ClusterName: extAuthz.Cluster.ClusterName,
 					},
 				},
+				Timeout: ptypes.DurationProto(extAuthz.Timeout),
+			},
+		}
+		// The verified JWT payloads are in the metadata of JWT Authn filter.
+		extAuthzConfig.MetadataContextNamespaces = []string{util.JwtAuthn}
+	} else {
+		// Besides the forwarded headers, Envoy always sends Host, Method,
+		// Path, Content-Length and Authorization headers.
+		allowedHeaders := &matcher.ListStringMatcher{}
+		headers := serviceInfo.JwtPayloadHeaderNames()
+		for _, claimHeader := range serviceInfo.JwtClaimHeaders {
+			headers = append(headers, claimHeader.Header)
+		}
+		for _, header := range append(headers, extAuthz.ForwardHeaders...) {
+			allowedHeaders.Patterns = append(allowedHeaders.Patterns, &matcher.StringMatcher{
+				MatchPattern: &matcher.StringMatcher_Exact{
+					Exact: header,
+				},
+				IgnoreCase: true,
+			})
+		}
+		extAuthzConfig.Services = &eapb.ExtAuthz_HttpService{
+			HttpService: &eapb.HttpService{
+				ServerUri: &corepb.HttpUri{
+					Uri: extAuthz.Uri,
+					HttpUpstreamType: &corepb.HttpUri_Cluster{
+						Cluster: extAuthz.Cluster.ClusterName,
+					},
+					Timeout: ptypes.DurationProto(extAuthz.Timeout),
+				},
+				PathPrefix: extAuthz.PathPrefix,
+				AuthorizationRequest: &eapb.AuthorizationRequest{
+					AllowedHeaders: allowedHeaders,
+				},
+			},
+		}
+	}
+
+	extAuthzAny, _ := ptypes.MarshalAny(extAuthzConfig)
+	return &hcmpb.HttpFilter{
+		Name:       util.ExtAuthz,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: extAuthzAny},
+	}
+}
+
+func hasMethodFaults(serviceInfo *sc.ServiceInfo) bool {
+	for _, method := range serviceInfo.Methods {
+		if method.Fault != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func makeFaultFilter() *hcmpb.HttpFilter {
+	// The filter does not inject any fault by itself, the faults are in the
+	// per-route configs of the methods.
+	faultAny, _ := ptypes.MarshalAny(&faultpb.HTTPFault{})
+	return &hcmpb.HttpFilter{
+		Name:       util.Fault,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: faultAny},
+	}
+}
+
+// makeResponseCompressionFilters makes the Gzip filter, and the Lua filters
+// around it turning it off for streaming methods.
+//
+// Gzip filter holds back streamed messages until enough data is compressed,
+// and there is no per route config to turn it off. It only compresses the
+// responses of requests with an Accept-Encoding header, so the first Lua
+// filter moves the header of the requests to the routes with the
+// disableResponseCompressionKey metadata into the dynamic metadata, and the
+// second one puts it back after Gzip filter. The backend gets the request
+// unchanged.
+func makeResponseCompressionFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	gzipFilter, err := makeGzipFilter(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if !hasStreamingMethods(serviceInfo) {
+		return []*hcmpb.HttpFilter{gzipFilter}, nil
+	}
+	return []*hcmpb.HttpFilter{
+		makeLuaFilter(fmt.Sprintf(stashAcceptEncodingLuaCode,
+			luaString(disableResponseCompressionKey), luaString(util.Lua), luaString(stashedAcceptEncodingKey))),
+		gzipFilter,
+		makeLuaFilter(fmt.Sprintf(restoreAcceptEncodingLuaCode,
+			luaString(util.Lua), luaString(stashedAcceptEncodingKey), luaString(stashedAcceptEncodingKey))),
+	}, nil
+}
+
+func hasStreamingMethods(serviceInfo *sc.ServiceInfo) bool {
+	for _, method := range serviceInfo.Methods {
+		if method.IsStreaming {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// disableResponseCompressionKey is the key of the route metadata of the
+	// routes whose responses are not compressed.
+	disableResponseCompressionKey = "disable_response_compression"
+	// stashedAcceptEncodingKey is the key of the dynamic metadata holding the
+	// Accept-Encoding header while Gzip filter runs.
+	stashedAcceptEncodingKey = "stashed_accept_encoding"
+)
+
+const stashAcceptEncodingLuaCode = `function envoy_on_request(request_handle)
+  if request_handle:metadata():get(%s) then
+    local accept_encoding = request_handle:headers():get("accept-encoding")
+    if accept_encoding then
+      request_handle:streamInfo():dynamicMetadata():set(%s, %s, accept_encoding)
+      request_handle:headers():remove("accept-encoding")
+    end
+  end
+end
+`
+
+const restoreAcceptEncodingLuaCode = `function envoy_on_request(request_handle)
+  local metadata = request_handle:streamInfo():dynamicMetadata():get(%s)
+  if metadata and metadata[%s] then
+    request_handle:headers():replace("accept-encoding", metadata[%s])
+  end
+end
+`
+
+func makeLuaFilter(code string) *hcmpb.HttpFilter {
+	luaAny, _ := ptypes.MarshalAny(&luapb.Lua{
+		InlineCode: code,
+	})
+	return &hcmpb.HttpFilter{
+		Name:       util.Lua,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: luaAny},
+	}
+}
+
+// luaString returns the Lua string literal of s, with the bytes other than
+// printable ASCII escaped.
+func luaString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= ' ' && c <= '~' && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%03d", c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func makeGzipFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	opts := serviceInfo.Options
+	if opts.ResponseCompressionMinContentLength < 0 {
+		return nil, fmt.Errorf("invalid response compression min content length %d, must be >= 0", opts.ResponseCompressionMinContentLength)
+	}
+
+	gzip := &gzippb.Gzip{
+		Compressor: &compressorpb.Compressor{
+			ContentLength: &wrapperspb.UInt32Value{
+				Value: uint32(opts.ResponseCompressionMinContentLength),
 			},
 		},
-		FilterChains: []*listenerpb.FilterChain{filterChain},
+	}
+	if opts.ResponseCompressionContentTypes != "" {
+		for _, contentType := range strings.Split(opts.ResponseCompressionContentTypes, ",") {
+			gzip.Compressor.ContentType = append(gzip.Compressor.ContentType, strings.TrimSpace(contentType))
+		}
+	}
+
+	switch opts.ResponseCompressionLevel {
+	case "default", "":
+		gzip.CompressionLevel = gzippb.Gzip_CompressionLevel_DEFAULT
+	case "best":
+		gzip.CompressionLevel = gzippb.Gzip_CompressionLevel_BEST
+	case "speed":
+		gzip.CompressionLevel = gzippb.Gzip_CompressionLevel_SPEED
+	default:
+		return nil, fmt.Errorf(`invalid response compression level %q, must be one of "default", "best" and "speed"`, opts.ResponseCompressionLevel)
+	}
+
+	gzipAny, err := ptypes.MarshalAny(gzip)
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.Gzip,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: gzipAny},
 	}, nil
 }
 
+func hasRequestBodyLimits(serviceInfo *sc.ServiceInfo) bool {
+	if serviceInfo.Options.MaxRequestBodyBytes > 0 {
+		return true
+	}
+	for _, method := range serviceInfo.Methods {
+		if method.MaxRequestBodyBytes > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func makeBufferFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	// Without a global limit, the filter is disabled on the virtual host and
+	// only enabled on the routes of methods with their own limit. The limit is
+	// still required in the filter config.
+	maxRequestBytes := uint32(serviceInfo.Options.MaxRequestBodyBytes)
+	if maxRequestBytes == 0 {
+		for _, method := range serviceInfo.Methods {
+			if method.MaxRequestBodyBytes > maxRequestBytes {
+				maxRequestBytes = method.MaxRequestBodyBytes
+			}
+		}
+	}
+
+	buffer := &bufpb.Buffer{
+		MaxRequestBytes: &wrapperspb.UInt32Value{
+			Value: maxRequestBytes,
+		},
+	}
+	bufferAny, _ := ptypes.MarshalAny(buffer)
+	return &hcmpb.HttpFilter{
+		Name:       util.Buffer,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: bufferAny},
+	}
+}
+
 func makePathMatcherFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	rules := []*pmpb.PathMatcherRule{}
 	for _, operation := range serviceInfo.Operations {
@@ -343,16 +1428,37 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	}
 	providers := make(map[string]*jwtpb.JwtProvider)
 	for _, provider := range auth.GetProviders() {
-		clusterName, err := util.ExtraAddressFromURI(provider.GetJwksUri())
-		if err != nil {
-			return nil
-		}
-
 		fromHeaders, fromParams := processJwtLocations(provider)
+		for _, cookie := range serviceInfo.JwtCookies[provider.GetId()] {
+			fromHeaders = append(fromHeaders, &jwtpb.JwtHeader{
+				Name: jwtCookieHeader(cookie),
+			})
+		}
 
 		jp := &jwtpb.JwtProvider{
-			Issuer: provider.GetIssuer(),
-			JwksSourceSpecifier: &jwtpb.JwtProvider_RemoteJwks{
+			Issuer:               provider.GetIssuer(),
+			FromHeaders:          fromHeaders,
+			FromParams:           fromParams,
+			ForwardPayloadHeader: serviceInfo.JwtPayloadHeader(provider.GetId()).Name,
+		}
+
+		if jwks, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			// Local JWKS are inlined, so a changed file is applied with a new
+			// snapshot.
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_LocalJwks{
+				LocalJwks: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: jwks,
+					},
+				},
+			}
+		} else {
+			clusterName, err := util.ExtraAddressFromURI(provider.GetJwksUri())
+			if err != nil {
+				return nil
+			}
+
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_RemoteJwks{
 				RemoteJwks: &jwtpb.RemoteJwks{
 					HttpUri: &corepb.HttpUri{
 						Uri: provider.GetJwksUri(),
@@ -365,10 +1471,7 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 						Seconds: int64(serviceInfo.Options.JwksCacheDurationInS),
 					},
 				},
-			},
-			FromHeaders:          fromHeaders,
-			FromParams:           fromParams,
-			ForwardPayloadHeader: "X-Endpoint-API-UserInfo",
+			}
 		}
 
 		if len(provider.GetAudiences()) != 0 {
@@ -404,7 +1507,7 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	jwtAuthentication := &jwtpb.JwtAuthentication{
 		Providers: providers,
 		FilterStateRules: &jwtpb.FilterStateRule{
-			Name:     "envoy.filters.http.path_matcher.operation",
+			Name:     util.OperationFilterStateKey,
 			Requires: requirements,
 		},
 	}
@@ -485,6 +1588,15 @@ func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) *scpb.
 	return setting
 }
 
+func containsHeader(headers []string, header string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
 func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	if serviceInfo == nil || serviceInfo.ServiceConfig().GetControl().GetEnvironment() == "" {
 		return nil
@@ -515,6 +1627,9 @@ func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 			service.LogRequestHeaders[i] = strings.TrimSpace(service.LogRequestHeaders[i])
 		}
 	}
+	if serviceInfo.Options.SslServerRootCertsPath != "" && !containsHeader(service.LogRequestHeaders, util.ClientCertHeaderName) {
+		service.LogRequestHeaders = append(service.LogRequestHeaders, util.ClientCertHeaderName)
+	}
 	if serviceInfo.Options.LogResponseHeaders != "" {
 		service.LogResponseHeaders = strings.Split(serviceInfo.Options.LogResponseHeaders, ",")
 		for i := range service.LogResponseHeaders {
@@ -17,14 +17,26 @@ package configgenerator
 import (
 	"encoding/base64"
 	"fmt"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
 
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	authpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	luapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	anypb "github.com/golang/protobuf/ptypes/any"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
@@ -394,6 +406,60 @@ func TestJwtAuthnFilter(t *testing.T) {
             }
         }
     }
+}`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter with inline jwks from data uri",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "data:application/json;base64,eyJrZXlzIjpbXX0=",
+						},
+					},
+				},
+			},
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.config.filter.http.jwt_authn.v2alpha.JwtAuthentication",
+        "filterStateRules": {
+            "name": "envoy.filters.http.path_matcher.operation"
+        },
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "localJwks": {
+                    "inlineString": "{\"keys\":[]}"
+                },
+                "payloadInMetadata": "jwt_payloads"
+            }
+        }
+    }
 }`,
 		},
 	}
@@ -1406,138 +1472,1650 @@ func TestHealthCheckFilter(t *testing.T) {
 	}
 }
 
-func TestMakeListeners(t *testing.T) {
-	testdata := []struct {
-		desc              string
-		sslServerCertPath string
-		fakeServiceConfig *confpb.Service
-		wantListeners     []string
-	}{
-		{
-			desc:              "Success, generate redirect listener when ssl_port is configured",
-			sslServerCertPath: "/etc/endpoints/ssl",
-			fakeServiceConfig: &confpb.Service{
-				Name: testProjectName,
-				Apis: []*apipb.Api{
+func TestRateLimitFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
 					{
-						Name: "endpoints.examples.bookstore.Bookstore",
-						Methods: []*apipb.Method{
-							{
-								Name: "CreateShelf",
-							},
-						},
+						Name: "ListShelves",
 					},
 				},
 			},
-			wantListeners: []string{
-				`{
-					"name": "https_listener",
-					"address":{
-						"socketAddress":{
-							"address":"0.0.0.0",
-							"portValue":8080
+		},
+	}
+
+	testdata := []struct {
+		desc                string
+		failureModeDeny     bool
+		wantRateLimitFilter string
+	}{
+		{
+			desc: "Success, generate rate limit filter allowing requests when the rate limit server fails",
+			wantRateLimitFilter: `{
+				"name": "envoy.filters.http.ratelimit",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit",
+					"domain": "espv2",
+					"rateLimitService": {
+						"grpcService": {
+							"envoyGrpc": {
+								"clusterName": "rate-limit-cluster"
 							}
+						}
 					},
-					"filterChains":[
-						{
-							"filters":[
-								{
-									"name":"envoy.filters.network.http_connection_manager",
-									"typedConfig":{
-										"@type":"type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager",
-									  "httpFilters":[
-											{
-												"name":"envoy.filters.http.router",
-												"typedConfig":{
-													"@type":"type.googleapis.com/envoy.config.filter.http.router.v2.Router",
-													"startChildSpan":true,
-													"suppressEnvoyHeaders":true
-												}
-											}
-										],
-										"routeConfig":{
-											"name":"local_route",
-											"virtualHosts":[
-												{
-													"domains":["*"],
-													"name":"backend",
-													"routes":[
-														{
-															"match":{
-																"prefix":"/"
-															},
-															"route":{
-																"cluster":"bookstore.endpoints.project123.cloud.goog_local",
-																"timeout":"15s"
-															}
-														}
-													]
-												}
-											]
-										},
-										"upgradeConfigs":[{"upgradeType":"websocket"}],
-										"statPrefix":"ingress_http",
-										"commonHttpProtocolOptions":{},
-										"tracing":{},
-										"useRemoteAddress":false,
-										"xffNumTrustedHops":2
-									}
-								}
-							],
-							"transportSocket":{
-								"name":"envoy.transport_sockets.tls",
-								"typedConfig":{
-									"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
-									"commonTlsContext":{
-										"alpnProtocols": ["h2", "http/1.1"],
-										"tlsCertificates":[
-											{
-												"certificateChain":{
-													"filename":"/etc/endpoints/ssl/server.crt"
-											  },
-					 						  "privateKey":{
-												  "filename":"/etc/endpoints/ssl/server.key"
-											  }
-										  }
-									  ]
-								  }
-							  }
-						  }
-					  }
-					]
-				}`,
-			},
+					"rateLimitedAsResourceExhausted": true
+				}
+			}`,
+		},
+		{
+			desc:            "Success, generate rate limit filter rejecting requests when the rate limit server fails",
+			failureModeDeny: true,
+			wantRateLimitFilter: `{
+				"name": "envoy.filters.http.ratelimit",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit",
+					"domain": "espv2",
+					"failureModeDeny": true,
+					"rateLimitService": {
+						"grpcService": {
+							"envoyGrpc": {
+								"clusterName": "rate-limit-cluster"
+							}
+						}
+					},
+					"rateLimitedAsResourceExhausted": true
+				}
+			}`,
 		},
 	}
 
 	for i, tc := range testdata {
 		opts := options.DefaultConfigGeneratorOptions()
-		opts.SslServerCertPath = tc.sslServerCertPath
-		opts.UnderscoresInHeaders = true
-		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+		opts.RateLimitFailureModeDeny = tc.failureModeDeny
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		listeners, err := MakeListeners(fakeServiceInfo)
+		filter := makeRateLimitFilter(fakeServiceInfo)
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		gotFilter, err := marshaler.MarshalToString(filter)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if len(listeners) != len(tc.wantListeners) {
-			t.Errorf("Test Desc(%d): %s, MakeListeners failed,\ngot: %d, \nwant: %d", i, tc.desc, len(listeners), len(tc.wantListeners))
-			continue
+
+		if err := util.JsonEqual(tc.wantRateLimitFilter, gotFilter); err != nil {
+			t.Errorf("Test Desc(%d): %s, makeRateLimitFilter failed,\n%v", i, tc.desc, err)
 		}
+	}
+}
 
-		marshaler := &jsonpb.Marshaler{}
-		for j, wantListener := range tc.wantListeners {
-			gotListener, err := marshaler.MarshalToString(listeners[j])
-			if err != nil {
-				t.Fatal(err)
+func TestGzipFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc             string
+		minContentLength int
+		contentTypes     string
+		level            string
+		wantGzipFilter   string
+		wantedError      string
+	}{
+		{
+			desc:             "Success, generate gzip filter with default content types",
+			minContentLength: 30,
+			level:            "default",
+			wantGzipFilter: `{
+        "name": "envoy.filters.http.gzip",
+        "typedConfig": {
+          "@type": "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip",
+          "compressor": {
+            "contentLength": 30
+          }
+        }
+      }`,
+		},
+		{
+			desc:             "Success, generate gzip filter with content types and level",
+			minContentLength: 1024,
+			contentTypes:     "application/json, text/plain",
+			level:            "best",
+			wantGzipFilter: `{
+        "name": "envoy.filters.http.gzip",
+        "typedConfig": {
+          "@type": "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip",
+          "compressionLevel": "BEST",
+          "compressor": {
+            "contentLength": 1024,
+            "contentType": [
+              "application/json",
+              "text/plain"
+            ]
+          }
+        }
+      }`,
+		},
+		{
+			desc:             "Failure, invalid level",
+			minContentLength: 30,
+			level:            "fast",
+			wantedError:      `invalid response compression level "fast", must be one of "default", "best" and "speed"`,
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.EnableResponseCompression = true
+		opts.ResponseCompressionMinContentLength = tc.minContentLength
+		opts.ResponseCompressionContentTypes = tc.contentTypes
+		opts.ResponseCompressionLevel = tc.level
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeGzipFilter(fakeServiceInfo)
+		if tc.wantedError != "" {
+			if err == nil || err.Error() != tc.wantedError {
+				t.Errorf("Test Desc(%d): %s, makeGzipFilter got error: %v, want error: %s", i, tc.desc, err, tc.wantedError)
 			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
 
-			if err := util.JsonEqual(wantListener, gotListener); err != nil {
-				t.Errorf("Test Desc(%d): %s, MakeListeners failed for listener(%d), \n %v ", i, tc.desc, j, err)
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := util.JsonEqual(tc.wantGzipFilter, gotFilter); err != nil {
+			t.Errorf("Test Desc(%d): %s, makeGzipFilter failed,\n%v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestResponseCompressionFilters(t *testing.T) {
+	testdata := []struct {
+		desc            string
+		streaming       bool
+		wantFilterNames []string
+		wantLuaCodes    []string
+	}{
+		{
+			desc:            "Only Gzip filter without streaming methods",
+			wantFilterNames: []string{util.Gzip},
+		},
+		{
+			desc:            "Lua filters around Gzip filter with streaming methods",
+			streaming:       true,
+			wantFilterNames: []string{util.Lua, util.Gzip, util.Lua},
+			wantLuaCodes: []string{
+				`function envoy_on_request(request_handle)
+  if request_handle:metadata():get("disable_response_compression") then
+    local accept_encoding = request_handle:headers():get("accept-encoding")
+    if accept_encoding then
+      request_handle:streamInfo():dynamicMetadata():set("envoy.filters.http.lua", "stashed_accept_encoding", accept_encoding)
+      request_handle:headers():remove("accept-encoding")
+    end
+  end
+end
+`,
+				`function envoy_on_request(request_handle)
+  local metadata = request_handle:streamInfo():dynamicMetadata():get("envoy.filters.http.lua")
+  if metadata and metadata["stashed_accept_encoding"] then
+    request_handle:headers():replace("accept-encoding", metadata["stashed_accept_encoding"])
+  end
+end
+`,
+			},
+		},
+	}
+
+	for i, tc := range testdata {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: "endpoints.examples.bookstore.Bookstore",
+					Methods: []*apipb.Method{
+						{
+							Name:              "ListBooks",
+							ResponseStreaming: tc.streaming,
+						},
+					},
+				},
+			},
+		}
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendAddress = "grpc://127.0.0.1:80"
+		opts.EnableResponseCompression = true
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filters, err := makeResponseCompressionFilters(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotFilterNames, gotLuaCodes []string
+		for _, filter := range filters {
+			gotFilterNames = append(gotFilterNames, filter.GetName())
+			if filter.GetName() != util.Lua {
+				continue
+			}
+			lua := &luapb.Lua{}
+			if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), lua); err != nil {
+				t.Fatal(err)
 			}
+			gotLuaCodes = append(gotLuaCodes, lua.GetInlineCode())
+		}
+		if diff := cmp.Diff(tc.wantFilterNames, gotFilterNames); diff != "" {
+			t.Errorf("Test Desc(%d): %s, filter names diff (-want +got):\n%s", i, tc.desc, diff)
 		}
+		if diff := cmp.Diff(tc.wantLuaCodes, gotLuaCodes); diff != "" {
+			t.Errorf("Test Desc(%d): %s, Lua code diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
+
+func TestExtAuthzFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc               string
+		extAuthzConfig     string
+		wantExtAuthzFilter string
+	}{
+		{
+			desc: "Success, generate external authorization filter for gRPC service",
+			extAuthzConfig: `{
+				"address": "grpc://policy-engine:9000",
+				"timeout": "500ms",
+				"fail_open": true
+			}`,
+			wantExtAuthzFilter: `{
+				"name": "envoy.filters.http.ext_authz",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+					"failureModeAllow": true,
+					"grpcService": {
+						"envoyGrpc": {
+							"clusterName": "ext-authz-cluster"
+						},
+						"timeout": "0.500s"
+					},
+					"metadataContextNamespaces": [
+						"envoy.filters.http.jwt_authn"
+					]
+				}
+			}`,
+		},
+		{
+			desc: "Success, generate external authorization filter for HTTP service",
+			extAuthzConfig: `{
+				"address": "https://policy-engine/authz",
+				"forward_headers": ["x-request-id"]
+			}`,
+			wantExtAuthzFilter: `{
+				"name": "envoy.filters.http.ext_authz",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+					"httpService": {
+						"authorizationRequest": {
+							"allowedHeaders": {
+								"patterns": [
+									{
+										"exact": "X-Endpoint-API-UserInfo",
+										"ignoreCase": true
+									},
+									{
+										"exact": "x-request-id",
+										"ignoreCase": true
+									}
+								]
+							}
+						},
+						"pathPrefix": "/authz",
+						"serverUri": {
+							"cluster": "ext-authz-cluster",
+							"timeout": "1s",
+							"uri": "https://policy-engine:443/authz"
+						}
+					}
+				}
+			}`,
+		},
+	}
+
+	for i, tc := range testdata {
+		path := writeTempConfigFile(t, tc.extAuthzConfig)
+		defer os.Remove(path)
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ExtAuthzConfigPath = path
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := makeExtAuthzFilter(fakeServiceInfo)
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := util.JsonEqual(tc.wantExtAuthzFilter, gotFilter); err != nil {
+			t.Errorf("Test Desc(%d): %s, makeExtAuthzFilter failed,\n%v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestJwtClaimsFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetShelf",
+					},
+					{
+						Name: "GetSpecialShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves/{shelf}",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetSpecialShelf",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves/special",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetSpecialShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                string
+		jwtClaimsConfig     string
+		wantOperationClaims string
+	}{
+		{
+			desc: "Success, claims of an operation, including nested claims, lists and numbers",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.GetSpecialShelf",
+						"claims": [
+							{"claim": "email_verified", "exact": true},
+							{"claim": "realm_access.roles", "contains": "librarian"},
+							{"claim": "role", "any_of": ["admin", 7]},
+							{"claim": "email", "prefix": "admin@"}
+						]
+					}
+				]
+			}`,
+			wantOperationClaims: `local operation_claims = {["endpoints.examples.bookstore.Bookstore.GetSpecialShelf"] = {{name = "email_verified", path = {"email_verified"}, exact = true}, {name = "realm_access.roles", path = {"realm_access", "roles"}, contains = "librarian"}, {name = "role", path = {"role"}, any_of = {"admin", 7}}, {name = "email", path = {"email"}, prefix = "admin@"}}}`,
+		},
+		{
+			desc: "Success, claims of the operations of an API",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "scope", "contains": "shelves.read"}
+						]
+					}
+				]
+			}`,
+			wantOperationClaims: `local operation_claims = {["endpoints.examples.bookstore.Bookstore.GetShelf"] = {{name = "scope", path = {"scope"}, contains = "shelves.read"}}, ["endpoints.examples.bookstore.Bookstore.GetSpecialShelf"] = {{name = "scope", path = {"scope"}, contains = "shelves.read"}}}`,
+		},
+	}
+
+	for i, tc := range testdata {
+		path := writeTempConfigFile(t, tc.jwtClaimsConfig)
+		defer os.Remove(path)
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtClaimsConfigPath = path
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		httpConMgr, err := makeHttpConnectionManager(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The claims are checked by the operation Path Matcher filter matches,
+		// after JWT Authn filter verifies the JWT.
+		var gotFilterNames []string
+		var code string
+		for _, filter := range httpConMgr.GetHttpFilters() {
+			switch filter.GetName() {
+			case util.PathMatcher, util.JwtAuthn:
+				gotFilterNames = append(gotFilterNames, filter.GetName())
+			case util.Lua:
+				lua := &luapb.Lua{}
+				if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), lua); err != nil {
+					t.Fatal(err)
+				}
+				if strings.HasPrefix(lua.GetInlineCode(), "local operation_claims") {
+					gotFilterNames = append(gotFilterNames, filter.GetName())
+					code = lua.GetInlineCode()
+				}
+			}
+		}
+		wantFilterNames := []string{util.PathMatcher, util.JwtAuthn, util.Lua}
+		if diff := cmp.Diff(wantFilterNames, gotFilterNames); diff != "" {
+			t.Errorf("Test Desc(%d): %s, filter names diff (-want +got):\n%s", i, tc.desc, diff)
+			continue
+		}
+		if got := strings.Split(code, "\n")[0]; got != tc.wantOperationClaims {
+			t.Errorf("Test Desc(%d): %s, got operation claims:\n%s\nwant:\n%s", i, tc.desc, got, tc.wantOperationClaims)
+		}
+		// Only the operations with claim requirements are checked, requests
+		// to other operations or without an operation are allowed.
+		for _, want := range []string{
+			`local path_matcher = metadata:get("envoy.filters.http.path_matcher")`,
+			`local claims = operation and operation_claims[operation]`,
+		} {
+			if !strings.Contains(code, want) {
+				t.Errorf("Test Desc(%d): %s, got code without %s:\n%s", i, tc.desc, want, code)
+			}
+		}
+
+		// The requests to GetSpecialShelf reach the route shared with the
+		// unprotected operations, which has no claim requirements.
+		routeConfig, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes := routeConfig.GetVirtualHosts()[0].GetRoutes()
+		if len(routes) != 1 || routes[0].GetMatch().GetPrefix() != "/" || routes[0].GetTypedPerFilterConfig() != nil {
+			t.Errorf("Test Desc(%d): %s, got routes: %v, want only the catch-all route", i, tc.desc, routes)
+		}
+	}
+}
+
+func TestMakeListeners(t *testing.T) {
+	testdata := []struct {
+		desc              string
+		sslServerCertPath string
+		fakeServiceConfig *confpb.Service
+		wantListeners     []string
+	}{
+		{
+			desc:              "Success, generate redirect listener when ssl_port is configured",
+			sslServerCertPath: "/etc/endpoints/ssl",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "CreateShelf",
+							},
+						},
+					},
+				},
+			},
+			wantListeners: []string{
+				`{
+					"name": "https_listener",
+					"address":{
+						"socketAddress":{
+							"address":"0.0.0.0",
+							"portValue":8080
+							}
+					},
+					"filterChains":[
+						{
+							"filters":[
+								{
+									"name":"envoy.filters.network.http_connection_manager",
+									"typedConfig":{
+										"@type":"type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager",
+									  "httpFilters":[
+											{
+												"name":"envoy.filters.http.router",
+												"typedConfig":{
+													"@type":"type.googleapis.com/envoy.config.filter.http.router.v2.Router",
+													"startChildSpan":true,
+													"suppressEnvoyHeaders":true
+												}
+											}
+										],
+										"routeConfig":{
+											"name":"local_route",
+											"virtualHosts":[
+												{
+													"domains":["*"],
+													"name":"backend",
+													"routes":[
+														{
+															"match":{
+																"prefix":"/"
+															},
+															"route":{
+																"cluster":"bookstore.endpoints.project123.cloud.goog_local",
+																"timeout":"15s"
+															}
+														}
+													]
+												}
+											]
+										},
+										"upgradeConfigs":[{"upgradeType":"websocket"}],
+										"statPrefix":"ingress_http",
+										"commonHttpProtocolOptions":{},
+										"tracing":{},
+										"useRemoteAddress":false,
+										"xffNumTrustedHops":2
+									}
+								}
+							],
+							"transportSocket":{
+								"name":"envoy.transport_sockets.tls",
+								"typedConfig":{
+									"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+									"commonTlsContext":{
+										"alpnProtocols": ["h2", "http/1.1"],
+										"tlsCertificates":[
+											{
+												"certificateChain":{
+													"filename":"/etc/endpoints/ssl/server.crt"
+											  },
+					 						  "privateKey":{
+												  "filename":"/etc/endpoints/ssl/server.key"
+											  }
+										  }
+									  ]
+								  }
+							  }
+						  }
+					  }
+					]
+				}`,
+			},
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.SslServerCertPath = tc.sslServerCertPath
+		opts.UnderscoresInHeaders = true
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := MakeListeners(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listeners) != len(tc.wantListeners) {
+			t.Errorf("Test Desc(%d): %s, MakeListeners failed,\ngot: %d, \nwant: %d", i, tc.desc, len(listeners), len(tc.wantListeners))
+			continue
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		for j, wantListener := range tc.wantListeners {
+			gotListener, err := marshaler.MarshalToString(listeners[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := util.JsonEqual(wantListener, gotListener); err != nil {
+				t.Errorf("Test Desc(%d): %s, MakeListeners failed for listener(%d), \n %v ", i, tc.desc, j, err)
+			}
+		}
+	}
+}
+
+func TestMakeListenersWithSslPort(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                string
+		sslServerCertPath   string
+		sslPort             int
+		httpToHttpsRedirect bool
+		healthz             string
+		wantNames           []string
+		wantPorts           []uint32
+		wantRedirect        string
+		wantedError         string
+	}{
+		{
+			desc:              "Success, serve the same routes on both listeners",
+			sslServerCertPath: "/etc/endpoints/ssl",
+			sslPort:           8443,
+			wantNames:         []string{"http_listener", "https_listener"},
+			wantPorts:         []uint32{8080, 8443},
+		},
+		{
+			desc:                "Success, redirect plaintext requests except health checks",
+			sslServerCertPath:   "/etc/endpoints/ssl",
+			sslPort:             8443,
+			httpToHttpsRedirect: true,
+			healthz:             "healthz",
+			wantNames:           []string{"http_listener", "https_listener"},
+			wantPorts:           []uint32{8080, 8443},
+			wantRedirect: `{
+				"statPrefix":"ingress_http_redirect",
+				"routeConfig":{
+					"name":"local_redirect_route",
+					"virtualHosts":[
+						{
+							"name":"redirect",
+							"domains":["*"],
+							"routes":[
+								{
+									"match":{
+										"prefix":"/"
+									},
+									"redirect":{
+										"httpsRedirect":true,
+										"portRedirect":8443
+									}
+								}
+							]
+						}
+					]
+				},
+				"httpFilters":[
+					{
+						"name":"envoy.filters.http.health_check",
+						"typedConfig":{
+							"@type":"type.googleapis.com/envoy.config.filter.http.health_check.v2.HealthCheck",
+							"headers":[
+								{
+									"exactMatch":"/healthz",
+									"name":":path"
+								}
+							],
+							"passThroughMode":false
+						}
+					},
+					{
+						"name":"envoy.filters.http.router",
+						"typedConfig":{
+							"@type":"type.googleapis.com/envoy.config.filter.http.router.v2.Router",
+							"startChildSpan":true,
+							"suppressEnvoyHeaders":true
+						}
+					}
+				]
+			}`,
+		},
+		{
+			desc:        "Fail with an SSL port but no SSL server cert path",
+			sslPort:     8443,
+			wantedError: "SSL port 8443 requires the SSL server cert path",
+		},
+		{
+			desc:              "Fail with an SSL port same as the listener port",
+			sslServerCertPath: "/etc/endpoints/ssl",
+			sslPort:           8080,
+			wantedError:       "SSL port 8080 must be different from the listener port",
+		},
+		{
+			desc:                "Fail with redirect but no SSL port",
+			sslServerCertPath:   "/etc/endpoints/ssl",
+			httpToHttpsRedirect: true,
+			wantedError:         "HTTP to HTTPS redirect requires the SSL port",
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.SslServerCertPath = tc.sslServerCertPath
+		opts.SslPort = tc.sslPort
+		opts.HttpToHttpsRedirect = tc.httpToHttpsRedirect
+		opts.Healthz = tc.healthz
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := MakeListeners(fakeServiceInfo)
+		if tc.wantedError != "" {
+			if err == nil || err.Error() != tc.wantedError {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listeners) != len(tc.wantNames) {
+			t.Errorf("Test Desc(%d): %s, got %d listeners, want %d", i, tc.desc, len(listeners), len(tc.wantNames))
+			continue
+		}
+
+		var httpConMgrs []*hcmpb.HttpConnectionManager
+		for j, listener := range listeners {
+			if listener.GetName() != tc.wantNames[j] {
+				t.Errorf("Test Desc(%d): %s, got listener(%d) name %s, want %s", i, tc.desc, j, listener.GetName(), tc.wantNames[j])
+			}
+			if port := listener.GetAddress().GetSocketAddress().GetPortValue(); port != tc.wantPorts[j] {
+				t.Errorf("Test Desc(%d): %s, got listener(%d) port %d, want %d", i, tc.desc, j, port, tc.wantPorts[j])
+			}
+			filterChain := listener.GetFilterChains()[0]
+			if gotTls := filterChain.GetTransportSocket() != nil; gotTls != (tc.wantNames[j] == "https_listener") {
+				t.Errorf("Test Desc(%d): %s, got listener(%d) with transport socket: %v", i, tc.desc, j, gotTls)
+			}
+			httpConMgr := &hcmpb.HttpConnectionManager{}
+			if err := ptypes.UnmarshalAny(filterChain.GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+				t.Fatal(err)
+			}
+			httpConMgrs = append(httpConMgrs, httpConMgr)
+		}
+
+		if tc.wantRedirect == "" {
+			if !proto.Equal(httpConMgrs[0], httpConMgrs[1]) {
+				t.Errorf("Test Desc(%d): %s, listeners have different HTTP connection managers", i, tc.desc)
+			}
+			continue
+		}
+		gotRedirect, err := util.ProtoToJson(httpConMgrs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantRedirect, gotRedirect); err != nil {
+			t.Errorf("Test Desc(%d): %s, redirect HTTP connection manager, \n %v ", i, tc.desc, err)
+		}
+	}
+}
+
+func TestMakeListenersWithServerNames(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                string
+		serverCertsConfig   string
+		wantServerNames     [][]string
+		wantCerts           []string
+		wantListenerFilters string
+	}{
+		{
+			desc:            "Success, one filter chain without server certificates by server name",
+			wantServerNames: [][]string{nil},
+			wantCerts:       []string{"/etc/endpoints/ssl/server.crt"},
+		},
+		{
+			desc: "Success, filter chains of server names before the default one",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.example.com", "*.api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					},
+					{
+						"server_names": ["www.example.com"],
+						"cert_path": "/etc/ssl/www/server.crt",
+						"key_path": "/etc/ssl/www/server.key"
+					}
+				]
+			}`,
+			wantServerNames: [][]string{{"api.example.com", "*.api.example.com"}, {"www.example.com"}, nil},
+			wantCerts:       []string{"/etc/ssl/api/server.crt", "/etc/ssl/www/server.crt", "/etc/endpoints/ssl/server.crt"},
+			wantListenerFilters: `{
+				"listenerFilters":[
+					{
+						"name":"envoy.filters.listener.tls_inspector"
+					}
+				]
+			}`,
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.SslServerCertPath = "/etc/endpoints/ssl"
+		if tc.serverCertsConfig != "" {
+			path := writeTempConfigFile(t, tc.serverCertsConfig)
+			defer os.Remove(path)
+			opts.SslServerCertsConfigPath = path
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := MakeListeners(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filterChains := listeners[0].GetFilterChains()
+		if len(filterChains) != len(tc.wantServerNames) {
+			t.Errorf("Test Desc(%d): %s, got %d filter chains, want %d", i, tc.desc, len(filterChains), len(tc.wantServerNames))
+			continue
+		}
+
+		for j, filterChain := range filterChains {
+			if gotServerNames := filterChain.GetFilterChainMatch().GetServerNames(); !reflect.DeepEqual(gotServerNames, tc.wantServerNames[j]) {
+				t.Errorf("Test Desc(%d): %s, got filter chain(%d) server names %v, want %v", i, tc.desc, j, gotServerNames, tc.wantServerNames[j])
+			}
+			tlsContext := &authpb.DownstreamTlsContext{}
+			if err := ptypes.UnmarshalAny(filterChain.GetTransportSocket().GetTypedConfig(), tlsContext); err != nil {
+				t.Fatal(err)
+			}
+			if gotCert := tlsContext.GetCommonTlsContext().GetTlsCertificates()[0].GetCertificateChain().GetFilename(); gotCert != tc.wantCerts[j] {
+				t.Errorf("Test Desc(%d): %s, got filter chain(%d) certificate %s, want %s", i, tc.desc, j, gotCert, tc.wantCerts[j])
+			}
+		}
+
+		gotListenerFilters, err := util.ProtoToJson(&v2pb.Listener{ListenerFilters: listeners[0].GetListenerFilters()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantListenerFilters := tc.wantListenerFilters
+		if wantListenerFilters == "" {
+			wantListenerFilters = "{}"
+		}
+		if err := util.JsonEqual(wantListenerFilters, gotListenerFilters); err != nil {
+			t.Errorf("Test Desc(%d): %s, listener filters, \n %v ", i, tc.desc, err)
+		}
+	}
+}
+
+func TestMakeListenersWithProxyProtocol(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                 string
+		enableProxyProtocol  bool
+		useRemoteAddress     bool
+		sslServerCertPath    string
+		serverCertsConfig    string
+		wantListenerFilters  string
+		wantUseRemoteAddress bool
+	}{
+		{
+			desc:                "Success, no listener filters without PROXY protocol",
+			wantListenerFilters: `{}`,
+		},
+		{
+			desc:                "Success, PROXY protocol on the HTTP listener",
+			enableProxyProtocol: true,
+			wantListenerFilters: `{
+				"listenerFilters":[
+					{
+						"name":"envoy.filters.listener.proxy_protocol"
+					}
+				]
+			}`,
+		},
+		{
+			desc:                "Success, PROXY protocol with the remote address",
+			enableProxyProtocol: true,
+			useRemoteAddress:    true,
+			wantListenerFilters: `{
+				"listenerFilters":[
+					{
+						"name":"envoy.filters.listener.proxy_protocol"
+					}
+				]
+			}`,
+			wantUseRemoteAddress: true,
+		},
+		{
+			desc:                "Success, PROXY protocol before TLS Inspector on the HTTPS listener",
+			enableProxyProtocol: true,
+			sslServerCertPath:   "/etc/endpoints/ssl",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					}
+				]
+			}`,
+			wantListenerFilters: `{
+				"listenerFilters":[
+					{
+						"name":"envoy.filters.listener.proxy_protocol"
+					},
+					{
+						"name":"envoy.filters.listener.tls_inspector"
+					}
+				]
+			}`,
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.EnableProxyProtocol = tc.enableProxyProtocol
+		opts.EnvoyUseRemoteAddress = tc.useRemoteAddress
+		opts.SslServerCertPath = tc.sslServerCertPath
+		if tc.serverCertsConfig != "" {
+			path := writeTempConfigFile(t, tc.serverCertsConfig)
+			defer os.Remove(path)
+			opts.SslServerCertsConfigPath = path
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := MakeListeners(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotListenerFilters, err := util.ProtoToJson(&v2pb.Listener{ListenerFilters: listeners[0].GetListenerFilters()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantListenerFilters, gotListenerFilters); err != nil {
+			t.Errorf("Test Desc(%d): %s, listener filters, \n %v ", i, tc.desc, err)
+		}
+
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(listeners[0].GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+			t.Fatal(err)
+		}
+		if got := httpConMgr.GetUseRemoteAddress().GetValue(); got != tc.wantUseRemoteAddress {
+			t.Errorf("Test Desc(%d): %s, got use remote address %v, want %v", i, tc.desc, got, tc.wantUseRemoteAddress)
+		}
+	}
+}
+
+func TestClientCertForwarding(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: testServiceControlEnv,
+		},
+	}
+
+	testdata := []struct {
+		desc                   string
+		sslServerCertPath      string
+		sslServerRootCertsPath string
+		sslPort                int
+		httpToHttpsRedirect    bool
+		requireClientCert      bool
+		clientSans             string
+		logRequestHeaders      string
+		wantForwardDetails     hcmpb.HttpConnectionManager_ForwardClientCertDetails
+		wantLogRequestHeaders  []string
+		wantedError            string
+	}{
+		{
+			desc:                  "Success, sanitize the client cert header without client certificates",
+			sslServerCertPath:     "/etc/endpoints/ssl",
+			logRequestHeaders:     "x-custom",
+			wantForwardDetails:    hcmpb.HttpConnectionManager_SANITIZE,
+			wantLogRequestHeaders: []string{"x-custom"},
+		},
+		{
+			desc:                   "Success, forward and log the verified client certificate",
+			sslServerCertPath:      "/etc/endpoints/ssl",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			logRequestHeaders:      "x-custom",
+			wantForwardDetails:     hcmpb.HttpConnectionManager_SANITIZE_SET,
+			wantLogRequestHeaders:  []string{"x-custom", "x-forwarded-client-cert"},
+		},
+		{
+			desc:                   "Success, the client cert header is logged once",
+			sslServerCertPath:      "/etc/endpoints/ssl",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			logRequestHeaders:      "X-Forwarded-Client-Cert",
+			wantForwardDetails:     hcmpb.HttpConnectionManager_SANITIZE_SET,
+			wantLogRequestHeaders:  []string{"X-Forwarded-Client-Cert"},
+		},
+		{
+			desc:                   "Success, require client certificates with the SSL port and redirect",
+			sslServerCertPath:      "/etc/endpoints/ssl",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			sslPort:                8443,
+			httpToHttpsRedirect:    true,
+			requireClientCert:      true,
+			clientSans:             "client.example.com",
+			wantForwardDetails:     hcmpb.HttpConnectionManager_SANITIZE_SET,
+			wantLogRequestHeaders:  []string{"x-forwarded-client-cert"},
+		},
+		{
+			desc:                   "Fail to require client certificates with the SSL port but no redirect",
+			sslServerCertPath:      "/etc/endpoints/ssl",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			sslPort:                8443,
+			requireClientCert:      true,
+			wantedError:            "client certificates required on the SSL port 8443 require HTTP to HTTPS redirect",
+		},
+		{
+			desc:                   "Fail to check client SANs with the SSL port but no redirect",
+			sslServerCertPath:      "/etc/endpoints/ssl",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			sslPort:                8443,
+			clientSans:             "client.example.com",
+			wantedError:            "client certificates required on the SSL port 8443 require HTTP to HTTPS redirect",
+		},
+		{
+			desc:                   "Fail with the client root certs but no SSL server cert path",
+			sslServerRootCertsPath: "/etc/endpoints/client-ca.crt",
+			wantedError:            "SSL server root certs path requires the SSL server cert path",
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.SslServerCertPath = tc.sslServerCertPath
+		opts.SslServerRootCertsPath = tc.sslServerRootCertsPath
+		opts.SslPort = tc.sslPort
+		opts.HttpToHttpsRedirect = tc.httpToHttpsRedirect
+		opts.SslServerRequireClientCert = tc.requireClientCert
+		opts.SslServerClientSans = tc.clientSans
+		opts.LogRequestHeaders = tc.logRequestHeaders
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := MakeListeners(fakeServiceInfo)
+		if tc.wantedError != "" {
+			if err == nil || err.Error() != tc.wantedError {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The HTTPS listener is the last one.
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(listeners[len(listeners)-1].GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+			t.Fatal(err)
+		}
+		if httpConMgr.GetForwardClientCertDetails() != tc.wantForwardDetails {
+			t.Errorf("Test Desc(%d): %s, got forward client cert details %v, want %v", i, tc.desc, httpConMgr.GetForwardClientCertDetails(), tc.wantForwardDetails)
+		}
+		if gotSet := httpConMgr.GetSetCurrentClientCertDetails() != nil; gotSet != (tc.sslServerRootCertsPath != "") {
+			t.Errorf("Test Desc(%d): %s, got set current client cert details: %v", i, tc.desc, gotSet)
+		}
+
+		var gotLogRequestHeaders []string
+		for _, filter := range httpConMgr.GetHttpFilters() {
+			if filter.GetName() != util.ServiceControl {
+				continue
+			}
+			filterConfig := &scpb.FilterConfig{}
+			if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), filterConfig); err != nil {
+				t.Fatal(err)
+			}
+			gotLogRequestHeaders = filterConfig.GetServices()[0].GetLogRequestHeaders()
+		}
+		if !reflect.DeepEqual(gotLogRequestHeaders, tc.wantLogRequestHeaders) {
+			t.Errorf("Test Desc(%d): %s, got log request headers %v, want %v", i, tc.desc, gotLogRequestHeaders, tc.wantLogRequestHeaders)
+		}
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                             string
+		httpIdleTimeout                  time.Duration
+		streamIdleTimeout                time.Duration
+		requestTimeout                   time.Duration
+		maxConnectionDuration            time.Duration
+		http2MaxConcurrentStreams        int
+		http2InitialStreamWindowSize     int
+		http2InitialConnectionWindowSize int
+		wantLimits                       string
+		wantedError                      string
+	}{
+		{
+			desc: "Success, Envoy defaults without limits",
+			wantLimits: `{
+				"commonHttpProtocolOptions": {
+					"headersWithUnderscoresAction": "REJECT_REQUEST"
+				}
+			}`,
+		},
+		{
+			desc:                             "Success, all the timeouts and HTTP/2 limits",
+			httpIdleTimeout:                  10 * time.Minute,
+			streamIdleTimeout:                30 * time.Second,
+			requestTimeout:                   time.Minute,
+			maxConnectionDuration:            time.Hour,
+			http2MaxConcurrentStreams:        100,
+			http2InitialStreamWindowSize:     65536,
+			http2InitialConnectionWindowSize: 1048576,
+			wantLimits: `{
+				"commonHttpProtocolOptions": {
+					"headersWithUnderscoresAction": "REJECT_REQUEST",
+					"idleTimeout": "600s",
+					"maxConnectionDuration": "3600s"
+				},
+				"http2ProtocolOptions": {
+					"initialConnectionWindowSize": 1048576,
+					"initialStreamWindowSize": 65536,
+					"maxConcurrentStreams": 100
+				},
+				"requestTimeout": "60s",
+				"streamIdleTimeout": "30s"
+			}`,
+		},
+		{
+			desc:                      "Fail with too few concurrent streams",
+			http2MaxConcurrentStreams: -1,
+			wantedError:               "HTTP/2 max concurrent streams -1 must be between 1 and 2147483647",
+		},
+		{
+			desc:                         "Fail with a too small stream window",
+			http2InitialStreamWindowSize: 1024,
+			wantedError:                  "HTTP/2 initial stream window size 1024 must be between 65535 and 2147483647",
+		},
+		{
+			desc:                             "Fail with a too large connection window",
+			http2InitialConnectionWindowSize: 2147483648,
+			wantedError:                      "HTTP/2 initial connection window size 2147483648 must be between 65535 and 2147483647",
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.HttpIdleTimeout = tc.httpIdleTimeout
+		opts.StreamIdleTimeout = tc.streamIdleTimeout
+		opts.RequestTimeout = tc.requestTimeout
+		opts.MaxConnectionDuration = tc.maxConnectionDuration
+		opts.Http2MaxConcurrentStreams = tc.http2MaxConcurrentStreams
+		opts.Http2InitialStreamWindowSize = tc.http2InitialStreamWindowSize
+		opts.Http2InitialConnectionWindowSize = tc.http2InitialConnectionWindowSize
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		httpConMgr, err := makeHttpConnectionManager(fakeServiceInfo)
+		if tc.wantedError != "" {
+			if err == nil || err.Error() != tc.wantedError {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotLimits := &hcmpb.HttpConnectionManager{
+			CommonHttpProtocolOptions: httpConMgr.GetCommonHttpProtocolOptions(),
+			Http2ProtocolOptions:      httpConMgr.GetHttp2ProtocolOptions(),
+			StreamIdleTimeout:         httpConMgr.GetStreamIdleTimeout(),
+			RequestTimeout:            httpConMgr.GetRequestTimeout(),
+		}
+		marshaler := &jsonpb.Marshaler{}
+		gotConfig, err := marshaler.MarshalToString(gotLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantLimits, gotConfig); err != nil {
+			t.Errorf("Test Desc(%d): %s, makeHttpConnectionManager failed,\n %v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestJwtHeadersFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0/jwks",
+				},
+				{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer-1",
+					JwksUri: "https://issuer-1/jwks",
+				},
+			},
+		},
+	}
+
+	testdata := []struct {
+		desc                      string
+		jwtHeadersConfig          string
+		wantClaimHeaders          string
+		wantBase64Headers         string
+		wantForwardPayloadHeaders map[string]string
+	}{
+		{
+			desc: "Success, set claim headers, including nested and escaped claims",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": "X-User-Id"},
+					{"claim": "tenant.id", "header": "X-Tenant"},
+					{"claim": "realm_access.r\"oles", "header": "X-Roles"}
+				]
+			}`,
+			wantClaimHeaders:  `local claim_headers = {{name = "x-user-id", path = {"sub"}}, {name = "x-tenant", path = {"tenant", "id"}}, {name = "x-roles", path = {"realm_access", "r\034oles"}}}`,
+			wantBase64Headers: `local base64_payload_headers = {}`,
+			wantForwardPayloadHeaders: map[string]string{
+				"auth_provider_0": "X-Endpoint-API-UserInfo",
+				"auth_provider_1": "X-Endpoint-API-UserInfo",
+			},
+		},
+		{
+			desc: "Success, re-encode the payload header of a provider with base64 encoding",
+			jwtHeadersConfig: `{
+				"providers": [
+					{"id": "auth_provider_1", "payload_header": "X-Jwt-Payload", "payload_encoding": "base64"}
+				]
+			}`,
+			wantClaimHeaders:  `local claim_headers = {}`,
+			wantBase64Headers: `local base64_payload_headers = {"x-jwt-payload"}`,
+			wantForwardPayloadHeaders: map[string]string{
+				"auth_provider_0": "X-Endpoint-API-UserInfo",
+				"auth_provider_1": "X-Jwt-Payload",
+			},
+		},
+	}
+
+	for i, tc := range testdata {
+		path := writeTempConfigFile(t, tc.jwtHeadersConfig)
+		defer os.Remove(path)
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtHeadersConfigPath = path
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := makeJwtHeadersFilter(fakeServiceInfo)
+		if filter.GetName() != util.Lua {
+			t.Errorf("Test Desc(%d): %s, got filter %s, want %s", i, tc.desc, filter.GetName(), util.Lua)
+		}
+		lua := &luapb.Lua{}
+		if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), lua); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(lua.GetInlineCode(), "\n")
+		if lines[0] != tc.wantClaimHeaders {
+			t.Errorf("Test Desc(%d): %s, got claim headers:\n%s\nwant:\n%s", i, tc.desc, lines[0], tc.wantClaimHeaders)
+		}
+		if lines[1] != tc.wantBase64Headers {
+			t.Errorf("Test Desc(%d): %s, got base64 payload headers:\n%s\nwant:\n%s", i, tc.desc, lines[1], tc.wantBase64Headers)
+		}
+
+		jwtAuthn := &jwtpb.JwtAuthentication{}
+		if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+			t.Fatal(err)
+		}
+		for id, want := range tc.wantForwardPayloadHeaders {
+			if got := jwtAuthn.GetProviders()[id].GetForwardPayloadHeader(); got != want {
+				t.Errorf("Test Desc(%d): %s, got forward payload header %s of provider %s, want %s", i, tc.desc, got, id, want)
+			}
+		}
+	}
+}
+
+func TestJwtCookiesFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0/jwks",
+					JwtLocations: []*confpb.JwtLocation{
+						{
+							In: &confpb.JwtLocation_Header{
+								Header: "X-Token",
+							},
+						},
+					},
+				},
+				{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer-1",
+					JwksUri: "https://issuer-1/jwks",
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.JwtCookies = "auth_provider_0=Session,auth_provider_1=Session,auth_provider_1=id_token"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := makeJwtCookiesFilter(fakeServiceInfo)
+	lua := &luapb.Lua{}
+	if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), lua); err != nil {
+		t.Fatal(err)
+	}
+	wantJwtCookies := `local jwt_cookies = {{cookie = "Session", header = "x-endpoint-jwt-cookie-session"}, {cookie = "id_token", header = "x-endpoint-jwt-cookie-id_token"}}`
+	if got := strings.Split(lua.GetInlineCode(), "\n")[0]; got != wantJwtCookies {
+		t.Errorf("got JWT cookies:\n%s\nwant:\n%s", got, wantJwtCookies)
+	}
+
+	// The headers of the cookies are after the JWT locations of the providers,
+	// or the default ones.
+	wantFromHeaders := map[string][]string{
+		"auth_provider_0": {"X-Token", "x-endpoint-jwt-cookie-session"},
+		"auth_provider_1": {"Authorization", "X-Goog-Iap-Jwt-Assertion", "x-endpoint-jwt-cookie-session", "x-endpoint-jwt-cookie-id_token"},
+	}
+	jwtAuthn := &jwtpb.JwtAuthentication{}
+	if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range wantFromHeaders {
+		var got []string
+		for _, header := range jwtAuthn.GetProviders()[id].GetFromHeaders() {
+			got = append(got, header.GetName())
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got JWT headers %v of provider %s, want %v", got, id, want)
+		}
+	}
+}
+
+func TestMakeAccessLog(t *testing.T) {
+	testdata := []struct {
+		desc            string
+		accessLogFormat string
+		wantAccessLog   string
+		wantedErrorMsg  string
+	}{
+		{
+			desc:            "Success, generate JSON access log",
+			accessLogFormat: "json",
+			wantAccessLog: `{
+				"name": "envoy.access_loggers.file",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.accesslog.v2.FileAccessLog",
+					"path": "/dev/stdout",
+					"typedJsonFormat": {
+						"api_key_present": "%DYNAMIC_METADATA(envoy.filters.http.lua:api_key_present)%",
+						"bytes_received": "%BYTES_RECEIVED%",
+						"bytes_sent": "%BYTES_SENT%",
+						"client_address": "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%",
+						"duration_ms": "%DURATION%",
+						"jwt_subject": "%DYNAMIC_METADATA(envoy.filters.http.jwt_authn:jwt_payloads:sub)%",
+						"method": "%REQ(:METHOD)%",
+						"operation": "%FILTER_STATE(envoy.filters.http.path_matcher.operation)%",
+						"path": "%DYNAMIC_METADATA(envoy.filters.http.lua:path)%",
+						"protocol": "%PROTOCOL%",
+						"request_id": "%REQ(X-REQUEST-ID)%",
+						"response_code": "%RESPONSE_CODE%",
+						"response_flags": "%RESPONSE_FLAGS%",
+						"start_time": "%START_TIME%",
+						"upstream_cluster": "%UPSTREAM_CLUSTER%",
+						"upstream_host": "%UPSTREAM_HOST%",
+						"user_agent": "%REQ(USER-AGENT)%"
+					}
+				}
+			}`,
+		},
+		{
+			desc:            "Success, generate text access log",
+			accessLogFormat: "text",
+			wantAccessLog: `{
+				"name": "envoy.access_loggers.file",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.accesslog.v2.FileAccessLog",
+					"path": "/dev/stdout",
+					"format": "start_time=%START_TIME% method=%REQ(:METHOD)% path=\"%DYNAMIC_METADATA(envoy.filters.http.lua:path)%\" protocol=%PROTOCOL% response_code=%RESPONSE_CODE% response_flags=%RESPONSE_FLAGS% bytes_received=%BYTES_RECEIVED% bytes_sent=%BYTES_SENT% duration_ms=%DURATION% upstream_cluster=%UPSTREAM_CLUSTER% upstream_host=%UPSTREAM_HOST% client_address=%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT% user_agent=\"%REQ(USER-AGENT)%\" request_id=%REQ(X-REQUEST-ID)% operation=%FILTER_STATE(envoy.filters.http.path_matcher.operation)% jwt_subject=%DYNAMIC_METADATA(envoy.filters.http.jwt_authn:jwt_payloads:sub)% api_key_present=%DYNAMIC_METADATA(envoy.filters.http.lua:api_key_present)%\n"
+				}
+			}`,
+		},
+		{
+			desc:            "Fail with an invalid format",
+			accessLogFormat: "csv",
+			wantedErrorMsg:  `invalid access log format "csv", must be "json" or "text"`,
+		},
+	}
+
+	for i, tc := range testdata {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.AccessLogPath = "/dev/stdout"
+		opts.AccessLogFormat = tc.accessLogFormat
+		accessLog, err := makeAccessLog(opts)
+		if tc.wantedErrorMsg != "" {
+			if err == nil || err.Error() != tc.wantedErrorMsg {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		gotAccessLog, err := marshaler.MarshalToString(accessLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantAccessLog, gotAccessLog); err != nil {
+			t.Errorf("Test Desc(%d): %s, makeAccessLog failed,\n%v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestAccessLogFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		SystemParameters: &confpb.SystemParameters{
+			Rules: []*confpb.SystemParameterRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Parameters: []*confpb.SystemParameter{
+						{
+							Name:              "api_key",
+							HttpHeader:        "X-Custom-Key",
+							UrlQueryParameter: "key",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.AccessLogPath = "/dev/stdout"
+	opts.ApiKeyCookies = "api-key"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := makeAccessLogFilter(fakeServiceInfo)
+	lua := &luapb.Lua{}
+	if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), lua); err != nil {
+		t.Fatal(err)
+	}
+	// The API key locations of all the methods.
+	wantApiKeyLocations := []string{
+		`local api_key_queries = {"key", "api_key"}`,
+		`local api_key_headers = {"x-custom-key", "x-api-key"}`,
+		`local api_key_cookies = {"api-key"}`,
+	}
+	gotApiKeyLocations := strings.Split(lua.GetInlineCode(), "\n")[:3]
+	if strings.Join(gotApiKeyLocations, "\n") != strings.Join(wantApiKeyLocations, "\n") {
+		t.Errorf("got API key locations:\n%s\nwant:\n%s", strings.Join(gotApiKeyLocations, "\n"), strings.Join(wantApiKeyLocations, "\n"))
 	}
 }
@@ -17,18 +17,27 @@ package configgenerator
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/common"
 	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	faultcommonpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/fault/v2"
+	bufpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	eapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	faultpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/fault/v2"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
@@ -52,6 +61,14 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 	host.Routes = brRoutes
 
 	if len(host.Routes) == 0 {
+		// Per-selector routes to the local backend for methods with route-level
+		// settings. They must be ahead of the catch-all route.
+		localRoutes, err := makeLocalBackendRoutes(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		host.Routes = append(host.Routes, localRoutes...)
+
 		// Catch-all route if dynamic routing is not enabled.
 		catchAllRt := &routepb.Route{
 			Match: &routepb.RouteMatch{
@@ -67,7 +84,8 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 					// Use the default deadline for the catch-all route.
 					// If a customer needs to override this, dynamic routing must be used.
 					// This is the intended design of the feature (b/147813008).
-					Timeout: ptypes.DurationProto(util.DefaultResponseDeadline),
+					Timeout:               ptypes.DurationProto(util.DefaultResponseDeadline),
+					RequestMirrorPolicies: makeRequestMirrorPolicies(serviceInfo.MirrorTargets),
 				},
 			},
 		}
@@ -82,50 +100,57 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 			}
 		}
 
-		host.Routes = append(host.Routes, catchAllRt)
+		host.Routes = append(host.Routes, makeCanaryRoutes(serviceInfo, []*routepb.Route{catchAllRt}, serviceInfo.Canary)...)
 
 		jsonStr, _ := util.ProtoToJson(catchAllRt)
 		glog.Infof("adding catch-all routing configuration: %v", jsonStr)
 	}
 
+	if serviceInfo.HeaderRules != nil {
+		host.RequestHeadersToAdd, host.RequestHeadersToRemove, host.ResponseHeadersToAdd, host.ResponseHeadersToRemove = makeHeaderMutations(serviceInfo.HeaderRules)
+	}
+
+	// Without a global request body limit, only the routes with their own limit
+	// are buffered.
+	if hasRequestBodyLimits(serviceInfo) && serviceInfo.Options.MaxRequestBodyBytes == 0 {
+		bufferDisabled, err := ptypes.MarshalAny(&bufpb.BufferPerRoute{
+			Override: &bufpb.BufferPerRoute_Disabled{
+				Disabled: true,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		host.TypedPerFilterConfig = map[string]*anypb.Any{
+			util.Buffer: bufferDisabled,
+		}
+	}
+
 	switch serviceInfo.Options.CorsPreset {
 	case "basic":
 		org := serviceInfo.Options.CorsAllowOrigin
 		if org == "" {
 			return nil, fmt.Errorf("cors_allow_origin cannot be empty when cors_preset=basic")
 		}
-		host.Cors = &routepb.CorsPolicy{
-			AllowOriginStringMatch: []*matcher.StringMatcher{
-				{
-					MatchPattern: &matcher.StringMatcher_Exact{
-						Exact: org,
-					},
-				},
-			},
-		}
+		host.Cors = makeCorsPolicy(&configinfo.CorsPolicy{
+			AllowOrigin:      org,
+			AllowMethods:     serviceInfo.Options.CorsAllowMethods,
+			AllowHeaders:     serviceInfo.Options.CorsAllowHeaders,
+			ExposeHeaders:    serviceInfo.Options.CorsExposeHeaders,
+			AllowCredentials: serviceInfo.Options.CorsAllowCredentials,
+		})
 	case "cors_with_regex":
 		orgReg := serviceInfo.Options.CorsAllowOriginRegex
 		if orgReg == "" {
 			return nil, fmt.Errorf("cors_allow_origin_regex cannot be empty when cors_preset=cors_with_regex")
 		}
-		host.Cors = &routepb.CorsPolicy{
-			AllowOriginStringMatch: []*matcher.StringMatcher{
-				{
-					MatchPattern: &matcher.StringMatcher_SafeRegex{
-						SafeRegex: &matcher.RegexMatcher{
-							EngineType: &matcher.RegexMatcher_GoogleRe2{
-								GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
-									MaxProgramSize: &wrapperspb.UInt32Value{
-										Value: util.GoogleRE2MaxProgramSize,
-									},
-								},
-							},
-							Regex: orgReg,
-						},
-					},
-				},
-			},
-		}
+		host.Cors = makeCorsPolicy(&configinfo.CorsPolicy{
+			AllowOriginRegex: orgReg,
+			AllowMethods:     serviceInfo.Options.CorsAllowMethods,
+			AllowHeaders:     serviceInfo.Options.CorsAllowHeaders,
+			ExposeHeaders:    serviceInfo.Options.CorsExposeHeaders,
+			AllowCredentials: serviceInfo.Options.CorsAllowCredentials,
+		})
 	case "":
 		if serviceInfo.Options.CorsAllowMethods != "" || serviceInfo.Options.CorsAllowHeaders != "" ||
 			serviceInfo.Options.CorsExposeHeaders != "" || serviceInfo.Options.CorsAllowCredentials {
@@ -136,11 +161,6 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 	}
 
 	if host.GetCors() != nil {
-		host.GetCors().AllowMethods = serviceInfo.Options.CorsAllowMethods
-		host.GetCors().AllowHeaders = serviceInfo.Options.CorsAllowHeaders
-		host.GetCors().ExposeHeaders = serviceInfo.Options.CorsExposeHeaders
-		host.GetCors().AllowCredentials = &wrapperspb.BoolValue{Value: serviceInfo.Options.CorsAllowCredentials}
-
 		// In order apply Envoy cors policy, need to have a route rule
 		// to route OPTIONS request to this host
 		corsRoute := &routepb.Route{
@@ -175,6 +195,8 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 	return &v2pb.RouteConfiguration{
 		Name:         routeName,
 		VirtualHosts: virtualHosts,
+		// Header rules of routes win over the global ones.
+		MostSpecificHeaderMutationsWins: hasHeaderRules(serviceInfo),
 	}, nil
 }
 
@@ -182,7 +204,6 @@ func makeDynamicRoutingConfig(serviceInfo *configinfo.ServiceInfo) ([]*routepb.R
 	var backendRoutes []*routepb.Route
 	for _, operation := range serviceInfo.Operations {
 		method := serviceInfo.Methods[operation]
-		var routeMatcher *routepb.RouteMatch
 		if method.BackendInfo == nil {
 			continue
 		}
@@ -197,42 +218,554 @@ func makeDynamicRoutingConfig(serviceInfo *configinfo.ServiceInfo) ([]*routepb.R
 			respTimeout = method.BackendInfo.Deadline
 		}
 
-		for _, httpRule := range method.HttpRule {
-			if routeMatcher = makeHttpRouteMatcher(httpRule); routeMatcher == nil {
-				return nil, fmt.Errorf("error making HTTP route matcher for selector: %v", operation)
+		routes, err := makeMethodRoutes(serviceInfo, operation, &routepb.RouteAction{
+			ClusterSpecifier: &routepb.RouteAction_Cluster{
+				Cluster: method.BackendInfo.ClusterName,
+			},
+			HostRewriteSpecifier: &routepb.RouteAction_HostRewrite{
+				HostRewrite: method.BackendInfo.Hostname,
+			},
+			Timeout: ptypes.DurationProto(respTimeout),
+		})
+		if err != nil {
+			return nil, err
+		}
+		routes = makeCanaryRoutes(serviceInfo, routes, methodCanary(serviceInfo, operation))
+
+		for _, r := range routes {
+			jsonStr, _ := util.ProtoToJson(r)
+			glog.Infof("adding Dynamic Routing configuration: %v", jsonStr)
+		}
+		backendRoutes = append(backendRoutes, routes...)
+	}
+	return backendRoutes, nil
+}
+
+// makeLocalBackendRoutes makes the routes to the backends of the API versions,
+// and the routes to the local backend for methods whose settings can only be
+// applied on their own routes. All the other methods are served by the
+// catch-all route.
+func makeLocalBackendRoutes(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, error) {
+	var localRoutes []*routepb.Route
+	for _, operation := range serviceInfo.Operations {
+		method := serviceInfo.Methods[operation]
+		if method.ApiVersionClusterName != "" {
+			routes, err := makeApiVersionRoutes(serviceInfo, operation)
+			if err != nil {
+				return nil, err
+			}
+			localRoutes = append(localRoutes, routes...)
+
+			// Without a header, all the requests to the method go to the
+			// backend of its version.
+			if serviceInfo.ApiVersionHeader == "" {
+				continue
 			}
+		}
+		if !hasMethodRouteSettings(serviceInfo, operation) {
+			continue
+		}
 
-			r := routepb.Route{
-				Match: routeMatcher,
-				Action: &routepb.Route_Route{
-					Route: &routepb.RouteAction{
-						ClusterSpecifier: &routepb.RouteAction_Cluster{
-							Cluster: method.BackendInfo.ClusterName,
+		respTimeout := util.DefaultResponseDeadline
+		if method.IsStreaming {
+			respTimeout = 0 * time.Second
+		}
+
+		routes, err := makeMethodRoutes(serviceInfo, operation, &routepb.RouteAction{
+			ClusterSpecifier: &routepb.RouteAction_Cluster{
+				Cluster: serviceInfo.BackendClusterName(),
+			},
+			Timeout: ptypes.DurationProto(respTimeout),
+		})
+		if err != nil {
+			return nil, err
+		}
+		routes = makeCanaryRoutes(serviceInfo, routes, methodCanary(serviceInfo, operation))
+
+		for _, r := range routes {
+			jsonStr, _ := util.ProtoToJson(r)
+			glog.Infof("adding local backend routing configuration: %v", jsonStr)
+		}
+		localRoutes = append(localRoutes, routes...)
+	}
+	return localRoutes, nil
+}
+
+// makeApiVersionRoutes makes the routes of the method to the backend of its API
+// version, only matching the requests with the version header if one is set.
+// The canary of the local backend is not applied, since the requests do not go
+// to the local backend.
+func makeApiVersionRoutes(serviceInfo *configinfo.ServiceInfo, operation string) ([]*routepb.Route, error) {
+	method := serviceInfo.Methods[operation]
+
+	respTimeout := util.DefaultResponseDeadline
+	if method.IsStreaming {
+		respTimeout = 0 * time.Second
+	}
+
+	routes, err := makeMethodRoutes(serviceInfo, operation, &routepb.RouteAction{
+		ClusterSpecifier: &routepb.RouteAction_Cluster{
+			Cluster: method.ApiVersionClusterName,
+		},
+		Timeout: ptypes.DurationProto(respTimeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range routes {
+		if serviceInfo.ApiVersionHeader != "" {
+			r.Match.Headers = append(r.Match.Headers, &routepb.HeaderMatcher{
+				Name: serviceInfo.ApiVersionHeader,
+				HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+					ExactMatch: method.ApiVersion,
+				},
+			})
+		}
+
+		jsonStr, _ := util.ProtoToJson(r)
+		glog.Infof("adding API version routing configuration: %v", jsonStr)
+	}
+	return routes, nil
+}
+
+// hasMethodRouteSettings returns whether the method has settings that can only
+// be applied on its own routes.
+func hasMethodRouteSettings(serviceInfo *configinfo.ServiceInfo, operation string) bool {
+	method := serviceInfo.Methods[operation]
+	return method.CorsPolicy != nil || len(method.RateLimits) > 0 || makeBufferPerRoute(serviceInfo, operation) != nil ||
+		(serviceInfo.Options.EnableResponseCompression && method.IsStreaming) || method.HeaderRules != nil ||
+		(serviceInfo.Options.StreamingMethodIdleTimeout > 0 && method.IsStreaming) ||
+		method.Canary != nil || method.MirrorTargets != nil || method.Fault != nil ||
+		(serviceInfo.ExtAuthz != nil && method.ExtAuthzDisabled)
+}
+
+// makeMethodRoutes makes one route with the given action for each HttpRule
+// of the method, and applies the route-level settings of the method. The
+// canary of the method is applied by the callers.
+func makeMethodRoutes(serviceInfo *configinfo.ServiceInfo, operation string, action *routepb.RouteAction) ([]*routepb.Route, error) {
+	method := serviceInfo.Methods[operation]
+
+	rateLimits := makeRateLimits(serviceInfo, operation)
+	bufferPerRoute := makeBufferPerRoute(serviceInfo, operation)
+	mirrorTargets := serviceInfo.MirrorTargets
+	if method.MirrorTargets != nil {
+		mirrorTargets = method.MirrorTargets
+	}
+	requestMirrorPolicies := makeRequestMirrorPolicies(mirrorTargets)
+
+	var routes []*routepb.Route
+	for _, httpRule := range method.HttpRule {
+		routeMatcher := makeHttpRouteMatcher(httpRule)
+		if routeMatcher == nil {
+			return nil, fmt.Errorf("error making HTTP route matcher for selector: %v", operation)
+		}
+
+		routeAction := proto.Clone(action).(*routepb.RouteAction)
+		if method.CorsPolicy != nil {
+			routeAction.Cors = makeCorsPolicy(method.CorsPolicy)
+		}
+		routeAction.RateLimits = rateLimits
+		routeAction.RequestMirrorPolicies = requestMirrorPolicies
+		if serviceInfo.Options.StreamingMethodIdleTimeout > 0 && method.IsStreaming {
+			routeAction.IdleTimeout = ptypes.DurationProto(serviceInfo.Options.StreamingMethodIdleTimeout)
+		}
+
+		r := &routepb.Route{
+			Match: routeMatcher,
+			Action: &routepb.Route_Route{
+				Route: routeAction,
+			},
+		}
+		if serviceInfo.Options.EnableHSTS {
+			r.ResponseHeadersToAdd = []*corepb.HeaderValueOption{
+				{
+					Header: &corepb.HeaderValue{
+						Key:   util.HSTSHeaderKey,
+						Value: util.HSTSHeaderValue,
+					},
+				},
+			}
+		}
+		if serviceInfo.Options.EnableResponseCompression && method.IsStreaming {
+			// Gzip filter holds back streamed messages until enough data is
+			// compressed. The Lua filters around it turn it off for the routes
+			// with this metadata.
+			r.Metadata = &corepb.Metadata{
+				FilterMetadata: map[string]*structpb.Struct{
+					util.Lua: {
+						Fields: map[string]*structpb.Value{
+							disableResponseCompressionKey: {
+								Kind: &structpb.Value_BoolValue{BoolValue: true},
+							},
 						},
-						HostRewriteSpecifier: &routepb.RouteAction_HostRewrite{
-							HostRewrite: method.BackendInfo.Hostname,
+					},
+				},
+			}
+		}
+		if method.HeaderRules != nil {
+			var responseHeadersToAdd []*corepb.HeaderValueOption
+			r.RequestHeadersToAdd, r.RequestHeadersToRemove, responseHeadersToAdd, r.ResponseHeadersToRemove = makeHeaderMutations(method.HeaderRules)
+			r.ResponseHeadersToAdd = append(r.ResponseHeadersToAdd, responseHeadersToAdd...)
+		}
+		if bufferPerRoute != nil {
+			bufferPerRouteAny, err := ptypes.MarshalAny(bufferPerRoute)
+			if err != nil {
+				return nil, err
+			}
+			r.TypedPerFilterConfig = map[string]*anypb.Any{
+				util.Buffer: bufferPerRouteAny,
+			}
+		}
+		if method.Fault != nil {
+			faultAny, err := ptypes.MarshalAny(makeHTTPFault(method.Fault))
+			if err != nil {
+				return nil, err
+			}
+			if r.TypedPerFilterConfig == nil {
+				r.TypedPerFilterConfig = make(map[string]*anypb.Any)
+			}
+			r.TypedPerFilterConfig[util.Fault] = faultAny
+		}
+		if serviceInfo.ExtAuthz != nil && method.ExtAuthzDisabled {
+			extAuthzPerRouteAny, err := ptypes.MarshalAny(&eapb.ExtAuthzPerRoute{
+				Override: &eapb.ExtAuthzPerRoute_Disabled{
+					Disabled: true,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if r.TypedPerFilterConfig == nil {
+				r.TypedPerFilterConfig = make(map[string]*anypb.Any)
+			}
+			r.TypedPerFilterConfig[util.ExtAuthz] = extAuthzPerRouteAny
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// makeRequestMirrorPolicies makes the policies copying requests to the mirror
+// targets. Envoy sends the copies from the router filter, after all the other
+// filters, so they are not reported to Service Control nor counted against
+// rate limits.
+func makeRequestMirrorPolicies(targets []*configinfo.MirrorTarget) []*routepb.RouteAction_RequestMirrorPolicy {
+	var policies []*routepb.RouteAction_RequestMirrorPolicy
+	for _, target := range targets {
+		policies = append(policies, &routepb.RouteAction_RequestMirrorPolicy{
+			Cluster: target.ClusterName,
+			RuntimeFraction: &corepb.RuntimeFractionalPercent{
+				DefaultValue: &typepb.FractionalPercent{
+					Numerator:   target.Percentage,
+					Denominator: typepb.FractionalPercent_HUNDRED,
+				},
+			},
+		})
+	}
+	return policies
+}
+
+// makeHTTPFault makes the per-route config of the Fault filter. Envoy only
+// injects the fault into the requests matching all the headers.
+func makeHTTPFault(fault *configinfo.Fault) *faultpb.HTTPFault {
+	httpFault := &faultpb.HTTPFault{}
+	if fault.Delay > 0 {
+		httpFault.Delay = &faultcommonpb.FaultDelay{
+			FaultDelaySecifier: &faultcommonpb.FaultDelay_FixedDelay{
+				FixedDelay: ptypes.DurationProto(fault.Delay),
+			},
+			Percentage: &typepb.FractionalPercent{
+				Numerator:   fault.DelayPercentage,
+				Denominator: typepb.FractionalPercent_HUNDRED,
+			},
+		}
+	}
+	if fault.AbortHttpStatus != 0 {
+		httpFault.Abort = &faultpb.FaultAbort{
+			ErrorType: &faultpb.FaultAbort_HttpStatus{
+				HttpStatus: fault.AbortHttpStatus,
+			},
+			Percentage: &typepb.FractionalPercent{
+				Numerator:   fault.AbortPercentage,
+				Denominator: typepb.FractionalPercent_HUNDRED,
+			},
+		}
+	}
+	for _, header := range fault.Headers {
+		httpFault.Headers = append(httpFault.Headers, &routepb.HeaderMatcher{
+			Name: header.Key,
+			HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+				ExactMatch: header.Value,
+			},
+		})
+	}
+	return httpFault
+}
+
+func methodCanary(serviceInfo *configinfo.ServiceInfo, operation string) *configinfo.Canary {
+	if canary := serviceInfo.Methods[operation].Canary; canary != nil {
+		return canary
+	}
+	return serviceInfo.Canary
+}
+
+// makeCanaryRoutes sends the weight of the canary as a percentage of the
+// requests of the routes to the canary cluster. If there is an override
+// header, each route gets a copy ahead of it sending all the requests with the
+// header to the canary cluster.
+func makeCanaryRoutes(serviceInfo *configinfo.ServiceInfo, routes []*routepb.Route, canary *configinfo.Canary) []*routepb.Route {
+	if canary == nil {
+		return routes
+	}
+
+	var canaryRoutes []*routepb.Route
+	for _, r := range routes {
+		if header := serviceInfo.CanaryOverrideHeader; header != nil {
+			overrideRoute := proto.Clone(r).(*routepb.Route)
+			overrideRoute.Match.Headers = append(overrideRoute.Match.Headers, &routepb.HeaderMatcher{
+				Name: header.Key,
+				HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+					ExactMatch: header.Value,
+				},
+			})
+			overrideAction := overrideRoute.GetRoute()
+			overrideAction.ClusterSpecifier = &routepb.RouteAction_Cluster{
+				Cluster: canary.ClusterName,
+			}
+			useAutoHostRewrite(overrideAction)
+			canaryRoutes = append(canaryRoutes, overrideRoute)
+		}
+
+		if canary.Weight > 0 {
+			action := r.GetRoute()
+			action.ClusterSpecifier = &routepb.RouteAction_WeightedClusters{
+				WeightedClusters: &routepb.WeightedCluster{
+					Clusters: []*routepb.WeightedCluster_ClusterWeight{
+						{
+							Name: action.GetCluster(),
+							Weight: &wrapperspb.UInt32Value{
+								Value: 100 - canary.Weight,
+							},
+						},
+						{
+							Name: canary.ClusterName,
+							Weight: &wrapperspb.UInt32Value{
+								Value: canary.Weight,
+							},
 						},
-						Timeout: ptypes.DurationProto(respTimeout),
 					},
 				},
 			}
-			if serviceInfo.Options.EnableHSTS {
-				r.ResponseHeadersToAdd = []*corepb.HeaderValueOption{
-					{
-						Header: &corepb.HeaderValue{
-							Key:   util.HSTSHeaderKey,
-							Value: util.HSTSHeaderValue,
+			useAutoHostRewrite(action)
+		}
+		canaryRoutes = append(canaryRoutes, r)
+	}
+	return canaryRoutes
+}
+
+// useAutoHostRewrite replaces the host rewrite to the hostname of the backend
+// of a dynamic routing route, as the canary backend has its own hostname. The
+// host is rewritten to the hostname of the cluster the request is sent to.
+func useAutoHostRewrite(action *routepb.RouteAction) {
+	if action.GetHostRewrite() == "" {
+		return
+	}
+	action.HostRewriteSpecifier = &routepb.RouteAction_AutoHostRewrite{
+		AutoHostRewrite: &wrapperspb.BoolValue{
+			Value: true,
+		},
+	}
+}
+
+func makeCorsPolicy(policy *configinfo.CorsPolicy) *routepb.CorsPolicy {
+	corsPolicy := &routepb.CorsPolicy{
+		AllowMethods:     policy.AllowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    policy.ExposeHeaders,
+		AllowCredentials: &wrapperspb.BoolValue{Value: policy.AllowCredentials},
+	}
+
+	if policy.AllowOrigin != "" {
+		corsPolicy.AllowOriginStringMatch = []*matcher.StringMatcher{
+			{
+				MatchPattern: &matcher.StringMatcher_Exact{
+					Exact: policy.AllowOrigin,
+				},
+			},
+		}
+	} else {
+		corsPolicy.AllowOriginStringMatch = []*matcher.StringMatcher{
+			{
+				MatchPattern: &matcher.StringMatcher_SafeRegex{
+					SafeRegex: &matcher.RegexMatcher{
+						EngineType: &matcher.RegexMatcher_GoogleRe2{
+							GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
+								MaxProgramSize: &wrapperspb.UInt32Value{
+									Value: util.GoogleRE2MaxProgramSize,
+								},
+							},
 						},
+						Regex: policy.AllowOriginRegex,
+					},
+				},
+			},
+		}
+	}
+	return corsPolicy
+}
+
+func hasHeaderRules(serviceInfo *configinfo.ServiceInfo) bool {
+	if serviceInfo.HeaderRules != nil {
+		return true
+	}
+	for _, method := range serviceInfo.Methods {
+		if method.HeaderRules != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// makeHeaderMutations returns the request headers to add and remove and the
+// response headers to add and remove for the header rules.
+func makeHeaderMutations(rules *configinfo.HeaderRules) ([]*corepb.HeaderValueOption, []string, []*corepb.HeaderValueOption, []string) {
+	var requestHeadersToAdd, responseHeadersToAdd []*corepb.HeaderValueOption
+	requestHeadersToAdd = append(requestHeadersToAdd, makeHeaderValueOptions(rules.RequestHeadersToAdd, true)...)
+	requestHeadersToAdd = append(requestHeadersToAdd, makeHeaderValueOptions(rules.RequestHeadersToSet, false)...)
+	responseHeadersToAdd = append(responseHeadersToAdd, makeHeaderValueOptions(rules.ResponseHeadersToAdd, true)...)
+	responseHeadersToAdd = append(responseHeadersToAdd, makeHeaderValueOptions(rules.ResponseHeadersToSet, false)...)
+	return requestHeadersToAdd, rules.RequestHeadersToRemove, responseHeadersToAdd, rules.ResponseHeadersToRemove
+}
+
+func makeHeaderValueOptions(headers []*configinfo.HeaderValue, appendValue bool) []*corepb.HeaderValueOption {
+	var options []*corepb.HeaderValueOption
+	for _, header := range headers {
+		options = append(options, &corepb.HeaderValueOption{
+			Header: &corepb.HeaderValue{
+				Key:   header.Key,
+				Value: header.Value,
+			},
+			Append: &wrapperspb.BoolValue{
+				Value: appendValue,
+			},
+		})
+	}
+	return options
+}
+
+// makeBufferPerRoute returns the Buffer filter config of the routes of the
+// method if it differs from the global one. Streaming methods are never
+// buffered.
+func makeBufferPerRoute(serviceInfo *configinfo.ServiceInfo, operation string) *bufpb.BufferPerRoute {
+	if !hasRequestBodyLimits(serviceInfo) {
+		return nil
+	}
+
+	method := serviceInfo.Methods[operation]
+	switch {
+	case method.IsStreaming:
+		return &bufpb.BufferPerRoute{
+			Override: &bufpb.BufferPerRoute_Disabled{
+				Disabled: true,
+			},
+		}
+	case method.MaxRequestBodyBytes > 0:
+		return &bufpb.BufferPerRoute{
+			Override: &bufpb.BufferPerRoute_Buffer{
+				Buffer: &bufpb.Buffer{
+					MaxRequestBytes: &wrapperspb.UInt32Value{
+						Value: method.MaxRequestBodyBytes,
 					},
+				},
+			},
+		}
+	}
+	return nil
+}
+
+// makeRateLimits makes the rate limit descriptors sent to the rate limit
+// server for the requests to the method. The first descriptor only has the
+// operation. Each value needed to group the requests by the keys of the
+// method's limits has its own descriptor, so a request header descriptor is
+// only sent when the header is present.
+func makeRateLimits(serviceInfo *configinfo.ServiceInfo, operation string) []*routepb.RateLimit {
+	method := serviceInfo.Methods[operation]
+	if len(method.RateLimits) == 0 {
+		return nil
+	}
+
+	operationAction := &routepb.RateLimit_Action{
+		ActionSpecifier: &routepb.RateLimit_Action_GenericKey_{
+			GenericKey: &routepb.RateLimit_Action_GenericKey{
+				DescriptorValue: operation,
+			},
+		},
+	}
+	rateLimits := []*routepb.RateLimit{
+		{
+			Actions: []*routepb.RateLimit_Action{
+				operationAction,
+			},
+		},
+	}
+
+	seen := make(map[string]bool)
+	addAction := func(descriptorKey string, action *routepb.RateLimit_Action) {
+		if seen[descriptorKey] {
+			return
+		}
+		seen[descriptorKey] = true
+		rateLimits = append(rateLimits, &routepb.RateLimit{
+			Actions: []*routepb.RateLimit_Action{
+				operationAction,
+				action,
+			},
+		})
+	}
+	addHeader := func(header string) {
+		header = strings.ToLower(header)
+		descriptorKey := util.RateLimitRequestHeaderPrefix + header
+		addAction(descriptorKey, makeRequestHeaderAction(header, descriptorKey))
+	}
+
+	for _, limit := range method.RateLimits {
+		switch limit.Key {
+		case configinfo.RateLimitKeyApiKey:
+			for _, location := range serviceInfo.RateLimitApiKeyLocations(operation) {
+				if location.GetQuery() != "" {
+					addAction(util.RateLimitPathKey, makeRequestHeaderAction(":path", util.RateLimitPathKey))
+				} else if header := location.GetHeader(); header != "" {
+					addHeader(header)
+				} else if location.GetCookie() != "" {
+					addHeader("cookie")
 				}
 			}
-			backendRoutes = append(backendRoutes, &r)
-
-			jsonStr, _ := util.ProtoToJson(&r)
-			glog.Infof("adding Dynamic Routing configuration: %v", jsonStr)
+		case configinfo.RateLimitKeyJwtSubject:
+			// Providers may forward their payloads in different headers.
+			for _, header := range serviceInfo.RateLimitJwtPayloadHeaders(operation) {
+				addHeader(header.Name)
+			}
+		case configinfo.RateLimitKeyClientIP:
+			addAction(util.RateLimitRemoteAddressKey, &routepb.RateLimit_Action{
+				ActionSpecifier: &routepb.RateLimit_Action_RemoteAddress_{
+					RemoteAddress: &routepb.RateLimit_Action_RemoteAddress{},
+				},
+			})
 		}
 	}
-	return backendRoutes, nil
+	return rateLimits
+}
+
+func makeRequestHeaderAction(header, descriptorKey string) *routepb.RateLimit_Action {
+	return &routepb.RateLimit_Action{
+		ActionSpecifier: &routepb.RateLimit_Action_RequestHeaders_{
+			RequestHeaders: &routepb.RateLimit_Action_RequestHeaders{
+				HeaderName:    header,
+				DescriptorKey: descriptorKey,
+			},
+		},
+	}
 }
 
 func makeHttpRouteMatcher(httpRule *commonpb.Pattern) *routepb.RouteMatch {
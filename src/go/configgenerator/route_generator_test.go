@@ -15,8 +15,11 @@
 package configgenerator
 
 import (
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
@@ -312,3 +315,1619 @@ func TestMakeRouteConfigForCors(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeRouteConfigForMethodCors(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves/{shelf}",
+					},
+				},
+			},
+		},
+	}
+	corsConfig := `{
+		"policies": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+				"allow_origin": "https://public.example.com",
+				"allow_headers": "Authorization"
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "OPTIONS",
+									"name": ":method"
+								}
+							],
+							"path": "/shelves"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"cors": {
+								"allowCredentials": false,
+								"allowHeaders": "Authorization",
+								"allowOriginStringMatch": [
+									{
+										"exact": "https://public.example.com"
+									}
+								]
+							},
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "GET",
+									"name": ":method"
+								}
+							],
+							"path": "/shelves"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"cors": {
+								"allowCredentials": false,
+								"allowHeaders": "Authorization",
+								"allowOriginStringMatch": [
+									{
+										"exact": "https://public.example.com"
+									}
+								]
+							},
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, corsConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.CorsConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForRateLimits(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/shelves",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer",
+					JwksUri: "https://issuer.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+	rateLimitConfig := `{
+		"limits": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"requests_per_unit": 10,
+				"unit": "second",
+				"key": "api_key"
+			},
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"requests_per_unit": 1000,
+				"unit": "day",
+				"key": "jwt_subject"
+			},
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"requests_per_unit": 100,
+				"unit": "second",
+				"key": "client_ip"
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/shelves"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"rateLimits": [
+								{
+									"actions": [
+										{
+											"genericKey": {
+												"descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+											}
+										}
+									]
+								},
+								{
+									"actions": [
+										{
+											"genericKey": {
+												"descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+											}
+										},
+										{
+											"requestHeaders": {
+												"descriptorKey": "path",
+												"headerName": ":path"
+											}
+										}
+									]
+								},
+								{
+									"actions": [
+										{
+											"genericKey": {
+												"descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+											}
+										},
+										{
+											"requestHeaders": {
+												"descriptorKey": "header:x-api-key",
+												"headerName": "x-api-key"
+											}
+										}
+									]
+								},
+								{
+									"actions": [
+										{
+											"genericKey": {
+												"descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+											}
+										},
+										{
+											"requestHeaders": {
+												"descriptorKey": "header:x-endpoint-api-userinfo",
+												"headerName": "x-endpoint-api-userinfo"
+											}
+										}
+									]
+								},
+								{
+									"actions": [
+										{
+											"genericKey": {
+												"descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+											}
+										},
+										{
+											"remoteAddress": {}
+										}
+									]
+								}
+							],
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, rateLimitConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.RateLimitConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRateLimitsForJwtPayloadHeaders(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0/jwks",
+				},
+				{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer-1",
+					JwksUri: "https://issuer-1/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider_0",
+						},
+						{
+							ProviderId: "auth_provider_1",
+						},
+					},
+				},
+			},
+		},
+	}
+	rateLimitPath := writeTempConfigFile(t, `{
+		"limits": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"requests_per_unit": 1000,
+				"unit": "day",
+				"key": "jwt_subject"
+			}
+		]
+	}`)
+	defer os.Remove(rateLimitPath)
+	jwtHeadersPath := writeTempConfigFile(t, `{
+		"providers": [
+			{"id": "auth_provider_1", "payload_header": "X-Jwt-Payload", "payload_encoding": "base64"}
+		]
+	}`)
+	defer os.Remove(jwtHeadersPath)
+
+	// Each payload header of the providers is sent in its own descriptor, so
+	// the Rate Limit service decodes it with the encoding of the header.
+	wantRateLimits := `[
+		{
+			"actions": [
+				{
+					"requestHeaders": {
+						"descriptorKey": "header:x-endpoint-api-userinfo",
+						"headerName": "x-endpoint-api-userinfo"
+					}
+				}
+			]
+		},
+		{
+			"actions": [
+				{
+					"requestHeaders": {
+						"descriptorKey": "header:x-jwt-payload",
+						"headerName": "x-jwt-payload"
+					}
+				}
+			]
+		}
+	]`
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.RateLimitConfigPath = rateLimitPath
+	opts.JwtHeadersConfigPath = jwtHeadersPath
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only compare the header actions of the header descriptors.
+	var gotRateLimits []string
+	for _, rateLimit := range makeRateLimits(fakeServiceInfo, "endpoints.examples.bookstore.Bookstore.CreateShelf")[1:] {
+		rateLimit.Actions = rateLimit.Actions[1:]
+		gotRateLimit, err := (&jsonpb.Marshaler{}).MarshalToString(rateLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRateLimits = append(gotRateLimits, gotRateLimit)
+	}
+	if err := util.JsonEqual(wantRateLimits, "["+strings.Join(gotRateLimits, ",")+"]"); err != nil {
+		t.Errorf("makeRateLimits failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForRequestBodyLimits(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name:             "UploadBooks",
+						RequestStreaming: true,
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		maxRequestBodyBytes     int
+		requestBodyLimitsConfig string
+		wantRouteConfig         string
+	}{
+		{
+			desc:                "Global limit is not applied to streaming methods",
+			maxRequestBodyBytes: 1024,
+			wantRouteConfig: `{
+				"name": "local_route",
+				"virtualHosts": [
+					{
+						"domains": ["*"],
+						"name": "backend",
+						"routes": [
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "POST",
+											"name": ":method"
+										}
+									],
+									"path": "/endpoints.examples.bookstore.Bookstore/UploadBooks"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "0s"
+								},
+								"typedPerFilterConfig": {
+									"envoy.filters.http.buffer": {
+										"@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+										"disabled": true
+									}
+								}
+							},
+							{
+								"match": {
+									"prefix": "/"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "15s"
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+		{
+			desc: "Only the methods with their own limit are limited without a global limit",
+			requestBodyLimitsConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"max_request_body_bytes": 2048
+					}
+				]
+			}`,
+			wantRouteConfig: `{
+				"name": "local_route",
+				"virtualHosts": [
+					{
+						"domains": ["*"],
+						"name": "backend",
+						"routes": [
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "POST",
+											"name": ":method"
+										}
+									],
+									"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "15s"
+								},
+								"typedPerFilterConfig": {
+									"envoy.filters.http.buffer": {
+										"@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+										"buffer": {
+											"maxRequestBytes": 2048
+										}
+									}
+								}
+							},
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "POST",
+											"name": ":method"
+										}
+									],
+									"path": "/endpoints.examples.bookstore.Bookstore/UploadBooks"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "0s"
+								},
+								"typedPerFilterConfig": {
+									"envoy.filters.http.buffer": {
+										"@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+										"disabled": true
+									}
+								}
+							},
+							{
+								"match": {
+									"prefix": "/"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "15s"
+								}
+							}
+						],
+						"typedPerFilterConfig": {
+							"envoy.filters.http.buffer": {
+								"@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+								"disabled": true
+							}
+						}
+					}
+				]
+			}`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendAddress = "grpc://127.0.0.1:80"
+		opts.MaxRequestBodyBytes = tc.maxRequestBodyBytes
+		if tc.requestBodyLimitsConfig != "" {
+			path := writeTempConfigFile(t, tc.requestBodyLimitsConfig)
+			defer os.Remove(path)
+			opts.RequestBodyLimitsConfigPath = path
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		gotConfig, err := marshaler.MarshalToString(gotRoute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantRouteConfig, gotConfig); err != nil {
+			t.Errorf("Test Desc(%d): %s, MakeRouteConfig failed, \n %v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestMakeRouteConfigForResponseCompression(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name:              "ListBooks",
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+	}
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/ListBooks"
+						},
+						"metadata": {
+							"filterMetadata": {
+								"envoy.filters.http.lua": {
+									"disable_response_compression": true
+								}
+							}
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "0s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.EnableResponseCompression = true
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForStreamingMethodIdleTimeout(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name:              "ListBooks",
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+	}
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/ListBooks"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"idleTimeout": "3600s",
+							"timeout": "0s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.StreamingMethodIdleTimeout = time.Hour
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForHeaderRules(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	headerRulesConfig := `{
+		"global": {
+			"request_headers_to_set": [
+				{"key": "x-api-gateway", "value": "espv2"}
+			],
+			"response_headers_to_remove": ["x-internal-trace-id"]
+		},
+		"rules": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"request_headers_to_remove": ["x-debug"],
+				"response_headers_to_add": [
+					{"key": "X-Frame-Options", "value": "DENY"}
+				]
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"mostSpecificHeaderMutationsWins": true,
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"requestHeadersToAdd": [
+					{
+						"append": false,
+						"header": {
+							"key": "x-api-gateway",
+							"value": "espv2"
+						}
+					}
+				],
+				"responseHeadersToRemove": ["x-internal-trace-id"],
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+						},
+						"requestHeadersToRemove": ["x-debug"],
+						"responseHeadersToAdd": [
+							{
+								"append": true,
+								"header": {
+									"key": "X-Frame-Options",
+									"value": "DENY"
+								}
+							}
+						],
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, headerRulesConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.HeaderRulesConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForApiVersionRouting(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name:    "endpoints.examples.bookstore.v1.Bookstore",
+				Version: "v1",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+			{
+				Name:    "endpoints.examples.bookstore.v2.Bookstore",
+				Version: "v2",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.v1.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.v2.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v2/shelves",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		apiVersionRoutingConfig string
+		canaryConfig            string
+		wantRouteConfig         string
+	}{
+		{
+			desc: "Versions are routed by path",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v2", "address": "http://bookstore-v2:8080"}
+				]
+			}`,
+			wantRouteConfig: `{
+				"name": "local_route",
+				"virtualHosts": [
+					{
+						"domains": ["*"],
+						"name": "backend",
+						"routes": [
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "GET",
+											"name": ":method"
+										}
+									],
+									"path": "/v2/shelves"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_version_v2",
+									"timeout": "15s"
+								}
+							},
+							{
+								"match": {
+									"prefix": "/"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "15s"
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+		{
+			desc: "Versions are routed by header",
+			apiVersionRoutingConfig: `{
+				"header": "x-api-version",
+				"backends": [
+					{"version": "v1", "address": "http://bookstore-v1:8080"},
+					{"version": "v2", "address": "http://bookstore-v2:8080"}
+				]
+			}`,
+			wantRouteConfig: `{
+				"name": "local_route",
+				"virtualHosts": [
+					{
+						"domains": ["*"],
+						"name": "backend",
+						"routes": [
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "GET",
+											"name": ":method"
+										},
+										{
+											"exactMatch": "v1",
+											"name": "x-api-version"
+										}
+									],
+									"path": "/v1/shelves"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_version_v1",
+									"timeout": "15s"
+								}
+							},
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "GET",
+											"name": ":method"
+										},
+										{
+											"exactMatch": "v2",
+											"name": "x-api-version"
+										}
+									],
+									"path": "/v2/shelves"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_version_v2",
+									"timeout": "15s"
+								}
+							},
+							{
+								"match": {
+									"prefix": "/"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+									"timeout": "15s"
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+		{
+			desc: "Canary of the local backend is not applied to the versions",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v2", "address": "http://bookstore-v2:8080"}
+				]
+			}`,
+			canaryConfig: `{
+				"address": "http://bookstore-canary:8080",
+				"weight": 10
+			}`,
+			wantRouteConfig: `{
+				"name": "local_route",
+				"virtualHosts": [
+					{
+						"domains": ["*"],
+						"name": "backend",
+						"routes": [
+							{
+								"match": {
+									"headers": [
+										{
+											"exactMatch": "GET",
+											"name": ":method"
+										}
+									],
+									"path": "/v2/shelves"
+								},
+								"route": {
+									"cluster": "bookstore.endpoints.project123.cloud.goog_version_v2",
+									"timeout": "15s"
+								}
+							},
+							{
+								"match": {
+									"prefix": "/"
+								},
+								"route": {
+									"timeout": "15s",
+									"weightedClusters": {
+										"clusters": [
+											{
+												"name": "bookstore.endpoints.project123.cloud.goog_local",
+												"weight": 90
+											},
+											{
+												"name": "canary_bookstore-canary:8080",
+												"weight": 10
+											}
+										]
+									}
+								}
+							}
+						]
+					}
+				]
+			}`,
+		},
+	}
+
+	for i, tc := range testData {
+		path := writeTempConfigFile(t, tc.apiVersionRoutingConfig)
+		defer os.Remove(path)
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ApiVersionRoutingConfigPath = path
+		if tc.canaryConfig != "" {
+			canaryPath := writeTempConfigFile(t, tc.canaryConfig)
+			defer os.Remove(canaryPath)
+			opts.CanaryConfigPath = canaryPath
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotConfig, err := marshaler.MarshalToString(gotRoute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantRouteConfig, gotConfig); err != nil {
+			t.Errorf("Test Desc(%d): %s, MakeRouteConfig failed, \n %v", i, tc.desc, err)
+		}
+	}
+}
+
+func TestMakeRouteConfigForCanary(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	canaryConfig := `{
+		"address": "http://bookstore-canary:8080",
+		"weight": 5,
+		"override_header": {"key": "x-canary", "value": "true"},
+		"rules": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"weight": 50
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								},
+								{
+									"exactMatch": "true",
+									"name": "x-canary"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+						},
+						"route": {
+							"cluster": "canary_bookstore-canary:8080",
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+						},
+						"route": {
+							"timeout": "15s",
+							"weightedClusters": {
+								"clusters": [
+									{
+										"name": "bookstore.endpoints.project123.cloud.goog_local",
+										"weight": 50
+									},
+									{
+										"name": "canary_bookstore-canary:8080",
+										"weight": 50
+									}
+								]
+							}
+						}
+					},
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "true",
+									"name": "x-canary"
+								}
+							],
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "canary_bookstore-canary:8080",
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"timeout": "15s",
+							"weightedClusters": {
+								"clusters": [
+									{
+										"name": "bookstore.endpoints.project123.cloud.goog_local",
+										"weight": 95
+									},
+									{
+										"name": "canary_bookstore-canary:8080",
+										"weight": 5
+									}
+								]
+							}
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, canaryConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.CanaryConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForMirror(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	mirrorConfig := `{
+		"targets": [
+			{"address": "http://bookstore-v2:8080", "percentage": 10}
+		],
+		"rules": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"targets": []
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"requestMirrorPolicies": [
+								{
+									"cluster": "mirror_bookstore-v2:8080",
+									"runtimeFraction": {
+										"defaultValue": {
+											"numerator": 10
+										}
+									}
+								}
+							],
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, mirrorConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.MirrorConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForFault(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+	faultConfig := `{
+		"faults": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				"delay": {"fixed_delay": "2s", "percentage": 50},
+				"abort": {"grpc_status": "UNAVAILABLE", "percentage": 10},
+				"headers": [{"key": "x-chaos-test", "value": "true"}]
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/CreateShelf"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.fault": {
+								"@type": "type.googleapis.com/envoy.config.filter.http.fault.v2.HTTPFault",
+								"abort": {
+									"httpStatus": 503,
+									"percentage": {
+										"numerator": 10
+									}
+								},
+								"delay": {
+									"fixedDelay": "2s",
+									"percentage": {
+										"numerator": 50
+									}
+								},
+								"headers": [
+									{
+										"exactMatch": "true",
+										"name": "x-chaos-test"
+									}
+								]
+							}
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, faultConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.FaultConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{
+		AnyResolver: util.Resolver,
+	}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func TestMakeRouteConfigForExtAuthz(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	extAuthzConfig := `{
+		"address": "grpc://policy-engine:9000",
+		"rules": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+				"disabled": true
+			}
+		]
+	}`
+	wantRouteConfig := `{
+		"name": "local_route",
+		"virtualHosts": [
+			{
+				"domains": ["*"],
+				"name": "backend",
+				"routes": [
+					{
+						"match": {
+							"headers": [
+								{
+									"exactMatch": "POST",
+									"name": ":method"
+								}
+							],
+							"path": "/endpoints.examples.bookstore.Bookstore/ListShelves"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"match": {
+							"prefix": "/"
+						},
+						"route": {
+							"cluster": "bookstore.endpoints.project123.cloud.goog_local",
+							"timeout": "15s"
+						}
+					}
+				]
+			}
+		]
+	}`
+
+	path := writeTempConfigFile(t, extAuthzConfig)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.ExtAuthzConfigPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{
+		AnyResolver: util.Resolver,
+	}
+	gotConfig, err := marshaler.MarshalToString(gotRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(wantRouteConfig, gotConfig); err != nil {
+		t.Errorf("MakeRouteConfig failed, \n %v", err)
+	}
+}
+
+func writeTempConfigFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
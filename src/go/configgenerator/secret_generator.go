@@ -0,0 +1,209 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	authpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// MakeSecrets moves the certificates, the keys and the root certificates in
+// the TLS transport sockets of the listeners and the clusters into SDS
+// secrets served over ADS, which Envoy updates in place when they change.
+// The transport sockets are changed to reference the secrets by name. It
+// returns the secrets with the contents of the files, and the files read.
+func MakeSecrets(listeners []*v2pb.Listener, clusters []*v2pb.Cluster) ([]*authpb.Secret, []string, error) {
+	g := &secretGenerator{
+		secrets: make(map[string]*authpb.Secret),
+		files:   make(map[string]bool),
+	}
+	for _, listener := range listeners {
+		for _, filterChain := range listener.GetFilterChains() {
+			if err := g.replaceDownstreamTlsFiles(filterChain.GetTransportSocket()); err != nil {
+				return nil, nil, fmt.Errorf("fail to make secrets of listener %s: %v", listener.GetName(), err)
+			}
+		}
+	}
+	for _, cluster := range clusters {
+		if err := g.replaceUpstreamTlsFiles(cluster.GetTransportSocket()); err != nil {
+			return nil, nil, fmt.Errorf("fail to make secrets of cluster %s: %v", cluster.GetName(), err)
+		}
+	}
+
+	var names []string
+	for name := range g.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var secrets []*authpb.Secret
+	for _, name := range names {
+		secrets = append(secrets, g.secrets[name])
+	}
+	var files []string
+	for file := range g.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return secrets, files, nil
+}
+
+type secretGenerator struct {
+	// Secrets keyed by name, shared by the transport sockets with the same
+	// files.
+	secrets map[string]*authpb.Secret
+	files   map[string]bool
+}
+
+func (g *secretGenerator) replaceDownstreamTlsFiles(transportSocket *corepb.TransportSocket) error {
+	if transportSocket.GetName() != util.TLSTransportSocket {
+		return nil
+	}
+	tlsContext := &authpb.DownstreamTlsContext{}
+	if err := ptypes.UnmarshalAny(transportSocket.GetTypedConfig(), tlsContext); err != nil {
+		return err
+	}
+	if err := g.replaceCommonTlsFiles(tlsContext.GetCommonTlsContext()); err != nil {
+		return err
+	}
+	return setTypedConfig(transportSocket, tlsContext)
+}
+
+func (g *secretGenerator) replaceUpstreamTlsFiles(transportSocket *corepb.TransportSocket) error {
+	if transportSocket.GetName() != util.TLSTransportSocket {
+		return nil
+	}
+	tlsContext := &authpb.UpstreamTlsContext{}
+	if err := ptypes.UnmarshalAny(transportSocket.GetTypedConfig(), tlsContext); err != nil {
+		return err
+	}
+	if err := g.replaceCommonTlsFiles(tlsContext.GetCommonTlsContext()); err != nil {
+		return err
+	}
+	return setTypedConfig(transportSocket, tlsContext)
+}
+
+func setTypedConfig(transportSocket *corepb.TransportSocket, tlsContext proto.Message) error {
+	typedConfig, err := ptypes.MarshalAny(tlsContext)
+	if err != nil {
+		return err
+	}
+	transportSocket.ConfigType = &corepb.TransportSocket_TypedConfig{
+		TypedConfig: typedConfig,
+	}
+	return nil
+}
+
+func (g *secretGenerator) replaceCommonTlsFiles(commonTls *authpb.CommonTlsContext) error {
+	for _, cert := range commonTls.GetTlsCertificates() {
+		certPath, keyPath := cert.GetCertificateChain().GetFilename(), cert.GetPrivateKey().GetFilename()
+		if certPath == "" || keyPath == "" {
+			return fmt.Errorf("TLS certificate without files cannot be a secret")
+		}
+		name := fmt.Sprintf("tls_certificate:%s:%s", certPath, keyPath)
+		if _, ok := g.secrets[name]; !ok {
+			certChain, err := g.readFile(certPath)
+			if err != nil {
+				return err
+			}
+			privateKey, err := g.readFile(keyPath)
+			if err != nil {
+				return err
+			}
+			g.secrets[name] = &authpb.Secret{
+				Name: name,
+				Type: &authpb.Secret_TlsCertificate{
+					TlsCertificate: &authpb.TlsCertificate{
+						CertificateChain: certChain,
+						PrivateKey:       privateKey,
+					},
+				},
+			}
+		}
+		commonTls.TlsCertificateSdsSecretConfigs = append(commonTls.TlsCertificateSdsSecretConfigs, makeSdsSecretConfig(name))
+	}
+	commonTls.TlsCertificates = nil
+
+	validationContext := commonTls.GetValidationContext()
+	caPath := validationContext.GetTrustedCa().GetFilename()
+	if caPath == "" {
+		return nil
+	}
+	name := fmt.Sprintf("validation_context:%s", caPath)
+	if _, ok := g.secrets[name]; !ok {
+		trustedCa, err := g.readFile(caPath)
+		if err != nil {
+			return err
+		}
+		g.secrets[name] = &authpb.Secret{
+			Name: name,
+			Type: &authpb.Secret_ValidationContext{
+				ValidationContext: &authpb.CertificateValidationContext{
+					TrustedCa: trustedCa,
+				},
+			},
+		}
+	}
+
+	// The other fields of the validation context, such as the subject alt
+	// names to match, stay in the config and are combined with the secret.
+	validationContext.TrustedCa = nil
+	if proto.Equal(validationContext, &authpb.CertificateValidationContext{}) {
+		commonTls.ValidationContextType = &authpb.CommonTlsContext_ValidationContextSdsSecretConfig{
+			ValidationContextSdsSecretConfig: makeSdsSecretConfig(name),
+		}
+		return nil
+	}
+	commonTls.ValidationContextType = &authpb.CommonTlsContext_CombinedValidationContext{
+		CombinedValidationContext: &authpb.CommonTlsContext_CombinedCertificateValidationContext{
+			DefaultValidationContext:         validationContext,
+			ValidationContextSdsSecretConfig: makeSdsSecretConfig(name),
+		},
+	}
+	return nil
+}
+
+func (g *secretGenerator) readFile(path string) (*corepb.DataSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read TLS file: %v", err)
+	}
+	g.files[path] = true
+	return &corepb.DataSource{
+		Specifier: &corepb.DataSource_InlineBytes{
+			InlineBytes: data,
+		},
+	}, nil
+}
+
+// makeSdsSecretConfig references the secret served over ADS.
+func makeSdsSecretConfig(name string) *authpb.SdsSecretConfig {
+	return &authpb.SdsSecretConfig{
+		Name: name,
+		SdsConfig: &corepb.ConfigSource{
+			ConfigSourceSpecifier: &corepb.ConfigSource_Ads{
+				Ads: &corepb.AggregatedConfigSource{},
+			},
+		},
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+)
+
+func TestMakeSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for file, content := range map[string]string{
+		"server.crt": "server-cert",
+		"server.key": "server-key",
+		"client.crt": "client-cert",
+		"client.key": "client-key",
+		"ca.crt":     "client-ca",
+		"roots.crt":  "root-certs",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testdata := []struct {
+		desc                 string
+		clientRootCertsPath  string
+		clientSans           []string
+		backendRootCertsPath string
+		wantListenerSocket   string
+		wantClusterSocket    string
+		wantSecrets          []string
+		wantFiles            []string
+		wantError            string
+	}{
+		{
+			desc:                 "Success, secrets of the listener certificate and the cluster certificates",
+			backendRootCertsPath: filepath.Join(dir, "roots.crt"),
+			wantListenerSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"tlsCertificateSdsSecretConfigs":[
+							{
+								"name":"tls_certificate:DIR/server.crt:DIR/server.key",
+								"sdsConfig":{"ads":{}}
+							}
+						]
+					}
+				}
+			}`,
+			wantClusterSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext",
+					"commonTlsContext":{
+						"tlsCertificateSdsSecretConfigs":[
+							{
+								"name":"tls_certificate:DIR/client.crt:DIR/client.key",
+								"sdsConfig":{"ads":{}}
+							}
+						],
+						"validationContextSdsSecretConfig":{
+							"name":"validation_context:DIR/roots.crt",
+							"sdsConfig":{"ads":{}}
+						}
+					},
+					"sni":"backend.example.com"
+				}
+			}`,
+			wantSecrets: []string{
+				`{
+					"name":"tls_certificate:DIR/client.crt:DIR/client.key",
+					"tlsCertificate":{
+						"certificateChain":{"inlineBytes":"Y2xpZW50LWNlcnQ="},
+						"privateKey":{"inlineBytes":"Y2xpZW50LWtleQ=="}
+					}
+				}`,
+				`{
+					"name":"tls_certificate:DIR/server.crt:DIR/server.key",
+					"tlsCertificate":{
+						"certificateChain":{"inlineBytes":"c2VydmVyLWNlcnQ="},
+						"privateKey":{"inlineBytes":"c2VydmVyLWtleQ=="}
+					}
+				}`,
+				`{
+					"name":"validation_context:DIR/roots.crt",
+					"validationContext":{
+						"trustedCa":{"inlineBytes":"cm9vdC1jZXJ0cw=="}
+					}
+				}`,
+			},
+			wantFiles: []string{"DIR/client.crt", "DIR/client.key", "DIR/roots.crt", "DIR/server.crt", "DIR/server.key"},
+		},
+		{
+			desc:                 "Success, combine the client root certificates with the subject alt names to match",
+			clientRootCertsPath:  filepath.Join(dir, "ca.crt"),
+			clientSans:           []string{"client.example.com"},
+			backendRootCertsPath: filepath.Join(dir, "ca.crt"),
+			wantListenerSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"combinedValidationContext":{
+							"defaultValidationContext":{
+								"matchSubjectAltNames":[{"exact":"client.example.com"}]
+							},
+							"validationContextSdsSecretConfig":{
+								"name":"validation_context:DIR/ca.crt",
+								"sdsConfig":{"ads":{}}
+							}
+						},
+						"tlsCertificateSdsSecretConfigs":[
+							{
+								"name":"tls_certificate:DIR/server.crt:DIR/server.key",
+								"sdsConfig":{"ads":{}}
+							}
+						]
+					}
+				}
+			}`,
+			wantClusterSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext",
+					"commonTlsContext":{
+						"tlsCertificateSdsSecretConfigs":[
+							{
+								"name":"tls_certificate:DIR/client.crt:DIR/client.key",
+								"sdsConfig":{"ads":{}}
+							}
+						],
+						"validationContextSdsSecretConfig":{
+							"name":"validation_context:DIR/ca.crt",
+							"sdsConfig":{"ads":{}}
+						}
+					},
+					"sni":"backend.example.com"
+				}
+			}`,
+			wantSecrets: []string{
+				`{
+					"name":"tls_certificate:DIR/client.crt:DIR/client.key",
+					"tlsCertificate":{
+						"certificateChain":{"inlineBytes":"Y2xpZW50LWNlcnQ="},
+						"privateKey":{"inlineBytes":"Y2xpZW50LWtleQ=="}
+					}
+				}`,
+				`{
+					"name":"tls_certificate:DIR/server.crt:DIR/server.key",
+					"tlsCertificate":{
+						"certificateChain":{"inlineBytes":"c2VydmVyLWNlcnQ="},
+						"privateKey":{"inlineBytes":"c2VydmVyLWtleQ=="}
+					}
+				}`,
+				`{
+					"name":"validation_context:DIR/ca.crt",
+					"validationContext":{
+						"trustedCa":{"inlineBytes":"Y2xpZW50LWNh"}
+					}
+				}`,
+			},
+			wantFiles: []string{"DIR/ca.crt", "DIR/client.crt", "DIR/client.key", "DIR/server.crt", "DIR/server.key"},
+		},
+		{
+			desc:                 "Fail with a missing file",
+			backendRootCertsPath: filepath.Join(dir, "missing.crt"),
+			wantError:            "fail to make secrets of cluster backend-cluster: fail to read TLS file: open DIR/missing.crt: no such file or directory",
+		},
+	}
+
+	for i, tc := range testdata {
+		listenerSocket, err := util.CreateDownstreamTransportSocket(dir, &util.DownstreamTlsParams{
+			ClientRootCertsPath: tc.clientRootCertsPath,
+			ClientSans:          tc.clientSans,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusterSocket, err := util.CreateUpstreamTransportSocket("backend.example.com", tc.backendRootCertsPath, dir, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners := []*v2pb.Listener{
+			{
+				Name: "https_listener",
+				FilterChains: []*listenerpb.FilterChain{
+					{
+						TransportSocket: listenerSocket,
+					},
+				},
+			},
+		}
+		clusters := []*v2pb.Cluster{
+			{
+				Name: "plaintext-cluster",
+			},
+			{
+				Name:            "backend-cluster",
+				TransportSocket: clusterSocket,
+			},
+		}
+
+		secrets, files, err := MakeSecrets(listeners, clusters)
+		if tc.wantError != "" {
+			wantError := strings.ReplaceAll(tc.wantError, "DIR", dir)
+			if err == nil || err.Error() != wantError {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotListenerSocket, err := marshaler.MarshalToString(listeners[0].GetFilterChains()[0].GetTransportSocket())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(strings.ReplaceAll(tc.wantListenerSocket, "DIR", dir), gotListenerSocket); err != nil {
+			t.Errorf("Test Desc(%d): %s, listener transport socket, \n %v ", i, tc.desc, err)
+		}
+		gotClusterSocket, err := marshaler.MarshalToString(clusters[1].GetTransportSocket())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(strings.ReplaceAll(tc.wantClusterSocket, "DIR", dir), gotClusterSocket); err != nil {
+			t.Errorf("Test Desc(%d): %s, cluster transport socket, \n %v ", i, tc.desc, err)
+		}
+		if len(secrets) != len(tc.wantSecrets) {
+			t.Errorf("Test Desc(%d): %s, got %d secrets, want %d", i, tc.desc, len(secrets), len(tc.wantSecrets))
+			continue
+		}
+		for j, secret := range secrets {
+			gotSecret, err := marshaler.MarshalToString(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(strings.ReplaceAll(tc.wantSecrets[j], "DIR", dir), gotSecret); err != nil {
+				t.Errorf("Test Desc(%d): %s, secret(%d), \n %v ", i, tc.desc, j, err)
+			}
+		}
+		var wantFiles []string
+		for _, file := range tc.wantFiles {
+			wantFiles = append(wantFiles, strings.ReplaceAll(file, "DIR", dir))
+		}
+		if !reflect.DeepEqual(files, wantFiles) {
+			t.Errorf("Test Desc(%d): %s, got files %v, want %v", i, tc.desc, files, wantFiles)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import "fmt"
+
+// apiVersionRoutingConfig is the format of the file specified by
+// --api_version_routing_config_path.
+//
+// Example:
+//
+//	{
+//	  "header": "x-api-version",
+//	  "backends": [
+//	    {"version": "v1", "address": "http://bookstore-v1:8080"},
+//	    {"version": "v2", "address": "grpc://bookstore-v2:8081"}
+//	  ]
+//	}
+//
+// The methods of an API are routed to the backend of the API version. Without
+// a header, the versions are told apart by the paths of their methods, e.g.
+// /v1/shelves and /v2/shelves. With a header, the methods are only routed to
+// the backend of their version if the header has the version as its value, so
+// versions can share paths. Other requests go to --backend.
+type apiVersionRoutingConfig struct {
+	Header   string               `json:"header"`
+	Backends []*apiVersionBackend `json:"backends"`
+}
+
+type apiVersionBackend struct {
+	// Version of the APIs, as in the "version" field of the service config.
+	Version string `json:"version"`
+	Address string `json:"address"`
+}
+
+func (s *ServiceInfo) processApiVersionRouting() error {
+	return s.processConfigFile(s.Options.ApiVersionRoutingConfigPath, &apiVersionRoutingConfig{})
+}
+
+func (c *apiVersionRoutingConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	if len(s.BackendRoutingClusters) > 0 {
+		return nil, fmt.Errorf("API version routing cannot be used with dynamic routing")
+	}
+
+	hasVersion := make(map[string]bool)
+	for _, method := range s.Methods {
+		if method.ApiVersion != "" {
+			hasVersion[method.ApiVersion] = true
+		}
+	}
+
+	clusterNames := make(map[string]string)
+	for _, backend := range c.Backends {
+		if !hasVersion[backend.Version] {
+			return nil, fmt.Errorf("API version %q in API version routing does not match any API", backend.Version)
+		}
+		if _, exist := clusterNames[backend.Version]; exist {
+			return nil, fmt.Errorf("API version %q has more than one backend", backend.Version)
+		}
+
+		cluster, err := s.makeBackendRoutingCluster(backend.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend address of API version %q: %v", backend.Version, err)
+		}
+		// The prefix keeps a version such as "local" from taking the name of
+		// the cluster of the local backend.
+		cluster.ClusterName = fmt.Sprintf("%s_version_%s", s.Name, backend.Version)
+		s.ApiVersionClusters = append(s.ApiVersionClusters, cluster)
+		clusterNames[backend.Version] = cluster.ClusterName
+	}
+
+	for _, method := range s.Methods {
+		method.ApiVersionClusterName = clusterNames[method.ApiVersion]
+	}
+	s.ApiVersionHeader = c.Header
+	return nil, nil
+}
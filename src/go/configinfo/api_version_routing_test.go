@@ -0,0 +1,204 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessApiVersionRouting(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name:    "endpoints.examples.bookstore.v1.Bookstore",
+				Version: "v1",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+			{
+				Name:    "endpoints.examples.bookstore.v2.Bookstore",
+				Version: "v2",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+			{
+				Name:    "endpoints.examples.bookstore.local.Bookstore",
+				Version: "local",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		apiVersionRoutingConfig string
+		wantClusters            []*BackendRoutingCluster
+		wantHeader              string
+		wantClusterNames        map[string]string
+		wantGrpcSupportRequired bool
+		wantedErrorMsg          string
+	}{
+		{
+			desc: "Backends for each version selected by header",
+			apiVersionRoutingConfig: `{
+				"header": "x-api-version",
+				"backends": [
+					{"version": "v1", "address": "http://bookstore-v1:8080"},
+					{"version": "v2", "address": "grpcs://bookstore-v2"}
+				]
+			}`,
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "bookstore.endpoints.project123.cloud.goog_version_v1",
+					Hostname:    "bookstore-v1",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+				{
+					ClusterName: "bookstore.endpoints.project123.cloud.goog_version_v2",
+					Hostname:    "bookstore-v2",
+					Port:        443,
+					UseTLS:      true,
+					Protocol:    util.GRPC,
+				},
+			},
+			wantHeader: "x-api-version",
+			wantClusterNames: map[string]string{
+				"endpoints.examples.bookstore.v1.Bookstore.ListShelves": "bookstore.endpoints.project123.cloud.goog_version_v1",
+				"endpoints.examples.bookstore.v2.Bookstore.ListShelves": "bookstore.endpoints.project123.cloud.goog_version_v2",
+			},
+			wantGrpcSupportRequired: true,
+		},
+		{
+			desc: "Versions without a backend use the local backend",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v2", "address": "http://bookstore-v2:8080"}
+				]
+			}`,
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "bookstore.endpoints.project123.cloud.goog_version_v2",
+					Hostname:    "bookstore-v2",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+			},
+			wantClusterNames: map[string]string{
+				"endpoints.examples.bookstore.v2.Bookstore.ListShelves": "bookstore.endpoints.project123.cloud.goog_version_v2",
+			},
+		},
+		{
+			desc: "Cluster of a version named local is not the cluster of the local backend",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "local", "address": "http://bookstore-local:8080"}
+				]
+			}`,
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "bookstore.endpoints.project123.cloud.goog_version_local",
+					Hostname:    "bookstore-local",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+			},
+			wantClusterNames: map[string]string{
+				"endpoints.examples.bookstore.local.Bookstore.ListShelves": "bookstore.endpoints.project123.cloud.goog_version_local",
+			},
+		},
+		{
+			desc: "Fail with unknown version",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v3", "address": "http://bookstore-v3:8080"}
+				]
+			}`,
+			wantedErrorMsg: `API version "v3" in API version routing does not match any API`,
+		},
+		{
+			desc: "Fail with duplicate version",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v1", "address": "http://bookstore-v1:8080"},
+					{"version": "v1", "address": "http://bookstore-v1-canary:8080"}
+				]
+			}`,
+			wantedErrorMsg: `API version "v1" has more than one backend`,
+		},
+		{
+			desc: "Fail with invalid address",
+			apiVersionRoutingConfig: `{
+				"backends": [
+					{"version": "v1", "address": "ftp://bookstore-v1"}
+				]
+			}`,
+			wantedErrorMsg: `invalid backend address of API version "v1": unknown backend scheme [ftp]`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.apiVersionRoutingConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.ApiVersionRoutingConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantClusters, serviceInfo.ApiVersionClusters); diff != "" {
+			t.Errorf("Test Desc(%d): %s, API version clusters diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if serviceInfo.ApiVersionHeader != tc.wantHeader {
+			t.Errorf("Test Desc(%d): %s, got API version header %q, want %q", i, tc.desc, serviceInfo.ApiVersionHeader, tc.wantHeader)
+		}
+		if serviceInfo.GrpcSupportRequired != tc.wantGrpcSupportRequired {
+			t.Errorf("Test Desc(%d): %s, got GrpcSupportRequired %v, want %v", i, tc.desc, serviceInfo.GrpcSupportRequired, tc.wantGrpcSupportRequired)
+		}
+		gotClusterNames := make(map[string]string)
+		for operation, method := range serviceInfo.Methods {
+			if method.ApiVersionClusterName != "" {
+				gotClusterNames[operation] = method.ApiVersionClusterName
+			}
+		}
+		if diff := cmp.Diff(tc.wantClusterNames, gotClusterNames); diff != "" {
+			t.Errorf("Test Desc(%d): %s, API version cluster names diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
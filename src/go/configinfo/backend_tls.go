@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// BackendTls overrides the TLS settings of the connections to a backend. The
+// empty fields keep the global settings.
+type BackendTls struct {
+	RootCertsPath  string `json:"root_certs_path"`
+	ClientCertPath string `json:"client_cert_path"`
+	ClientKeyPath  string `json:"client_key_path"`
+	// The certificate of the backend must have one of the subject alt names,
+	// if any.
+	SubjectAltNames []string `json:"subject_alt_names"`
+	// SNI sent instead of the hostname of the backend.
+	Sni string `json:"sni"`
+}
+
+// backendTlsConfig is the format of the file specified by
+// --backend_tls_config_path.
+//
+// Example:
+//
+//	{
+//	  "backends": {
+//	    "internal.example.com:8443": {
+//	      "root_certs_path": "/etc/ssl/internal/ca.crt",
+//	      "client_cert_path": "/etc/ssl/internal/client.crt",
+//	      "client_key_path": "/etc/ssl/internal/client.key",
+//	      "subject_alt_names": ["spiffe://example.com/internal"],
+//	      "sni": "internal.svc"
+//	    }
+//	  }
+//	}
+//
+// Backends are keyed by address, as hostname:port or as a URI such as
+// https://internal.example.com:8443, and must use TLS.
+type backendTlsConfig struct {
+	Backends map[string]*BackendTls `json:"backends"`
+}
+
+func (s *ServiceInfo) processBackendTlsConfig() error {
+	return s.processConfigFile(s.Options.BackendTlsConfigPath, &backendTlsConfig{})
+}
+
+func (c *backendTlsConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	backendTls := make(map[string]*BackendTls)
+	for address, tls := range c.Backends {
+		if (tls.ClientCertPath == "") != (tls.ClientKeyPath == "") {
+			return nil, fmt.Errorf("TLS settings of backend %s must have both client_cert_path and client_key_path, or neither", address)
+		}
+		_, hostname, port, _, err := util.ParseURI(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend address %q in TLS settings: %v", address, err)
+		}
+		backendTls[fmt.Sprintf("%v:%v", hostname, port)] = tls
+	}
+
+	clusters := append([]*BackendRoutingCluster{s.CatchAllBackend}, s.BackendRoutingClusters...)
+	clusters = append(clusters, s.ApiVersionClusters...)
+	clusters = append(clusters, s.CanaryClusters...)
+	clusters = append(clusters, s.MirrorClusters...)
+	if s.ExtAuthz != nil {
+		clusters = append(clusters, s.ExtAuthz.Cluster)
+	}
+	matched := make(map[string]bool)
+	for _, cluster := range clusters {
+		address := fmt.Sprintf("%v:%v", cluster.Hostname, cluster.Port)
+		tls, ok := backendTls[address]
+		if !ok || !cluster.UseTLS {
+			continue
+		}
+		cluster.Tls = tls
+		matched[address] = true
+	}
+	for address := range backendTls {
+		if !matched[address] {
+			return nil, fmt.Errorf("TLS settings are set for %s, which is not a backend using TLS", address)
+		}
+	}
+	return nil, nil
+}
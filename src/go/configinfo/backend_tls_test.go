@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+func TestProcessBackendTlsConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Backend = &confpb.Backend{
+		Rules: []*confpb.BackendRule{
+			{
+				Address:  "https://internal.example.com:8443/shelves",
+				Selector: testApiName + ".ListShelves",
+			},
+			{
+				Address:  "http://plain.example.com",
+				Selector: testApiName + ".CreateShelf",
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		backendTlsConfig string
+		backendAddress   string
+		wantBackendTls   map[string]*BackendTls
+		wantedErrorMsg   string
+	}{
+		{
+			desc: "TLS settings of a dynamic routing backend keyed by hostname and port",
+			backendTlsConfig: `{
+				"backends": {
+					"internal.example.com:8443": {
+						"root_certs_path": "/etc/ssl/internal/ca.crt",
+						"client_cert_path": "/etc/ssl/internal/client.crt",
+						"client_key_path": "/etc/ssl/internal/client.key",
+						"subject_alt_names": ["spiffe://example.com/internal"],
+						"sni": "internal.svc"
+					}
+				}
+			}`,
+			backendAddress: "http://127.0.0.1:8082",
+			wantBackendTls: map[string]*BackendTls{
+				"internal.example.com:8443": {
+					RootCertsPath:   "/etc/ssl/internal/ca.crt",
+					ClientCertPath:  "/etc/ssl/internal/client.crt",
+					ClientKeyPath:   "/etc/ssl/internal/client.key",
+					SubjectAltNames: []string{"spiffe://example.com/internal"},
+					Sni:             "internal.svc",
+				},
+			},
+		},
+		{
+			desc: "TLS settings of the local backend keyed by URI",
+			backendTlsConfig: `{
+				"backends": {
+					"https://localhost": {
+						"sni": "local.svc"
+					}
+				}
+			}`,
+			backendAddress: "https://localhost",
+			wantBackendTls: map[string]*BackendTls{
+				"bookstore.endpoints.project123.cloud.goog_local": {
+					Sni: "local.svc",
+				},
+			},
+		},
+		{
+			desc: "Fail with a client certificate without a key",
+			backendTlsConfig: `{
+				"backends": {
+					"internal.example.com:8443": {
+						"client_cert_path": "/etc/ssl/internal/client.crt"
+					}
+				}
+			}`,
+			backendAddress: "http://127.0.0.1:8082",
+			wantedErrorMsg: "TLS settings of backend internal.example.com:8443 must have both client_cert_path and client_key_path, or neither",
+		},
+		{
+			desc: "Fail with a backend not using TLS",
+			backendTlsConfig: `{
+				"backends": {
+					"plain.example.com:80": {
+						"sni": "plain.svc"
+					}
+				}
+			}`,
+			backendAddress: "http://127.0.0.1:8082",
+			wantedErrorMsg: "TLS settings are set for plain.example.com:80, which is not a backend using TLS",
+		},
+		{
+			desc: "Fail with an unknown backend",
+			backendTlsConfig: `{
+				"backends": {
+					"internal.example.com": {
+						"sni": "internal.svc"
+					}
+				}
+			}`,
+			backendAddress: "http://127.0.0.1:8082",
+			wantedErrorMsg: "TLS settings are set for internal.example.com:443, which is not a backend using TLS",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.backendTlsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.BackendAddress = tc.backendAddress
+			opts.BackendTlsConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotBackendTls := make(map[string]*BackendTls)
+		for _, cluster := range append([]*BackendRoutingCluster{serviceInfo.CatchAllBackend}, serviceInfo.BackendRoutingClusters...) {
+			if cluster.Tls != nil {
+				gotBackendTls[cluster.ClusterName] = cluster.Tls
+			}
+		}
+		if diff := cmp.Diff(tc.wantBackendTls, gotBackendTls); diff != "" {
+			t.Errorf("Test Desc(%d): %s, backend TLS settings diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
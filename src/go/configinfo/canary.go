@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import "fmt"
+
+// Canary sends a share of the requests of a route to a canary backend instead
+// of the backend of the route.
+type Canary struct {
+	ClusterName string
+	// Percentage of the requests sent to the canary backend, from 0 to 100.
+	Weight uint32
+}
+
+// canaryConfig is the format of the file specified by --canary_config_path.
+//
+// Example:
+//
+//	{
+//	  "address": "http://bookstore-canary:8080",
+//	  "weight": 5,
+//	  "override_header": {"key": "x-canary", "value": "true"},
+//	  "rules": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+//	      "weight": 0
+//	    },
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+//	      "address": "http://bookstore-list-canary:8080",
+//	      "weight": 50
+//	    }
+//	  ]
+//	}
+//
+// The global weight applies to all the routes, and rules for an operation or
+// API override it. Rules without an address use the global one. Requests with
+// the override header always go to the canary backend of their route.
+type canaryConfig struct {
+	Address        string        `json:"address"`
+	Weight         uint32        `json:"weight"`
+	OverrideHeader *HeaderValue  `json:"override_header"`
+	Rules          []*canaryRule `json:"rules"`
+}
+
+type canaryRule struct {
+	ruleSelector
+	Address string `json:"address"`
+	Weight  uint32 `json:"weight"`
+
+	canary *Canary
+}
+
+func (s *ServiceInfo) processCanaryConfig() error {
+	return s.processConfigFile(s.Options.CanaryConfigPath, &canaryConfig{})
+}
+
+func (c *canaryConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	if h := c.OverrideHeader; h != nil && (h.Key == "" || h.Value == "") {
+		return nil, fmt.Errorf("canary override header must have a key and a value")
+	}
+	s.CanaryOverrideHeader = c.OverrideHeader
+
+	clusterNames := make(map[string]bool)
+	if c.Address != "" {
+		canary, err := s.makeCanary(c.Address, c.Weight, clusterNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid global canary: %v", err)
+		}
+		s.Canary = canary
+	} else if c.Weight != 0 {
+		return nil, fmt.Errorf("invalid global canary: weight is set without an address")
+	}
+
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		address := rule.Address
+		if address == "" {
+			address = c.Address
+		}
+		if address == "" {
+			return nil, fmt.Errorf("invalid canary for selector %q: no address", rule.Selector)
+		}
+		canary, err := s.makeCanary(address, rule.Weight, clusterNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid canary for selector %q: %v", rule.Selector, err)
+		}
+		rule.canary = canary
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *canaryRule) apply(method *methodInfo) error {
+	method.Canary = r.canary
+	return nil
+}
+
+// makeCanary makes a canary to the backend at address, adding its cluster if
+// it is not in clusterNames yet.
+func (s *ServiceInfo) makeCanary(address string, weight uint32, clusterNames map[string]bool) (*Canary, error) {
+	if weight > 100 {
+		return nil, fmt.Errorf("weight %d must be between 0 and 100", weight)
+	}
+
+	cluster, err := s.makeBackendRoutingCluster(address)
+	if err != nil {
+		return nil, err
+	}
+	cluster.ClusterName = fmt.Sprintf("canary_%v:%v", cluster.Hostname, cluster.Port)
+	if !clusterNames[cluster.ClusterName] {
+		s.CanaryClusters = append(s.CanaryClusters, cluster)
+		clusterNames[cluster.ClusterName] = true
+	}
+
+	return &Canary{
+		ClusterName: cluster.ClusterName,
+		Weight:      weight,
+	}, nil
+}
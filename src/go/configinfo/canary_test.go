@@ -0,0 +1,190 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessCanaryConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc               string
+		canaryConfig       string
+		wantCanary         *Canary
+		wantOverrideHeader *HeaderValue
+		wantClusters       []*BackendRoutingCluster
+		wantMethodCanaries map[string]*Canary
+		wantedErrorMsg     string
+	}{
+		{
+			desc: "Global canary with an override header and rules",
+			canaryConfig: `{
+				"address": "http://bookstore-canary:8080",
+				"weight": 5,
+				"override_header": {"key": "x-canary", "value": "true"},
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"weight": 0
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+						"address": "grpcs://bookstore-list-canary",
+						"weight": 50
+					}
+				]
+			}`,
+			wantCanary: &Canary{
+				ClusterName: "canary_bookstore-canary:8080",
+				Weight:      5,
+			},
+			wantOverrideHeader: &HeaderValue{
+				Key:   "x-canary",
+				Value: "true",
+			},
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "canary_bookstore-canary:8080",
+					Hostname:    "bookstore-canary",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+				{
+					ClusterName: "canary_bookstore-list-canary:443",
+					Hostname:    "bookstore-list-canary",
+					Port:        443,
+					UseTLS:      true,
+					Protocol:    util.GRPC,
+				},
+			},
+			wantMethodCanaries: map[string]*Canary{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					ClusterName: "canary_bookstore-canary:8080",
+					Weight:      0,
+				},
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					ClusterName: "canary_bookstore-list-canary:443",
+					Weight:      50,
+				},
+			},
+		},
+		{
+			desc: "Canary for an API only",
+			canaryConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"address": "http://bookstore-canary:8080",
+						"weight": 10
+					}
+				]
+			}`,
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "canary_bookstore-canary:8080",
+					Hostname:    "bookstore-canary",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+			},
+			wantMethodCanaries: map[string]*Canary{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					ClusterName: "canary_bookstore-canary:8080",
+					Weight:      10,
+				},
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					ClusterName: "canary_bookstore-canary:8080",
+					Weight:      10,
+				},
+			},
+		},
+		{
+			desc: "Fail with weight above 100",
+			canaryConfig: `{
+				"address": "http://bookstore-canary:8080",
+				"weight": 101
+			}`,
+			wantedErrorMsg: "invalid global canary: weight 101 must be between 0 and 100",
+		},
+		{
+			desc: "Fail with global weight without an address",
+			canaryConfig: `{
+				"weight": 10
+			}`,
+			wantedErrorMsg: "invalid global canary: weight is set without an address",
+		},
+		{
+			desc: "Fail with rule without an address",
+			canaryConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"weight": 10
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid canary for selector "endpoints.examples.bookstore.Bookstore": no address`,
+		},
+		{
+			desc: "Fail with override header without a value",
+			canaryConfig: `{
+				"address": "http://bookstore-canary:8080",
+				"override_header": {"key": "x-canary"}
+			}`,
+			wantedErrorMsg: "canary override header must have a key and a value",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.canaryConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.CanaryConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantCanary, serviceInfo.Canary); diff != "" {
+			t.Errorf("Test Desc(%d): %s, global canary diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if diff := cmp.Diff(tc.wantOverrideHeader, serviceInfo.CanaryOverrideHeader); diff != "" {
+			t.Errorf("Test Desc(%d): %s, canary override header diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if diff := cmp.Diff(tc.wantClusters, serviceInfo.CanaryClusters); diff != "" {
+			t.Errorf("Test Desc(%d): %s, canary clusters diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		gotMethodCanaries := make(map[string]*Canary)
+		for operation, method := range serviceInfo.Methods {
+			if method.Canary != nil {
+				gotMethodCanaries[operation] = method.Canary
+			}
+		}
+		if diff := cmp.Diff(tc.wantMethodCanaries, gotMethodCanaries); diff != "" {
+			t.Errorf("Test Desc(%d): %s, method canaries diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// configFile is the content of a JSON config file of a feature, such as the
+// file of --cors_config_path.
+type configFile interface {
+	// process validates the content and sets what applies to the whole
+	// service. It returns the rules to apply to the methods they select, if
+	// the feature has any.
+	process(s *ServiceInfo) ([]selectorRule, error)
+}
+
+// selectorRule is a rule of a config file, applied to the methods selected by
+// its selector.
+type selectorRule interface {
+	selector() string
+	apply(method *methodInfo) error
+}
+
+// ruleSelector is embedded in the rules of the config files.
+type ruleSelector struct {
+	// Operation name or API name the rule applies to.
+	Selector string `json:"selector"`
+}
+
+func (r *ruleSelector) selector() string {
+	return r.Selector
+}
+
+// processConfigFile reads the config file at path into cfg, processes it and
+// applies its rules to the methods they select. Nothing is done without a
+// path.
+func (s *ServiceInfo) processConfigFile(path string, cfg configFile) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := readJsonConfigFile(path, cfg); err != nil {
+		return err
+	}
+	rules, err := cfg.process(s)
+	if err != nil {
+		return err
+	}
+
+	var selectors []string
+	for _, rule := range rules {
+		selectors = append(selectors, rule.selector())
+	}
+	return s.applySelectorRules(selectors, func(i int, method *methodInfo) error {
+		return rules[i].apply(method)
+	})
+}
+
+// applySelectorRules calls apply for every method selected by selectors[i].
+// A selector is either an operation name or an API name, which selects all
+// the methods of that API. Rules selecting an API are applied before rules
+// selecting an operation, so the most specific rule wins.
+func (s *ServiceInfo) applySelectorRules(selectors []string, apply func(i int, method *methodInfo) error) error {
+	isApiName := make(map[string]bool)
+	for _, apiName := range s.ApiNames {
+		isApiName[apiName] = true
+	}
+
+	var operationRules []int
+	for i, selector := range selectors {
+		if !isApiName[selector] {
+			operationRules = append(operationRules, i)
+			continue
+		}
+		for _, method := range s.Methods {
+			if method.ApiName == selector && !method.IsGenerated {
+				if err := apply(i, method); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, i := range operationRules {
+		method, ok := s.Methods[selectors[i]]
+		if !ok {
+			return fmt.Errorf("selector %q does not match any operation or API", selectors[i])
+		}
+		if err := apply(i, method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJsonConfigFile reads the JSON file at path into v. Unknown fields are
+// rejected so typos in the file are not silently ignored.
+func readJsonConfigFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("fail to read config file %s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("fail to parse config file %s: %v", path, err)
+	}
+	return nil
+}
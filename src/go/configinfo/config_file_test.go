@@ -0,0 +1,236 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+// newTestServiceConfig returns a service config with an API of two operations,
+// ListShelves and CreateShelf, which the tests of the config files select.
+func newTestServiceConfig() *confpb.Service {
+	return &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+}
+
+func writeTempConfigFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// processTestConfigFile makes the ServiceInfo of serviceConfig with a config
+// file of content, whose path setOptions sets with any other options.
+func processTestConfigFile(t *testing.T, serviceConfig *confpb.Service, content string, setOptions func(opts *options.ConfigGeneratorOptions, path string)) (*ServiceInfo, error) {
+	path := writeTempConfigFile(t, content)
+	defer os.Remove(path)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	setOptions(&opts, path)
+	return NewServiceInfoFromServiceConfig(serviceConfig, testConfigID, opts)
+}
+
+// testConfig is a config file recording the values its rules apply to the
+// methods, keyed by short name.
+type testConfig struct {
+	Value string            `json:"value"`
+	Rules []*testConfigRule `json:"rules"`
+
+	applied map[string]string
+}
+
+type testConfigRule struct {
+	ruleSelector
+	Value string `json:"value"`
+
+	applied map[string]string
+}
+
+func (c *testConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	if c.Value == "invalid" {
+		return nil, fmt.Errorf("invalid value")
+	}
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		rule.applied = c.applied
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *testConfigRule) apply(method *methodInfo) error {
+	if r.Value == "" {
+		return fmt.Errorf("rule for selector %q has no value", r.Selector)
+	}
+	r.applied[method.ShortName] = r.Value
+	return nil
+}
+
+func TestProcessConfigFile(t *testing.T) {
+	testData := []struct {
+		desc           string
+		noConfigFile   bool
+		configFile     string
+		wantApplied    map[string]string
+		wantedErrorMsg string
+	}{
+		{
+			desc:         "Nothing is applied without a config file",
+			noConfigFile: true,
+			wantApplied:  map[string]string{},
+		},
+		{
+			desc: "Rule for an API applies to its methods",
+			configFile: `{
+				"rules": [
+					{"selector": "endpoints.examples.bookstore.Bookstore", "value": "api"}
+				]
+			}`,
+			wantApplied: map[string]string{
+				"ListShelves": "api",
+				"CreateShelf": "api",
+			},
+		},
+		{
+			desc: "Rule for an operation overrides the rule for its API in any order",
+			configFile: `{
+				"rules": [
+					{"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "value": "operation"},
+					{"selector": "endpoints.examples.bookstore.Bookstore", "value": "api"}
+				]
+			}`,
+			wantApplied: map[string]string{
+				"ListShelves": "api",
+				"CreateShelf": "operation",
+			},
+		},
+		{
+			desc:        "Config file without rules",
+			configFile:  `{"value": "global"}`,
+			wantApplied: map[string]string{},
+		},
+		{
+			desc: "Fail with unknown selector",
+			configFile: `{
+				"rules": [
+					{"selector": "endpoints.examples.bookstore.Bookstore.GetBook", "value": "operation"}
+				]
+			}`,
+			wantedErrorMsg: `selector "endpoints.examples.bookstore.Bookstore.GetBook" does not match any operation or API`,
+		},
+		{
+			desc: "Fail with unknown field",
+			configFile: `{
+				"rules": [
+					{"selector": "endpoints.examples.bookstore.Bookstore", "valeu": "api"}
+				]
+			}`,
+			wantedErrorMsg: `unknown field "valeu"`,
+		},
+		{
+			desc:           "Fail with invalid JSON",
+			configFile:     `{"rules": [`,
+			wantedErrorMsg: "fail to parse config file",
+		},
+		{
+			desc:           "Fail with an error of the config file",
+			configFile:     `{"value": "invalid"}`,
+			wantedErrorMsg: "invalid value",
+		},
+		{
+			desc: "Fail with an error of a rule",
+			configFile: `{
+				"rules": [
+					{"selector": "endpoints.examples.bookstore.Bookstore.ListShelves"}
+				]
+			}`,
+			wantedErrorMsg: `rule for selector "endpoints.examples.bookstore.Bookstore.ListShelves" has no value`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := NewServiceInfoFromServiceConfig(newTestServiceConfig(), testConfigID, options.DefaultConfigGeneratorOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var path string
+		if !tc.noConfigFile {
+			path = writeTempConfigFile(t, tc.configFile)
+			defer os.Remove(path)
+		}
+		cfg := &testConfig{
+			applied: make(map[string]string),
+		}
+		err = serviceInfo.processConfigFile(path, cfg)
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test Desc(%d): %s, got error: %v, want no error", i, tc.desc, err)
+			continue
+		}
+
+		if diff := cmp.Diff(tc.wantApplied, cfg.applied); diff != "" {
+			t.Errorf("Test Desc(%d): %s, applied values diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
+
+func TestProcessConfigFileWithMissingFile(t *testing.T) {
+	serviceInfo, err := NewServiceInfoFromServiceConfig(newTestServiceConfig(), testConfigID, options.DefaultConfigGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = serviceInfo.processConfigFile("/no/such/config.json", &testConfig{})
+	wantError := "fail to read config file /no/such/config.json"
+	if err == nil || !strings.Contains(err.Error(), wantError) {
+		t.Errorf("got error: %v, want error: %s", err, wantError)
+	}
+}
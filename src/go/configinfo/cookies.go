@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// processJwtCookies reads the cookies set by --jwt_cookies, which JWTs of the
+// authentication providers are also read from, besides their JWT locations.
+// The service config cannot set cookie locations, as JwtLocation and
+// SystemParameter have no cookie fields in the service config protos. As the
+// other credential locations, the cookie names are ignored by the transcoder.
+func (s *ServiceInfo) processJwtCookies() error {
+	if s.Options.JwtCookies == "" {
+		return nil
+	}
+	if s.Options.SkipJwtAuthnFilter {
+		return fmt.Errorf("JWT cookies cannot be used when JWT Authn filter is skipped")
+	}
+
+	providerIds := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providerIds[provider.GetId()] = true
+	}
+
+	s.JwtCookies = make(map[string][]string)
+	for _, jwtCookie := range strings.Split(s.Options.JwtCookies, ",") {
+		parts := strings.SplitN(strings.TrimSpace(jwtCookie), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("invalid JWT cookie %q, must be provider_id=cookie_name", jwtCookie)
+		}
+		if !providerIds[parts[0]] {
+			return fmt.Errorf("JWT cookie is set for authentication provider %q, which is not in the service config", parts[0])
+		}
+		if err := validateCookieName(parts[1]); err != nil {
+			return err
+		}
+		s.JwtCookies[parts[0]] = append(s.JwtCookies[parts[0]], parts[1])
+		s.AllTranscodingIgnoredQueryParams[parts[1]] = true
+	}
+	return nil
+}
+
+// parseApiKeyCookies returns the cookies set by --api_key_cookies, which API
+// keys are also read from.
+func (s *ServiceInfo) parseApiKeyCookies() ([]string, error) {
+	if s.Options.ApiKeyCookies == "" {
+		return nil, nil
+	}
+
+	var cookies []string
+	for _, cookie := range strings.Split(s.Options.ApiKeyCookies, ",") {
+		cookie = strings.TrimSpace(cookie)
+		if err := validateCookieName(cookie); err != nil {
+			return nil, err
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies, nil
+}
+
+// validateCookieName checks the name is a token, as required by RFC 6265.
+func validateCookieName(name string) error {
+	if name == "" {
+		return fmt.Errorf("cookie name cannot be empty")
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, c) {
+			return fmt.Errorf("invalid cookie name %q", name)
+		}
+	}
+	return nil
+}
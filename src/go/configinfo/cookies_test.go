@@ -0,0 +1,249 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessJwtCookies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0/jwks",
+				},
+				{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer-1",
+					JwksUri: "https://issuer-1/jwks",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc           string
+		jwtCookies     string
+		skipJwtAuthn   bool
+		wantJwtCookies map[string][]string
+		// Query params ignored by the transcoder, besides the default ones.
+		wantIgnoredQueryParams []string
+		wantedErrorMsg         string
+	}{
+		{
+			desc:       "Cookies of providers",
+			jwtCookies: "auth_provider_0=session, auth_provider_1=id_token,auth_provider_0=__Host-session",
+			wantJwtCookies: map[string][]string{
+				"auth_provider_0": {"session", "__Host-session"},
+				"auth_provider_1": {"id_token"},
+			},
+			wantIgnoredQueryParams: []string{"session", "__Host-session", "id_token"},
+		},
+		{
+			desc:           "Fail with a missing cookie name",
+			jwtCookies:     "auth_provider_0",
+			wantedErrorMsg: `invalid JWT cookie "auth_provider_0", must be provider_id=cookie_name`,
+		},
+		{
+			desc:           "Fail with an invalid cookie name",
+			jwtCookies:     "auth_provider_0=my session",
+			wantedErrorMsg: `invalid cookie name "my session"`,
+		},
+		{
+			desc:           "Fail with an unknown provider",
+			jwtCookies:     "auth_provider_2=session",
+			wantedErrorMsg: `JWT cookie is set for authentication provider "auth_provider_2", which is not in the service config`,
+		},
+		{
+			desc:           "Fail when JWT Authn filter is skipped",
+			jwtCookies:     "auth_provider_0=session",
+			skipJwtAuthn:   true,
+			wantedErrorMsg: "JWT cookies cannot be used when JWT Authn filter is skipped",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtCookies = tc.jwtCookies
+		opts.SkipJwtAuthnFilter = tc.skipJwtAuthn
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantJwtCookies, serviceInfo.JwtCookies); diff != "" {
+			t.Errorf("Test Desc(%d): %s, JWT cookies diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		for _, param := range tc.wantIgnoredQueryParams {
+			if !serviceInfo.AllTranscodingIgnoredQueryParams[param] {
+				t.Errorf("Test Desc(%d): %s, query param %q is not ignored by the transcoder", i, tc.desc, param)
+			}
+		}
+	}
+}
+
+func TestProcessApiKeyCookies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		SystemParameters: &confpb.SystemParameters{
+			Rules: []*confpb.SystemParameterRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Parameters: []*confpb.SystemParameter{
+						{
+							Name:       "api_key",
+							HttpHeader: "x-custom-key",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                string
+		apiKeyCookies       string
+		wantApiKeyLocations map[string][]*scpb.ApiKeyLocation
+		// Query params ignored by the transcoder, besides the default ones.
+		wantIgnoredQueryParams []string
+		wantedErrorMsg         string
+	}{
+		{
+			desc:          "Cookies after the locations in the service config or the default ones",
+			apiKeyCookies: "api-key,session-key",
+			wantApiKeyLocations: map[string][]*scpb.ApiKeyLocation{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": append(defaultApiKeyLocations(),
+					&scpb.ApiKeyLocation{
+						Key: &scpb.ApiKeyLocation_Cookie{
+							Cookie: "api-key",
+						},
+					},
+					&scpb.ApiKeyLocation{
+						Key: &scpb.ApiKeyLocation_Cookie{
+							Cookie: "session-key",
+						},
+					},
+				),
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Key: &scpb.ApiKeyLocation_Header{
+							Header: "x-custom-key",
+						},
+					},
+					{
+						Key: &scpb.ApiKeyLocation_Cookie{
+							Cookie: "api-key",
+						},
+					},
+					{
+						Key: &scpb.ApiKeyLocation_Cookie{
+							Cookie: "session-key",
+						},
+					},
+				},
+			},
+			wantIgnoredQueryParams: []string{"api-key", "session-key"},
+		},
+		{
+			desc: "Default locations are implicit without cookies",
+			wantApiKeyLocations: map[string][]*scpb.ApiKeyLocation{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Key: &scpb.ApiKeyLocation_Header{
+							Header: "x-custom-key",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:           "Fail with an empty cookie name",
+			apiKeyCookies:  "api-key,",
+			wantedErrorMsg: "cookie name cannot be empty",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ApiKeyCookies = tc.apiKeyCookies
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotApiKeyLocations := make(map[string][]*scpb.ApiKeyLocation)
+		for operation, method := range serviceInfo.Methods {
+			if method.ApiKeyLocations != nil {
+				gotApiKeyLocations[operation] = method.ApiKeyLocations
+			}
+		}
+		if diff := cmp.Diff(tc.wantApiKeyLocations, gotApiKeyLocations, cmp.Comparer(proto.Equal)); diff != "" {
+			t.Errorf("Test Desc(%d): %s, API key locations diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		for _, param := range tc.wantIgnoredQueryParams {
+			if !serviceInfo.AllTranscodingIgnoredQueryParams[param] {
+				t.Errorf("Test Desc(%d): %s, query param %q is not ignored by the transcoder", i, tc.desc, param)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	ptypepb "google.golang.org/genproto/protobuf/ptype"
+)
+
+// CorsPolicyOptionName is the name of the option of the APIs and methods in
+// the service config that sets their CORS policy. Its value is a
+// google.protobuf.Struct with the fields of CorsPolicy.
+const CorsPolicyOptionName = "espv2.cors_policy"
+
+// CorsPolicy is the CORS policy applied to the routes of a method.
+type CorsPolicy struct {
+	AllowOrigin      string `json:"allow_origin"`
+	AllowOriginRegex string `json:"allow_origin_regex"`
+	AllowMethods     string `json:"allow_methods"`
+	AllowHeaders     string `json:"allow_headers"`
+	ExposeHeaders    string `json:"expose_headers"`
+	AllowCredentials bool   `json:"allow_credentials"`
+}
+
+// corsConfig is the format of the file specified by --cors_config_path.
+//
+// Example:
+//
+//	{
+//	  "policies": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore",
+//	      "allow_origin": "https://www.example.com",
+//	      "allow_headers": "Authorization,Content-Type"
+//	    },
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Internal.ListUsers",
+//	      "allow_origin_regex": "^https://.+\\.corp\\.example\\.com$"
+//	    }
+//	  ]
+//	}
+//
+// The policies of the file override the ones set by the CorsPolicyOptionName
+// options of the service config.
+type corsConfig struct {
+	Policies []*corsPolicyRule `json:"policies"`
+}
+
+type corsPolicyRule struct {
+	ruleSelector
+	CorsPolicy
+}
+
+func (s *ServiceInfo) processCorsConfig() error {
+	if err := s.processCorsOptions(); err != nil {
+		return err
+	}
+	return s.processConfigFile(s.Options.CorsConfigPath, &corsConfig{})
+}
+
+// processCorsOptions sets the CORS policies of the methods from the options
+// of the service config. The option of a method overrides the one of its API.
+func (s *ServiceInfo) processCorsOptions() error {
+	for _, api := range s.ServiceConfig().GetApis() {
+		apiPolicy, err := corsPolicyFromOptions(api.GetName(), api.GetOptions())
+		if err != nil {
+			return err
+		}
+		for _, method := range api.GetMethods() {
+			selector := fmt.Sprintf("%s.%s", api.GetName(), method.GetName())
+			policy, err := corsPolicyFromOptions(selector, method.GetOptions())
+			if err != nil {
+				return err
+			}
+			if policy == nil {
+				policy = apiPolicy
+			}
+			s.Methods[selector].CorsPolicy = policy
+		}
+	}
+	return nil
+}
+
+func corsPolicyFromOptions(selector string, opts []*ptypepb.Option) (*CorsPolicy, error) {
+	for _, opt := range opts {
+		if opt.GetName() != CorsPolicyOptionName {
+			continue
+		}
+		value := &structpb.Struct{}
+		if err := ptypes.UnmarshalAny(opt.GetValue(), value); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal option %s of %s: %v", CorsPolicyOptionName, selector, err)
+		}
+		data, err := (&jsonpb.Marshaler{}).MarshalToString(value)
+		if err != nil {
+			return nil, fmt.Errorf("fail to marshal option %s of %s: %v", CorsPolicyOptionName, selector, err)
+		}
+		policy := &CorsPolicy{}
+		decoder := json.NewDecoder(strings.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(policy); err != nil {
+			return nil, fmt.Errorf("fail to parse option %s of %s: %v", CorsPolicyOptionName, selector, err)
+		}
+		if err := policy.validate(selector); err != nil {
+			return nil, err
+		}
+		return policy, nil
+	}
+	return nil, nil
+}
+
+func (c *corsConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	var rules []selectorRule
+	for _, rule := range c.Policies {
+		if err := rule.validate(rule.Selector); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *corsPolicyRule) apply(method *methodInfo) error {
+	policy := r.CorsPolicy
+	method.CorsPolicy = &policy
+	return nil
+}
+
+func (p *CorsPolicy) validate(selector string) error {
+	if (p.AllowOrigin == "") == (p.AllowOriginRegex == "") {
+		return fmt.Errorf("CORS policy for selector %q must set exactly one of allow_origin and allow_origin_regex", selector)
+	}
+	return nil
+}
+
+// sameCorsPolicy returns whether a and b are the same policy, or both nil.
+func sameCorsPolicy(a, b *CorsPolicy) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,379 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	ptypepb "google.golang.org/genproto/protobuf/ptype"
+)
+
+func TestProcessCorsConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/shelves",
+				},
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				Pattern: &annotationspb.HttpRule_Post{
+					Post: "/shelves/{shelf}",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc           string
+		corsConfig     string
+		wantPolicies   map[string]*CorsPolicy
+		wantedErrorMsg string
+	}{
+		{
+			desc: "Policy for an API applies to its methods and generated OPTIONS methods",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"allow_origin": "https://public.example.com",
+						"allow_methods": "GET,POST"
+					}
+				]
+			}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					AllowOrigin:  "https://public.example.com",
+					AllowMethods: "GET,POST",
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					AllowOrigin:  "https://public.example.com",
+					AllowMethods: "GET,POST",
+				},
+				"endpoints.examples.bookstore.Bookstore.CORS_shelves": {
+					AllowOrigin:  "https://public.example.com",
+					AllowMethods: "GET,POST",
+				},
+				"endpoints.examples.bookstore.Bookstore.CORS_shelves_shelf": {
+					AllowOrigin:  "https://public.example.com",
+					AllowMethods: "GET,POST",
+				},
+			},
+		},
+		{
+			desc: "Policy for an operation overrides the policy for its API",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"allow_origin_regex": "^https://.+\\.corp\\.example\\.com$",
+						"allow_credentials": true
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"allow_origin": "https://public.example.com"
+					}
+				]
+			}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					AllowOriginRegex: `^https://.+\.corp\.example\.com$`,
+					AllowCredentials: true,
+				},
+				"endpoints.examples.bookstore.Bookstore.CORS_shelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+				"endpoints.examples.bookstore.Bookstore.CORS_shelves_shelf": {
+					AllowOriginRegex: `^https://.+\.corp\.example\.com$`,
+					AllowCredentials: true,
+				},
+			},
+		},
+		{
+			desc: "Policy for a single operation",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+						"allow_origin": "https://public.example.com"
+					}
+				]
+			}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+				"endpoints.examples.bookstore.Bookstore.CORS_shelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+			},
+		},
+		{
+			desc: "Fail with both allow_origin and allow_origin_regex",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"allow_origin": "https://public.example.com",
+						"allow_origin_regex": ".*"
+					}
+				]
+			}`,
+			wantedErrorMsg: `CORS policy for selector "endpoints.examples.bookstore.Bookstore" must set exactly one of allow_origin and allow_origin_regex`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.corsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.CorsConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotPolicies := make(map[string]*CorsPolicy)
+		for operation, method := range serviceInfo.Methods {
+			if method.CorsPolicy != nil {
+				gotPolicies[operation] = method.CorsPolicy
+			}
+		}
+		if diff := cmp.Diff(tc.wantPolicies, gotPolicies); diff != "" {
+			t.Errorf("Test Desc(%d): %s, CORS policies diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
+
+func TestProcessCorsOptions(t *testing.T) {
+	testData := []struct {
+		desc           string
+		apiOption      string
+		methodOption   string
+		corsConfig     string
+		wantPolicies   map[string]*CorsPolicy
+		wantedErrorMsg string
+	}{
+		{
+			desc:         "Option of a method overrides the option of its API",
+			apiOption:    `{"allow_origin": "https://public.example.com"}`,
+			methodOption: `{"allow_origin_regex": "^https://.+\\.corp\\.example\\.com$", "allow_credentials": true}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					AllowOriginRegex: `^https://.+\.corp\.example\.com$`,
+					AllowCredentials: true,
+				},
+			},
+		},
+		{
+			desc:      "Config file overrides the options",
+			apiOption: `{"allow_origin": "https://public.example.com"}`,
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"allow_origin": "https://admin.example.com"
+					}
+				]
+			}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					AllowOrigin: "https://public.example.com",
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					AllowOrigin: "https://admin.example.com",
+				},
+			},
+		},
+		{
+			desc:           "Fail with an option without origin",
+			methodOption:   `{"allow_methods": "GET"}`,
+			wantedErrorMsg: `CORS policy for selector "endpoints.examples.bookstore.Bookstore.CreateShelf" must set exactly one of allow_origin and allow_origin_regex`,
+		},
+		{
+			desc:           "Fail with an unknown field in the option",
+			apiOption:      `{"allow_origin": "https://public.example.com", "allow_origins": "https://admin.example.com"}`,
+			wantedErrorMsg: `fail to parse option espv2.cors_policy of endpoints.examples.bookstore.Bookstore`,
+		},
+	}
+
+	for i, tc := range testData {
+		fakeServiceConfig := newTestServiceConfig()
+		if tc.apiOption != "" {
+			fakeServiceConfig.Apis[0].Options = []*ptypepb.Option{makeCorsPolicyOption(t, tc.apiOption)}
+		}
+		if tc.methodOption != "" {
+			fakeServiceConfig.Apis[0].Methods[1].Options = []*ptypepb.Option{makeCorsPolicyOption(t, tc.methodOption)}
+		}
+
+		opts := options.DefaultConfigGeneratorOptions()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.corsConfig != "" {
+			serviceInfo, err = processTestConfigFile(t, fakeServiceConfig, tc.corsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+				opts.CorsConfigPath = path
+			})
+		}
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotPolicies := make(map[string]*CorsPolicy)
+		for operation, method := range serviceInfo.Methods {
+			if method.CorsPolicy != nil {
+				gotPolicies[operation] = method.CorsPolicy
+			}
+		}
+		if diff := cmp.Diff(tc.wantPolicies, gotPolicies); diff != "" {
+			t.Errorf("Test Desc(%d): %s, CORS policies diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
+
+func makeCorsPolicyOption(t *testing.T, policy string) *ptypepb.Option {
+	value := &structpb.Struct{}
+	if err := jsonpb.UnmarshalString(policy, value); err != nil {
+		t.Fatal(err)
+	}
+	valueAny, err := ptypes.MarshalAny(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ptypepb.Option{
+		Name:  CorsPolicyOptionName,
+		Value: valueAny,
+	}
+}
+
+func TestProcessCorsConfigWithSharedUrl(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/shelves",
+				},
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				Pattern: &annotationspb.HttpRule_Post{
+					Post: "/shelves",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		corsConfig       string
+		wantOptionPolicy *CorsPolicy
+		wantedErrorMsg   string
+	}{
+		{
+			desc: "Methods of a url with the same policy",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"allow_origin": "https://public.example.com"
+					}
+				]
+			}`,
+			wantOptionPolicy: &CorsPolicy{
+				AllowOrigin: "https://public.example.com",
+			},
+		},
+		{
+			desc: "Only one method of a url with a policy",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"allow_origin": "https://public.example.com"
+					}
+				]
+			}`,
+			wantOptionPolicy: &CorsPolicy{
+				AllowOrigin: "https://public.example.com",
+			},
+		},
+		{
+			desc: "Fail with different policies for the methods of a url",
+			corsConfig: `{
+				"policies": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"allow_origin": "https://public.example.com"
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"allow_origin": "https://admin.example.com"
+					}
+				]
+			}`,
+			wantedErrorMsg: "methods endpoints.examples.bookstore.Bookstore.ListShelves and endpoints.examples.bookstore.Bookstore.CreateShelf share the url /shelves but have different CORS policies",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.corsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.CorsConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		optionMethod := serviceInfo.Methods["endpoints.examples.bookstore.Bookstore.CORS_shelves"]
+		if optionMethod == nil {
+			t.Fatalf("Test Desc(%d): %s, no OPTIONS method for /shelves", i, tc.desc)
+		}
+		if diff := cmp.Diff(tc.wantOptionPolicy, optionMethod.CorsPolicy); diff != "" {
+			t.Errorf("Test Desc(%d): %s, CORS policy diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// ExtAuthz is an external authorization service that must approve the
+// requests before they are sent to the backend.
+type ExtAuthz struct {
+	Cluster *BackendRoutingCluster
+	// Address of an HTTP service, whose path is prefixed to the checked paths.
+	Uri        string
+	PathPrefix string
+	Timeout    time.Duration
+	// Whether requests are allowed when the service fails or cannot be
+	// reached. Otherwise they are rejected with 403.
+	FailOpen bool
+	// Request headers sent to an HTTP service, besides the default ones.
+	ForwardHeaders []string
+}
+
+// extAuthzConfig is the format of the file specified by
+// --ext_authz_config_path.
+//
+// Example:
+//
+//	{
+//	  "address": "http://policy-engine:8080/authz",
+//	  "timeout": "500ms",
+//	  "fail_open": false,
+//	  "forward_headers": ["x-request-id"],
+//	  "rules": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore",
+//	      "disabled": true
+//	    },
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+//	      "disabled": false
+//	    }
+//	  ]
+//	}
+//
+// All the requests are checked by default, and rules for an operation or API
+// turn the checks off or back on. gRPC services (grpc:// or grpcs://) get all
+// the request headers and the verified JWT payloads in the CheckRequest. HTTP
+// services get the default headers, the forwarded ones and the header with the
+// verified JWT payload.
+type extAuthzConfig struct {
+	Address        string          `json:"address"`
+	Timeout        string          `json:"timeout"`
+	FailOpen       bool            `json:"fail_open"`
+	ForwardHeaders []string        `json:"forward_headers"`
+	Rules          []*extAuthzRule `json:"rules"`
+}
+
+type extAuthzRule struct {
+	ruleSelector
+	Disabled bool `json:"disabled"`
+}
+
+const defaultExtAuthzTimeout = time.Second
+
+func (s *ServiceInfo) processExtAuthzConfig() error {
+	return s.processConfigFile(s.Options.ExtAuthzConfigPath, &extAuthzConfig{})
+}
+
+func (c *extAuthzConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	scheme, hostname, port, path, err := util.ParseURI(c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing external authorization address: %v", err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid external authorization address: %v", err)
+	}
+
+	extAuthz := &ExtAuthz{
+		Cluster: &BackendRoutingCluster{
+			ClusterName: util.ExtAuthzClusterName,
+			Hostname:    hostname,
+			Port:        port,
+			UseTLS:      tls,
+			Protocol:    protocol,
+		},
+		Timeout:  defaultExtAuthzTimeout,
+		FailOpen: c.FailOpen,
+	}
+	if c.Timeout != "" {
+		extAuthz.Timeout, err = time.ParseDuration(c.Timeout)
+		if err != nil || extAuthz.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid external authorization timeout %q, must be a positive duration such as \"500ms\"", c.Timeout)
+		}
+	}
+
+	if protocol == util.GRPC {
+		if path != "" {
+			return nil, fmt.Errorf("external authorization address of a gRPC service cannot have a path")
+		}
+		if len(c.ForwardHeaders) > 0 {
+			return nil, fmt.Errorf("forward_headers only applies to HTTP external authorization services, gRPC ones get all the request headers")
+		}
+	} else {
+		extAuthz.Uri = fmt.Sprintf("%s://%s:%d%s", scheme, hostname, port, path)
+		extAuthz.PathPrefix = path
+		for _, header := range c.ForwardHeaders {
+			if header == "" {
+				return nil, fmt.Errorf("header name cannot be empty in forward_headers")
+			}
+		}
+		extAuthz.ForwardHeaders = c.ForwardHeaders
+	}
+	s.ExtAuthz = extAuthz
+
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *extAuthzRule) apply(method *methodInfo) error {
+	method.ExtAuthzDisabled = r.Disabled
+	return nil
+}
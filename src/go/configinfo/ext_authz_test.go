@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessExtAuthzConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc                string
+		extAuthzConfig      string
+		wantExtAuthz        *ExtAuthz
+		wantDisabledMethods map[string]bool
+		wantedErrorMsg      string
+	}{
+		{
+			desc: "HTTP service with path prefix, disabled for an API and enabled back for an operation",
+			extAuthzConfig: `{
+				"address": "http://policy-engine:8080/authz",
+				"timeout": "500ms",
+				"forward_headers": ["x-request-id"],
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"disabled": true
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"disabled": false
+					}
+				]
+			}`,
+			wantExtAuthz: &ExtAuthz{
+				Cluster: &BackendRoutingCluster{
+					ClusterName: util.ExtAuthzClusterName,
+					Hostname:    "policy-engine",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+				Uri:            "http://policy-engine:8080/authz",
+				PathPrefix:     "/authz",
+				Timeout:        500 * time.Millisecond,
+				ForwardHeaders: []string{"x-request-id"},
+			},
+			wantDisabledMethods: map[string]bool{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": true,
+			},
+		},
+		{
+			desc: "gRPC service failing open with default timeout",
+			extAuthzConfig: `{
+				"address": "grpcs://policy-engine",
+				"fail_open": true
+			}`,
+			wantExtAuthz: &ExtAuthz{
+				Cluster: &BackendRoutingCluster{
+					ClusterName: util.ExtAuthzClusterName,
+					Hostname:    "policy-engine",
+					Port:        443,
+					UseTLS:      true,
+					Protocol:    util.GRPC,
+				},
+				Timeout:  time.Second,
+				FailOpen: true,
+			},
+			wantDisabledMethods: map[string]bool{},
+		},
+		{
+			desc: "Fail with invalid address",
+			extAuthzConfig: `{
+				"address": "ftp://policy-engine"
+			}`,
+			wantedErrorMsg: "invalid external authorization address: unknown backend scheme [ftp]",
+		},
+		{
+			desc: "Fail with invalid timeout",
+			extAuthzConfig: `{
+				"address": "http://policy-engine:8080",
+				"timeout": "-1s"
+			}`,
+			wantedErrorMsg: `invalid external authorization timeout "-1s"`,
+		},
+		{
+			desc: "Fail with forwarded headers for gRPC service",
+			extAuthzConfig: `{
+				"address": "grpc://policy-engine:9000",
+				"forward_headers": ["x-request-id"]
+			}`,
+			wantedErrorMsg: "forward_headers only applies to HTTP external authorization services",
+		},
+		{
+			desc: "Fail with path for gRPC service",
+			extAuthzConfig: `{
+				"address": "grpc://policy-engine:9000/authz"
+			}`,
+			wantedErrorMsg: "external authorization address of a gRPC service cannot have a path",
+		},
+		{
+			desc: "Fail with empty forwarded header",
+			extAuthzConfig: `{
+				"address": "http://policy-engine:8080",
+				"forward_headers": [""]
+			}`,
+			wantedErrorMsg: "header name cannot be empty in forward_headers",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.extAuthzConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.ExtAuthzConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantExtAuthz, serviceInfo.ExtAuthz); diff != "" {
+			t.Errorf("Test Desc(%d): %s, external authorization diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		gotDisabledMethods := make(map[string]bool)
+		for operation, method := range serviceInfo.Methods {
+			if method.ExtAuthzDisabled {
+				gotDisabledMethods[operation] = true
+			}
+		}
+		if diff := cmp.Diff(tc.wantDisabledMethods, gotDisabledMethods); diff != "" {
+			t.Errorf("Test Desc(%d): %s, methods with external authorization disabled diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
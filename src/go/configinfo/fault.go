@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Fault is a delay or an abort injected into the requests to a method.
+type Fault struct {
+	// Delay before the request is sent to the backend, 0 if not delayed.
+	Delay           time.Duration
+	DelayPercentage uint32
+	// HTTP status of the aborted requests, 0 if not aborted.
+	AbortHttpStatus uint32
+	AbortPercentage uint32
+	// Faults are only injected into the requests with all these headers.
+	Headers []*HeaderValue
+}
+
+// faultConfig is the format of the file specified by --fault_config_path.
+//
+// Example:
+//
+//	{
+//	  "faults": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.GetShelf",
+//	      "delay": {"fixed_delay": "2s", "percentage": 50},
+//	      "abort": {"grpc_status": "UNAVAILABLE", "percentage": 10},
+//	      "headers": [{"key": "x-chaos-test", "value": "true"}]
+//	    }
+//	  ]
+//	}
+//
+// Percentages default to 100. With headers, faults are only injected into
+// requests that have them, so test clients can ask for faults.
+type faultConfig struct {
+	Faults []*faultRule `json:"faults"`
+}
+
+type faultRule struct {
+	ruleSelector
+	Delay   *faultDelay    `json:"delay"`
+	Abort   *faultAbort    `json:"abort"`
+	Headers []*HeaderValue `json:"headers"`
+
+	fault *Fault
+}
+
+type faultDelay struct {
+	FixedDelay string  `json:"fixed_delay"`
+	Percentage *uint32 `json:"percentage"`
+}
+
+type faultAbort struct {
+	HttpStatus uint32  `json:"http_status"`
+	GrpcStatus string  `json:"grpc_status"`
+	Percentage *uint32 `json:"percentage"`
+}
+
+// Envoy aborts requests with an HTTP status, and gRPC requests get the gRPC
+// status mapped from it. These are the gRPC statuses that can be injected, and
+// the HTTP statuses they are mapped from.
+var faultGrpcStatuses = map[string]uint32{
+	"INTERNAL":          400,
+	"UNAUTHENTICATED":   401,
+	"PERMISSION_DENIED": 403,
+	"UNIMPLEMENTED":     404,
+	"UNKNOWN":           500,
+	"UNAVAILABLE":       503,
+}
+
+func (s *ServiceInfo) processFaultConfig() error {
+	return s.processConfigFile(s.Options.FaultConfigPath, &faultConfig{})
+}
+
+func (c *faultConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	var rules []selectorRule
+	for _, rule := range c.Faults {
+		fault, err := makeFault(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault for selector %q: %v", rule.Selector, err)
+		}
+		rule.fault = fault
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *faultRule) apply(method *methodInfo) error {
+	method.Fault = r.fault
+	return nil
+}
+
+func makeFault(rule *faultRule) (*Fault, error) {
+	if rule.Delay == nil && rule.Abort == nil {
+		return nil, fmt.Errorf("must have a delay or an abort")
+	}
+	for _, header := range rule.Headers {
+		if header.Key == "" {
+			return nil, fmt.Errorf("header name cannot be empty")
+		}
+	}
+
+	fault := &Fault{
+		Headers: rule.Headers,
+	}
+	var err error
+	if delay := rule.Delay; delay != nil {
+		fault.Delay, err = time.ParseDuration(delay.FixedDelay)
+		if err != nil || fault.Delay <= 0 {
+			return nil, fmt.Errorf("invalid fixed delay %q, must be a positive duration such as \"1.5s\"", delay.FixedDelay)
+		}
+		if fault.DelayPercentage, err = faultPercentage(delay.Percentage); err != nil {
+			return nil, err
+		}
+	}
+
+	if abort := rule.Abort; abort != nil {
+		switch {
+		case abort.HttpStatus != 0 && abort.GrpcStatus != "":
+			return nil, fmt.Errorf("abort cannot have both an HTTP status and a gRPC status")
+		case abort.GrpcStatus != "":
+			status, ok := faultGrpcStatuses[abort.GrpcStatus]
+			if !ok {
+				return nil, fmt.Errorf("gRPC status %q cannot be injected, must be one of INTERNAL, UNAUTHENTICATED, PERMISSION_DENIED, UNIMPLEMENTED, UNKNOWN and UNAVAILABLE", abort.GrpcStatus)
+			}
+			fault.AbortHttpStatus = status
+		case abort.HttpStatus >= 200 && abort.HttpStatus < 600:
+			fault.AbortHttpStatus = abort.HttpStatus
+		default:
+			return nil, fmt.Errorf("invalid abort HTTP status %d, must be between 200 and 599", abort.HttpStatus)
+		}
+		if fault.AbortPercentage, err = faultPercentage(abort.Percentage); err != nil {
+			return nil, err
+		}
+	}
+	return fault, nil
+}
+
+func faultPercentage(percentage *uint32) (uint32, error) {
+	if percentage == nil {
+		return 100, nil
+	}
+	if *percentage > 100 {
+		return 0, fmt.Errorf("percentage %d must be between 0 and 100", *percentage)
+	}
+	return *percentage, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessFaultConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc             string
+		faultConfig      string
+		wantMethodFaults map[string]*Fault
+		wantedErrorMsg   string
+	}{
+		{
+			desc: "Delay for an API, overridden by an abort for an operation",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"delay": {"fixed_delay": "1.5s", "percentage": 20}
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"abort": {"grpc_status": "UNAVAILABLE"},
+						"headers": [{"key": "x-chaos-test", "value": "true"}]
+					}
+				]
+			}`,
+			wantMethodFaults: map[string]*Fault{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					Delay:           1500 * time.Millisecond,
+					DelayPercentage: 20,
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					AbortHttpStatus: 503,
+					AbortPercentage: 100,
+					Headers: []*HeaderValue{
+						{
+							Key:   "x-chaos-test",
+							Value: "true",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "Delay and HTTP abort for an operation",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+						"delay": {"fixed_delay": "100ms", "percentage": 0},
+						"abort": {"http_status": 429, "percentage": 5}
+					}
+				]
+			}`,
+			wantMethodFaults: map[string]*Fault{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					Delay:           100 * time.Millisecond,
+					AbortHttpStatus: 429,
+					AbortPercentage: 5,
+				},
+			},
+		},
+		{
+			desc: "Fail without a delay or an abort",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves"
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid fault for selector "endpoints.examples.bookstore.Bookstore.ListShelves": must have a delay or an abort`,
+		},
+		{
+			desc: "Fail with invalid fixed delay",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"delay": {"fixed_delay": "2"}
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid fixed delay "2"`,
+		},
+		{
+			desc: "Fail with percentage over 100",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"abort": {"http_status": 500, "percentage": 101}
+					}
+				]
+			}`,
+			wantedErrorMsg: "percentage 101 must be between 0 and 100",
+		},
+		{
+			desc: "Fail with both HTTP and gRPC status",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"abort": {"http_status": 500, "grpc_status": "INTERNAL"}
+					}
+				]
+			}`,
+			wantedErrorMsg: "abort cannot have both an HTTP status and a gRPC status",
+		},
+		{
+			desc: "Fail with gRPC status that cannot be injected",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"abort": {"grpc_status": "DEADLINE_EXCEEDED"}
+					}
+				]
+			}`,
+			wantedErrorMsg: `gRPC status "DEADLINE_EXCEEDED" cannot be injected`,
+		},
+		{
+			desc: "Fail with invalid HTTP status",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"abort": {}
+					}
+				]
+			}`,
+			wantedErrorMsg: "invalid abort HTTP status 0, must be between 200 and 599",
+		},
+		{
+			desc: "Fail with empty header name",
+			faultConfig: `{
+				"faults": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"abort": {"http_status": 500},
+						"headers": [{"value": "true"}]
+					}
+				]
+			}`,
+			wantedErrorMsg: "header name cannot be empty",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.faultConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.FaultConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotMethodFaults := make(map[string]*Fault)
+		for operation, method := range serviceInfo.Methods {
+			if method.Fault != nil {
+				gotMethodFaults[operation] = method.Fault
+			}
+		}
+		if diff := cmp.Diff(tc.wantMethodFaults, gotMethodFaults); diff != "" {
+			t.Errorf("Test Desc(%d): %s, method faults diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
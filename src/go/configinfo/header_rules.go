@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeaderRules are the changes made to the request headers sent to the backend
+// and to the response headers sent to the client. Headers to add are appended
+// to existing values, headers to set replace them.
+type HeaderRules struct {
+	RequestHeadersToAdd     []*HeaderValue `json:"request_headers_to_add"`
+	RequestHeadersToSet     []*HeaderValue `json:"request_headers_to_set"`
+	RequestHeadersToRemove  []string       `json:"request_headers_to_remove"`
+	ResponseHeadersToAdd    []*HeaderValue `json:"response_headers_to_add"`
+	ResponseHeadersToSet    []*HeaderValue `json:"response_headers_to_set"`
+	ResponseHeadersToRemove []string       `json:"response_headers_to_remove"`
+}
+
+type HeaderValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// headerRulesConfig is the format of the file specified by
+// --header_rules_config_path.
+//
+// Example:
+//
+//	{
+//	  "global": {
+//	    "request_headers_to_set": [
+//	      {"key": "x-api-gateway", "value": "espv2"}
+//	    ],
+//	    "response_headers_to_set": [
+//	      {"key": "X-Frame-Options", "value": "DENY"}
+//	    ],
+//	    "response_headers_to_remove": ["x-internal-trace-id"]
+//	  },
+//	  "rules": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.GetShelf",
+//	      "response_headers_to_add": [
+//	        {"key": "Content-Security-Policy", "value": "default-src 'self'"}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Global rules apply to all requests, and rules for an operation or API are
+// applied in addition. If they change the same header, the rule for the
+// operation or API wins. Headers to remove must be exact names. Envoy only
+// removes headers by name, so patterns such as "x-internal-*" are rejected
+// instead of silently matching nothing.
+type headerRulesConfig struct {
+	Global *HeaderRules       `json:"global"`
+	Rules  []*headerRulesRule `json:"rules"`
+}
+
+type headerRulesRule struct {
+	ruleSelector
+	HeaderRules
+}
+
+func (s *ServiceInfo) processHeaderRulesConfig() error {
+	return s.processConfigFile(s.Options.HeaderRulesConfigPath, &headerRulesConfig{})
+}
+
+func (c *headerRulesConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	if c.Global != nil {
+		if err := c.Global.validate(); err != nil {
+			return nil, fmt.Errorf("invalid global header rules: %v", err)
+		}
+		s.HeaderRules = c.Global
+	}
+
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid header rules for selector %q: %v", rule.Selector, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *headerRulesRule) apply(method *methodInfo) error {
+	method.HeaderRules = &r.HeaderRules
+	return nil
+}
+
+func (r *HeaderRules) validate() error {
+	var names []string
+	for _, headers := range [][]*HeaderValue{r.RequestHeadersToAdd, r.RequestHeadersToSet, r.ResponseHeadersToAdd, r.ResponseHeadersToSet} {
+		for _, header := range headers {
+			names = append(names, header.Key)
+		}
+	}
+	names = append(names, r.RequestHeadersToRemove...)
+	names = append(names, r.ResponseHeadersToRemove...)
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("header name cannot be empty")
+		}
+		if strings.HasPrefix(name, ":") || strings.EqualFold(name, "host") {
+			return fmt.Errorf("header %q cannot be modified", name)
+		}
+	}
+	for _, headers := range [][]string{r.RequestHeadersToRemove, r.ResponseHeadersToRemove} {
+		for _, name := range headers {
+			if strings.Contains(name, "*") {
+				return fmt.Errorf("header %q to remove is a pattern, headers to remove must be exact names", name)
+			}
+		}
+	}
+	return nil
+}
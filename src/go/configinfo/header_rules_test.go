@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessHeaderRulesConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc              string
+		headerRulesConfig string
+		wantGlobalRules   *HeaderRules
+		wantMethodRules   map[string]*HeaderRules
+		wantedErrorMsg    string
+	}{
+		{
+			desc: "Global rules and rules for an operation",
+			headerRulesConfig: `{
+				"global": {
+					"request_headers_to_set": [
+						{"key": "x-api-gateway", "value": "espv2"}
+					],
+					"response_headers_to_remove": ["x-internal-trace-id"]
+				},
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"response_headers_to_add": [
+							{"key": "X-Frame-Options", "value": "DENY"}
+						]
+					}
+				]
+			}`,
+			wantGlobalRules: &HeaderRules{
+				RequestHeadersToSet: []*HeaderValue{
+					{
+						Key:   "x-api-gateway",
+						Value: "espv2",
+					},
+				},
+				ResponseHeadersToRemove: []string{"x-internal-trace-id"},
+			},
+			wantMethodRules: map[string]*HeaderRules{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					ResponseHeadersToAdd: []*HeaderValue{
+						{
+							Key:   "X-Frame-Options",
+							Value: "DENY",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "Rules for an operation override the rules for its API",
+			headerRulesConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"request_headers_to_remove": ["x-debug"]
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"request_headers_to_add": [
+							{"key": "x-api", "value": "bookstore"}
+						]
+					}
+				]
+			}`,
+			wantMethodRules: map[string]*HeaderRules{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					RequestHeadersToAdd: []*HeaderValue{
+						{
+							Key:   "x-api",
+							Value: "bookstore",
+						},
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					RequestHeadersToRemove: []string{"x-debug"},
+				},
+			},
+		},
+		{
+			desc: "Fail with a pattern of headers to remove",
+			headerRulesConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"request_headers_to_remove": ["x-internal-*"]
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid header rules for selector "endpoints.examples.bookstore.Bookstore": header "x-internal-*" to remove is a pattern, headers to remove must be exact names`,
+		},
+		{
+			desc: "Fail with pseudo header",
+			headerRulesConfig: `{
+				"global": {
+					"request_headers_to_set": [
+						{"key": ":path", "value": "/"}
+					]
+				}
+			}`,
+			wantedErrorMsg: `invalid global header rules: header ":path" cannot be modified`,
+		},
+		{
+			desc: "Fail with empty header name",
+			headerRulesConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"response_headers_to_remove": [""]
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid header rules for selector "endpoints.examples.bookstore.Bookstore": header name cannot be empty`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.headerRulesConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.HeaderRulesConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantGlobalRules, serviceInfo.HeaderRules); diff != "" {
+			t.Errorf("Test Desc(%d): %s, global header rules diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		gotMethodRules := make(map[string]*HeaderRules)
+		for operation, method := range serviceInfo.Methods {
+			if method.HeaderRules != nil {
+				gotMethodRules[operation] = method.HeaderRules
+			}
+		}
+		if diff := cmp.Diff(tc.wantMethodRules, gotMethodRules); diff != "" {
+			t.Errorf("Test Desc(%d): %s, method header rules diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
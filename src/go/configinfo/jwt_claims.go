@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimRequirement is a requirement on a claim of the verified JWT payload.
+// Exactly one of the matchers is set.
+type ClaimRequirement struct {
+	// Name of the claim, with dots between the names of the claims nested in
+	// objects.
+	Claim string `json:"claim"`
+	// Exact is a string, a bool or a float64, matching claims of the same
+	// type and value.
+	Exact interface{} `json:"exact"`
+	// Contains matches claims that are lists with the value, or strings of
+	// space-separated values with it, such as "scope".
+	Contains string `json:"contains"`
+	Prefix   string `json:"prefix"`
+	// AnyOf matches claims equal to one of the values, each of which is a
+	// string, a bool or a float64.
+	AnyOf []interface{} `json:"any_of"`
+
+	// Keys of the claim, more than one for a claim nested in objects.
+	ClaimPath []string `json:"-"`
+}
+
+// jwtClaimsConfig is the format of the file specified by
+// --jwt_claims_config_path.
+//
+// Example:
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+//	      "claims": [
+//	        {"claim": "scope", "contains": "books.write"},
+//	        {"claim": "email_verified", "exact": true},
+//	        {"claim": "role", "any_of": ["admin", "editor"]},
+//	        {"claim": "realm_access.roles", "contains": "librarian"}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// A request to the operation must meet all the requirements, or it is
+// rejected with 403 naming the first claim it does not meet. Rules for an
+// operation replace the rules for its API. The operations must require a JWT
+// in the service config.
+type jwtClaimsConfig struct {
+	Rules []*jwtClaimsRule `json:"rules"`
+}
+
+type jwtClaimsRule struct {
+	ruleSelector
+	Claims []*ClaimRequirement `json:"claims"`
+
+	// Operations requiring a JWT in the service config.
+	requiresJwt map[string]bool
+}
+
+func (s *ServiceInfo) processJwtClaimsConfig() error {
+	if s.Options.JwtClaimsConfigPath != "" && s.Options.SkipJwtAuthnFilter {
+		return fmt.Errorf("JWT claim requirements cannot be used when JWT Authn filter is skipped")
+	}
+	return s.processConfigFile(s.Options.JwtClaimsConfigPath, &jwtClaimsConfig{})
+}
+
+func (c *jwtClaimsConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	requiresJwt := make(map[string]bool)
+	for _, rule := range s.ServiceConfig().GetAuthentication().GetRules() {
+		if len(rule.GetRequirements()) > 0 {
+			requiresJwt[rule.GetSelector()] = true
+		}
+	}
+
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		if len(rule.Claims) == 0 {
+			return nil, fmt.Errorf("JWT claim requirements for selector %q cannot be empty", rule.Selector)
+		}
+		for _, claim := range rule.Claims {
+			if err := claim.validate(); err != nil {
+				return nil, fmt.Errorf("invalid JWT claim requirement for selector %q: %v", rule.Selector, err)
+			}
+		}
+		rule.requiresJwt = requiresJwt
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *jwtClaimsRule) apply(method *methodInfo) error {
+	operation := fmt.Sprintf("%s.%s", method.ApiName, method.ShortName)
+	if !r.requiresJwt[operation] {
+		return fmt.Errorf("JWT claim requirements for selector %q apply to operation %q, which does not require a JWT", r.Selector, operation)
+	}
+	method.ClaimRequirements = r.Claims
+	return nil
+}
+
+func (c *ClaimRequirement) validate() error {
+	if c.Claim == "" {
+		return fmt.Errorf("claim name cannot be empty")
+	}
+	c.ClaimPath = strings.Split(c.Claim, ".")
+	for _, key := range c.ClaimPath {
+		if key == "" {
+			return fmt.Errorf("invalid claim %q, must be claim names separated by dots", c.Claim)
+		}
+	}
+
+	matchers := 0
+	if c.Exact != nil {
+		if err := validateClaimValue(c.Exact); err != nil {
+			return err
+		}
+		matchers++
+	}
+	if c.Contains != "" {
+		matchers++
+	}
+	if c.Prefix != "" {
+		matchers++
+	}
+	if c.AnyOf != nil {
+		if len(c.AnyOf) == 0 {
+			return fmt.Errorf("any_of of claim %q cannot be empty", c.Claim)
+		}
+		for _, value := range c.AnyOf {
+			if err := validateClaimValue(value); err != nil {
+				return err
+			}
+		}
+		matchers++
+	}
+	if matchers != 1 {
+		return fmt.Errorf("claim %q must have exactly one of exact, contains, prefix and any_of", c.Claim)
+	}
+	return nil
+}
+
+func validateClaimValue(value interface{}) error {
+	switch value.(type) {
+	case string, bool, float64:
+		return nil
+	}
+	return fmt.Errorf("claim value %v must be a string, a bool or a number", value)
+}
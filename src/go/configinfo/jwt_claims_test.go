@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+func TestProcessJwtClaimsConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Authentication = &confpb.Authentication{
+		Providers: []*confpb.AuthProvider{
+			{
+				Id:      "auth_provider",
+				Issuer:  "issuer-0",
+				JwksUri: "https://issuer-0/jwks",
+			},
+		},
+		Rules: []*confpb.AuthenticationRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Requirements: []*confpb.AuthRequirement{
+					{
+						ProviderId: "auth_provider",
+					},
+				},
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				Requirements: []*confpb.AuthRequirement{
+					{
+						ProviderId: "auth_provider",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		jwtClaimsConfig  string
+		skipJwtAuthn     bool
+		wantMethodClaims map[string][]*ClaimRequirement
+		wantedErrorMsg   string
+	}{
+		{
+			desc: "Requirements for an API, replaced for an operation",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "email_verified", "exact": true}
+						]
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"claims": [
+							{"claim": "scope", "contains": "books.write"},
+							{"claim": "role", "any_of": ["admin", "editor"]},
+							{"claim": "email", "prefix": "admin@"},
+							{"claim": "realm_access.roles", "contains": "librarian"}
+						]
+					}
+				]
+			}`,
+			wantMethodClaims: map[string][]*ClaimRequirement{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					{
+						Claim:     "email_verified",
+						Exact:     true,
+						ClaimPath: []string{"email_verified"},
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Claim:     "scope",
+						Contains:  "books.write",
+						ClaimPath: []string{"scope"},
+					},
+					{
+						Claim:     "role",
+						AnyOf:     []interface{}{"admin", "editor"},
+						ClaimPath: []string{"role"},
+					},
+					{
+						Claim:     "email",
+						Prefix:    "admin@",
+						ClaimPath: []string{"email"},
+					},
+					{
+						Claim:     "realm_access.roles",
+						Contains:  "librarian",
+						ClaimPath: []string{"realm_access", "roles"},
+					},
+				},
+			},
+		},
+		{
+			desc: "Fail with more than one matcher",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "email", "exact": "a@b.com", "prefix": "a@"}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid JWT claim requirement for selector "endpoints.examples.bookstore.Bookstore": claim "email" must have exactly one of exact, contains, prefix and any_of`,
+		},
+		{
+			desc: "Fail without matcher",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "email"}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: `claim "email" must have exactly one of exact, contains, prefix and any_of`,
+		},
+		{
+			desc: "Fail with object value",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "role", "any_of": ["admin", {"name": "editor"}]}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: "claim value map[name:editor] must be a string, a bool or a number",
+		},
+		{
+			desc: "Fail with empty claim name",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"exact": true}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: "claim name cannot be empty",
+		},
+		{
+			desc: "Fail with empty name of a nested claim",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"claims": [
+							{"claim": "realm_access..roles", "contains": "librarian"}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid claim "realm_access..roles", must be claim names separated by dots`,
+		},
+		{
+			desc: "Fail with empty requirements",
+			jwtClaimsConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore"
+					}
+				]
+			}`,
+			wantedErrorMsg: `JWT claim requirements for selector "endpoints.examples.bookstore.Bookstore" cannot be empty`,
+		},
+		{
+			desc: "Fail when JWT Authn filter is skipped",
+			jwtClaimsConfig: `{
+				"rules": []
+			}`,
+			skipJwtAuthn:   true,
+			wantedErrorMsg: "JWT claim requirements cannot be used when JWT Authn filter is skipped",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.jwtClaimsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.JwtClaimsConfigPath = path
+			opts.SkipJwtAuthnFilter = tc.skipJwtAuthn
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotMethodClaims := make(map[string][]*ClaimRequirement)
+		for operation, method := range serviceInfo.Methods {
+			if method.ClaimRequirements != nil {
+				gotMethodClaims[operation] = method.ClaimRequirements
+			}
+		}
+		if diff := cmp.Diff(tc.wantMethodClaims, gotMethodClaims); diff != "" {
+			t.Errorf("Test Desc(%d): %s, method claim requirements diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
+
+func TestProcessJwtClaimsConfigWithoutJwtRequirement(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	_, err := processTestConfigFile(t, fakeServiceConfig, `{
+		"rules": [
+			{
+				"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+				"claims": [
+					{"claim": "email_verified", "exact": true}
+				]
+			}
+		]
+	}`, func(opts *options.ConfigGeneratorOptions, path string) {
+		opts.JwtClaimsConfigPath = path
+	})
+	wantedErrorMsg := `JWT claim requirements for selector "endpoints.examples.bookstore.Bookstore.ListShelves" apply to operation "endpoints.examples.bookstore.Bookstore.ListShelves", which does not require a JWT`
+	if err == nil || err.Error() != wantedErrorMsg {
+		t.Errorf("got error: %v, want error: %s", err, wantedErrorMsg)
+	}
+}
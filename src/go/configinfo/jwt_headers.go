@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// JwtPayloadEncoding is how the verified JWT payload is encoded in the request
+// header it is forwarded in.
+type JwtPayloadEncoding string
+
+const (
+	// The payload as it is in the JWT, base64url encoded without padding.
+	JwtPayloadEncodingBase64Url JwtPayloadEncoding = "base64url"
+	// The payload base64 encoded with padding, as ESPv1 forwarded it.
+	JwtPayloadEncodingBase64 JwtPayloadEncoding = "base64"
+)
+
+// JwtPayloadHeader is the request header the verified JWT payload of an
+// authentication provider is forwarded in.
+type JwtPayloadHeader struct {
+	Name     string
+	Encoding JwtPayloadEncoding
+}
+
+// JwtClaimHeader is a request header set to a claim of the verified JWT
+// payload.
+type JwtClaimHeader struct {
+	// Keys of the claim, more than one for a claim nested in objects.
+	ClaimPath []string
+	Header    string
+}
+
+// jwtHeadersConfig is the format of the file specified by
+// --jwt_headers_config_path.
+//
+// Example:
+//
+//	{
+//	  "claim_headers": [
+//	    {"claim": "sub", "header": "X-User-Id"},
+//	    {"claim": "tenant.id", "header": "X-Tenant"}
+//	  ],
+//	  "providers": [
+//	    {"id": "auth0", "payload_header": "X-Jwt-Payload", "payload_encoding": "base64"}
+//	  ]
+//	}
+//
+// Claims are dotted paths into the payload. Lists of values are joined with
+// commas, and the header is not set if the claim is missing or is an object.
+// Headers with these names sent by clients are always removed. Providers
+// without their own payload header forward the payload base64url encoded in
+// X-Endpoint-API-UserInfo.
+type jwtHeadersConfig struct {
+	ClaimHeaders []*jwtClaimHeader    `json:"claim_headers"`
+	Providers    []*jwtProviderHeader `json:"providers"`
+}
+
+type jwtClaimHeader struct {
+	Claim  string `json:"claim"`
+	Header string `json:"header"`
+}
+
+type jwtProviderHeader struct {
+	// ID of the authentication provider in the service config.
+	Id              string             `json:"id"`
+	PayloadHeader   string             `json:"payload_header"`
+	PayloadEncoding JwtPayloadEncoding `json:"payload_encoding"`
+}
+
+func (s *ServiceInfo) processJwtHeadersConfig() error {
+	if s.Options.JwtHeadersConfigPath != "" && s.Options.SkipJwtAuthnFilter {
+		return fmt.Errorf("JWT headers cannot be used when JWT Authn filter is skipped")
+	}
+	return s.processConfigFile(s.Options.JwtHeadersConfigPath, &jwtHeadersConfig{})
+}
+
+func (c *jwtHeadersConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	providerIds := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providerIds[provider.GetId()] = true
+	}
+
+	s.JwtPayloadHeaders = make(map[string]*JwtPayloadHeader)
+	for _, provider := range c.Providers {
+		if !providerIds[provider.Id] {
+			return nil, fmt.Errorf("JWT payload header is set for authentication provider %q, which is not in the service config", provider.Id)
+		}
+		if _, ok := s.JwtPayloadHeaders[provider.Id]; ok {
+			return nil, fmt.Errorf("JWT payload header is set more than once for authentication provider %q", provider.Id)
+		}
+
+		header := &JwtPayloadHeader{
+			Name:     provider.PayloadHeader,
+			Encoding: provider.PayloadEncoding,
+		}
+		if header.Name == "" {
+			header.Name = util.JwtPayloadHeaderName
+		}
+		if err := validateJwtHeaderName(header.Name); err != nil {
+			return nil, err
+		}
+		switch header.Encoding {
+		case "":
+			header.Encoding = JwtPayloadEncodingBase64Url
+		case JwtPayloadEncodingBase64Url, JwtPayloadEncodingBase64:
+		default:
+			return nil, fmt.Errorf("invalid JWT payload encoding %q of authentication provider %q, must be base64url or base64", header.Encoding, provider.Id)
+		}
+		s.JwtPayloadHeaders[provider.Id] = header
+	}
+
+	// The payloads are re-encoded by header name, so providers sharing a
+	// header must share its encoding.
+	encodings := make(map[string]JwtPayloadEncoding)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		header := s.JwtPayloadHeader(provider.GetId())
+		name := strings.ToLower(header.Name)
+		if encoding, ok := encodings[name]; ok && encoding != header.Encoding {
+			return nil, fmt.Errorf("JWT payload header %q has both %s and %s encodings", header.Name, encoding, header.Encoding)
+		}
+		encodings[name] = header.Encoding
+	}
+
+	claimHeaders := make(map[string]bool)
+	for _, claimHeader := range c.ClaimHeaders {
+		if err := validateJwtHeaderName(claimHeader.Header); err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(claimHeader.Header)
+		if _, ok := encodings[name]; ok {
+			return nil, fmt.Errorf("header %q of claim %q is a JWT payload header", claimHeader.Header, claimHeader.Claim)
+		}
+		if claimHeaders[name] {
+			return nil, fmt.Errorf("header %q is set to more than one claim", claimHeader.Header)
+		}
+		claimHeaders[name] = true
+
+		path := strings.Split(claimHeader.Claim, ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("invalid claim %q, must be claim names separated by dots", claimHeader.Claim)
+			}
+		}
+		s.JwtClaimHeaders = append(s.JwtClaimHeaders, &JwtClaimHeader{
+			ClaimPath: path,
+			Header:    claimHeader.Header,
+		})
+	}
+	return nil, nil
+}
+
+func validateJwtHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("JWT header name cannot be empty")
+	}
+	if strings.HasPrefix(name, ":") || strings.EqualFold(name, "host") || strings.EqualFold(name, "authorization") {
+		return fmt.Errorf("header %q cannot be used for JWT claims or payloads", name)
+	}
+	return nil
+}
+
+// JwtPayloadHeader returns the request header the verified JWT payload of the
+// authentication provider is forwarded in.
+func (s *ServiceInfo) JwtPayloadHeader(providerId string) *JwtPayloadHeader {
+	if header, ok := s.JwtPayloadHeaders[providerId]; ok {
+		return header
+	}
+	return &JwtPayloadHeader{
+		Name:     util.JwtPayloadHeaderName,
+		Encoding: JwtPayloadEncodingBase64Url,
+	}
+}
+
+// JwtPayloadHeaderNames returns the distinct request headers the verified JWT
+// payloads are forwarded in, in the order of the providers.
+func (s *ServiceInfo) JwtPayloadHeaderNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		name := s.JwtPayloadHeader(provider.GetId()).Name
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, util.JwtPayloadHeaderName)
+	}
+	return names
+}
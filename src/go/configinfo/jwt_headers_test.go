@@ -0,0 +1,211 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+func TestProcessJwtHeadersConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Authentication = &confpb.Authentication{
+		Providers: []*confpb.AuthProvider{
+			{
+				Id:      "auth_provider_0",
+				Issuer:  "issuer-0",
+				JwksUri: "https://issuer-0/jwks",
+			},
+			{
+				Id:      "auth_provider_1",
+				Issuer:  "issuer-1",
+				JwksUri: "https://issuer-1/jwks",
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                   string
+		jwtHeadersConfig       string
+		skipJwtAuthn           bool
+		wantClaimHeaders       []*JwtClaimHeader
+		wantPayloadHeaders     map[string]*JwtPayloadHeader
+		wantPayloadHeaderNames []string
+		wantedErrorMsg         string
+	}{
+		{
+			desc: "Claim headers with nested claims, and a provider with its own payload header",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": "X-User-Id"},
+					{"claim": "tenant.id", "header": "X-Tenant"}
+				],
+				"providers": [
+					{"id": "auth_provider_1", "payload_header": "X-Jwt-Payload", "payload_encoding": "base64"}
+				]
+			}`,
+			wantClaimHeaders: []*JwtClaimHeader{
+				{
+					ClaimPath: []string{"sub"},
+					Header:    "X-User-Id",
+				},
+				{
+					ClaimPath: []string{"tenant", "id"},
+					Header:    "X-Tenant",
+				},
+			},
+			wantPayloadHeaders: map[string]*JwtPayloadHeader{
+				"auth_provider_0": {
+					Name:     "X-Endpoint-API-UserInfo",
+					Encoding: JwtPayloadEncodingBase64Url,
+				},
+				"auth_provider_1": {
+					Name:     "X-Jwt-Payload",
+					Encoding: JwtPayloadEncodingBase64,
+				},
+			},
+			wantPayloadHeaderNames: []string{"X-Endpoint-API-UserInfo", "X-Jwt-Payload"},
+		},
+		{
+			desc: "Providers sharing a payload header",
+			jwtHeadersConfig: `{
+				"providers": [
+					{"id": "auth_provider_0", "payload_header": "X-Jwt-Payload"},
+					{"id": "auth_provider_1", "payload_header": "x-jwt-payload"}
+				]
+			}`,
+			wantPayloadHeaders: map[string]*JwtPayloadHeader{
+				"auth_provider_0": {
+					Name:     "X-Jwt-Payload",
+					Encoding: JwtPayloadEncodingBase64Url,
+				},
+				"auth_provider_1": {
+					Name:     "x-jwt-payload",
+					Encoding: JwtPayloadEncodingBase64Url,
+				},
+			},
+			wantPayloadHeaderNames: []string{"X-Jwt-Payload"},
+		},
+		{
+			desc: "Fail with providers sharing a payload header with different encodings",
+			jwtHeadersConfig: `{
+				"providers": [
+					{"id": "auth_provider_1", "payload_encoding": "base64"}
+				]
+			}`,
+			wantedErrorMsg: `JWT payload header "X-Endpoint-API-UserInfo" has both base64url and base64 encodings`,
+		},
+		{
+			desc: "Fail with an unknown encoding",
+			jwtHeadersConfig: `{
+				"providers": [
+					{"id": "auth_provider_0", "payload_encoding": "json"}
+				]
+			}`,
+			wantedErrorMsg: `invalid JWT payload encoding "json" of authentication provider "auth_provider_0", must be base64url or base64`,
+		},
+		{
+			desc: "Fail with an unknown provider",
+			jwtHeadersConfig: `{
+				"providers": [
+					{"id": "auth_provider_2", "payload_header": "X-Jwt-Payload"}
+				]
+			}`,
+			wantedErrorMsg: `JWT payload header is set for authentication provider "auth_provider_2", which is not in the service config`,
+		},
+		{
+			desc: "Fail with a claim header that is a payload header",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": "x-endpoint-api-userinfo"}
+				]
+			}`,
+			wantedErrorMsg: `header "x-endpoint-api-userinfo" of claim "sub" is a JWT payload header`,
+		},
+		{
+			desc: "Fail with a header set to two claims",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": "X-User"},
+					{"claim": "email", "header": "x-user"}
+				]
+			}`,
+			wantedErrorMsg: `header "x-user" is set to more than one claim`,
+		},
+		{
+			desc: "Fail with an invalid claim path",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "tenant..id", "header": "X-Tenant"}
+				]
+			}`,
+			wantedErrorMsg: `invalid claim "tenant..id", must be claim names separated by dots`,
+		},
+		{
+			desc: "Fail with a pseudo header",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": ":authority"}
+				]
+			}`,
+			wantedErrorMsg: `header ":authority" cannot be used for JWT claims or payloads`,
+		},
+		{
+			desc: "Fail when JWT Authn filter is skipped",
+			jwtHeadersConfig: `{
+				"claim_headers": [
+					{"claim": "sub", "header": "X-User-Id"}
+				]
+			}`,
+			skipJwtAuthn:   true,
+			wantedErrorMsg: "JWT headers cannot be used when JWT Authn filter is skipped",
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.jwtHeadersConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.JwtHeadersConfigPath = path
+			opts.SkipJwtAuthnFilter = tc.skipJwtAuthn
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantClaimHeaders, serviceInfo.JwtClaimHeaders); diff != "" {
+			t.Errorf("Test Desc(%d): %s, claim headers diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		gotPayloadHeaders := make(map[string]*JwtPayloadHeader)
+		for _, provider := range fakeServiceConfig.GetAuthentication().GetProviders() {
+			gotPayloadHeaders[provider.GetId()] = serviceInfo.JwtPayloadHeader(provider.GetId())
+		}
+		if diff := cmp.Diff(tc.wantPayloadHeaders, gotPayloadHeaders); diff != "" {
+			t.Errorf("Test Desc(%d): %s, payload headers diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if diff := cmp.Diff(tc.wantPayloadHeaderNames, serviceInfo.JwtPayloadHeaderNames()); diff != "" {
+			t.Errorf("Test Desc(%d): %s, payload header names diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// processLocalJwks reads the JWKS of the authentication providers whose
+// jwks_uri is a file:// or data: URI, or whose ID is mapped to a file by
+// --jwks_files. Their JWKS are inlined into the JWT Authn filter config, so
+// they do not need a cluster and the issuer does not need to be reachable.
+func (s *ServiceInfo) processLocalJwks() error {
+	jwksFiles := make(map[string]string)
+	if s.Options.JwksFiles != "" {
+		for _, jwksFile := range strings.Split(s.Options.JwksFiles, ",") {
+			parts := strings.SplitN(strings.TrimSpace(jwksFile), "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("invalid JWKS file %q, must be provider_id=path", jwksFile)
+			}
+			jwksFiles[parts[0]] = parts[1]
+		}
+	}
+
+	s.LocalJwks = make(map[string]string)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		id, jwksUri := provider.GetId(), provider.GetJwksUri()
+		path, isFile := jwksFiles[id]
+		delete(jwksFiles, id)
+		if !isFile && strings.HasPrefix(jwksUri, "file://") {
+			u, err := url.Parse(jwksUri)
+			if err != nil || (u.Host != "" && u.Host != "localhost") {
+				return fmt.Errorf("invalid jwks_uri %q of authentication provider %q, must be file:///path", jwksUri, id)
+			}
+			path, isFile = u.Path, true
+		}
+
+		var jwks string
+		switch {
+		case isFile:
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("fail to read JWKS file of authentication provider %q: %v", id, err)
+			}
+			jwks = string(data)
+			s.LocalJwksFiles = append(s.LocalJwksFiles, path)
+		case strings.HasPrefix(jwksUri, "data:"):
+			var err error
+			if jwks, err = parseDataUri(jwksUri); err != nil {
+				return fmt.Errorf("invalid jwks_uri of authentication provider %q: %v", id, err)
+			}
+		default:
+			continue
+		}
+
+		if strings.TrimSpace(jwks) == "" {
+			return fmt.Errorf("JWKS of authentication provider %q is empty", id)
+		}
+		s.LocalJwks[id] = jwks
+	}
+
+	for id := range jwksFiles {
+		return fmt.Errorf("JWKS file is set for authentication provider %q, which is not in the service config", id)
+	}
+	return nil
+}
+
+// parseDataUri returns the data of a data: URI, which is
+// data:[<media type>][;base64],<data>.
+func parseDataUri(uri string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(uri, "data:"), ",", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("data URI must have a comma before the data")
+	}
+
+	if strings.HasSuffix(parts[0], ";base64") {
+		data, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", fmt.Errorf("fail to decode base64 data: %v", err)
+		}
+		return string(data), nil
+	}
+	data, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("fail to unescape data: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessLocalJwks(t *testing.T) {
+	jwksFile := writeTempConfigFile(t, `{"keys": [{"kid": "file"}]}`)
+	defer os.Remove(jwksFile)
+	emptyFile := writeTempConfigFile(t, "")
+	defer os.Remove(emptyFile)
+
+	testData := []struct {
+		desc               string
+		providers          []*confpb.AuthProvider
+		jwksFiles          string
+		wantLocalJwks      map[string]string
+		wantLocalJwksFiles []string
+		wantedErrorMsg     string
+	}{
+		{
+			desc: "Local JWKS from file and data URIs, remote JWKS left alone",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "file_provider",
+					JwksUri: "file://" + jwksFile,
+				},
+				{
+					Id:      "base64_provider",
+					JwksUri: "data:application/json;base64,eyJrZXlzIjpbXX0=",
+				},
+				{
+					Id:      "plain_provider",
+					JwksUri: "data:,%7B%22keys%22%3A%5B%5D%7D",
+				},
+				{
+					Id:      "remote_provider",
+					JwksUri: "https://issuer-0/jwks",
+				},
+			},
+			wantLocalJwks: map[string]string{
+				"file_provider":   `{"keys": [{"kid": "file"}]}`,
+				"base64_provider": `{"keys":[]}`,
+				"plain_provider":  `{"keys":[]}`,
+			},
+			wantLocalJwksFiles: []string{jwksFile},
+		},
+		{
+			desc: "JWKS file from flag replaces jwks_uri",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "https://issuer-0/jwks",
+				},
+			},
+			jwksFiles: "auth_provider=" + jwksFile,
+			wantLocalJwks: map[string]string{
+				"auth_provider": `{"keys": [{"kid": "file"}]}`,
+			},
+			wantLocalJwksFiles: []string{jwksFile},
+		},
+		{
+			desc: "Fail with invalid JWKS files flag",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "https://issuer-0/jwks",
+				},
+			},
+			jwksFiles:      "auth_provider",
+			wantedErrorMsg: `invalid JWKS file "auth_provider", must be provider_id=path`,
+		},
+		{
+			desc: "Fail with JWKS file for unknown provider",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "https://issuer-0/jwks",
+				},
+			},
+			jwksFiles:      "other_provider=" + jwksFile,
+			wantedErrorMsg: `JWKS file is set for authentication provider "other_provider", which is not in the service config`,
+		},
+		{
+			desc: "Fail with missing JWKS file",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "file:///non-existing/jwks.json",
+				},
+			},
+			wantedErrorMsg: `fail to read JWKS file of authentication provider "auth_provider"`,
+		},
+		{
+			desc: "Fail with empty JWKS file",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "file://" + emptyFile,
+				},
+			},
+			wantedErrorMsg: `JWKS of authentication provider "auth_provider" is empty`,
+		},
+		{
+			desc: "Fail with invalid base64 data URI",
+			providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					JwksUri: "data:application/json;base64,{}",
+				},
+			},
+			wantedErrorMsg: `invalid jwks_uri of authentication provider "auth_provider": fail to decode base64 data`,
+		},
+	}
+
+	for i, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+			Authentication: &confpb.Authentication{
+				Providers: tc.providers,
+			},
+		}
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwksFiles = tc.jwksFiles
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantLocalJwks, serviceInfo.LocalJwks); diff != "" {
+			t.Errorf("Test Desc(%d): %s, local JWKS diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if diff := cmp.Diff(tc.wantLocalJwksFiles, serviceInfo.LocalJwksFiles); diff != "" {
+			t.Errorf("Test Desc(%d): %s, local JWKS files diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -37,6 +37,27 @@ type methodInfo struct {
 	MetricCosts        []*scpb.MetricCost
 	// All non-unary gRPC methods are considered streaming.
 	IsStreaming bool
+	// CORS policy for the routes of this method, overriding the global one.
+	CorsPolicy *CorsPolicy
+	// Local rate limits, all of which must allow a request.
+	RateLimits []*RateLimit
+	// Maximum request body size overriding the global one, 0 if not set.
+	MaxRequestBodyBytes uint32
+	// Header rules applied in addition to the global ones.
+	HeaderRules *HeaderRules
+	// Cluster of the backend for the API version, empty if not set.
+	ApiVersionClusterName string
+	// Canary of the routes of this method, overriding the global one.
+	Canary *Canary
+	// Mirror targets of the routes of this method, overriding the global ones.
+	// Nil if the method uses the global ones.
+	MirrorTargets []*MirrorTarget
+	// Fault injected into the requests to this method.
+	Fault *Fault
+	// Whether the requests to this method skip the external authorization.
+	ExtAuthzDisabled bool
+	// Requirements on the claims of the verified JWT, all of which must be met.
+	ClaimRequirements []*ClaimRequirement
 }
 
 // backendInfo stores information from Backend rule for backend rerouting.
@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// MirrorTarget is a backend that gets a copy of a share of the requests of a
+// route. Its responses are discarded.
+type MirrorTarget struct {
+	ClusterName string
+	// Percentage of the requests copied to the target, from 1 to 100.
+	Percentage uint32
+}
+
+// mirrorConfig is the format of the file specified by --mirror_config_path.
+//
+// Example:
+//
+//	{
+//	  "targets": [
+//	    {"address": "http://bookstore-v2:8080", "percentage": 10},
+//	    {"address": "bookstore-v3:8443", "percentage": 5}
+//	  ],
+//	  "rules": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+//	      "targets": []
+//	    }
+//	  ]
+//	}
+//
+// Addresses are either scheme://host:port or host:port, like the addresses of
+// the backends. Without a scheme the target is reached over https, and
+// without a port on the default port of the scheme. Addresses with a path are
+// rejected, as the copies keep the path of the request.
+//
+// The global targets apply to all the routes, and rules for an operation or
+// API replace them. A rule without targets turns mirroring off.
+type mirrorConfig struct {
+	Targets []*mirrorTarget `json:"targets"`
+	Rules   []*mirrorRule   `json:"rules"`
+}
+
+type mirrorRule struct {
+	ruleSelector
+	Targets []*mirrorTarget `json:"targets"`
+
+	mirrorTargets []*MirrorTarget
+}
+
+type mirrorTarget struct {
+	Address    string `json:"address"`
+	Percentage uint32 `json:"percentage"`
+}
+
+func (s *ServiceInfo) processMirrorConfig() error {
+	return s.processConfigFile(s.Options.MirrorConfigPath, &mirrorConfig{})
+}
+
+func (c *mirrorConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	clusterNames := make(map[string]bool)
+	targets, err := s.makeMirrorTargets(c.Targets, clusterNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid global mirror targets: %v", err)
+	}
+	s.MirrorTargets = targets
+
+	var rules []selectorRule
+	for _, rule := range c.Rules {
+		targets, err := s.makeMirrorTargets(rule.Targets, clusterNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror targets for selector %q: %v", rule.Selector, err)
+		}
+		if targets == nil {
+			// Keep the rule distinct from methods using the global targets.
+			targets = []*MirrorTarget{}
+		}
+		rule.mirrorTargets = targets
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *mirrorRule) apply(method *methodInfo) error {
+	method.MirrorTargets = r.mirrorTargets
+	return nil
+}
+
+// makeMirrorTargets makes the mirror targets, adding the clusters that are not
+// in clusterNames yet.
+func (s *ServiceInfo) makeMirrorTargets(targets []*mirrorTarget, clusterNames map[string]bool) ([]*MirrorTarget, error) {
+	var mirrorTargets []*MirrorTarget
+	for _, target := range targets {
+		if target.Percentage == 0 || target.Percentage > 100 {
+			return nil, fmt.Errorf("percentage %d must be between 1 and 100", target.Percentage)
+		}
+
+		cluster, err := s.makeBackendRoutingCluster(target.Address)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, _, path, _ := util.ParseURI(target.Address); path != "" {
+			return nil, fmt.Errorf("address %q must not have a path", target.Address)
+		}
+		cluster.ClusterName = fmt.Sprintf("mirror_%v:%v", cluster.Hostname, cluster.Port)
+		if !clusterNames[cluster.ClusterName] {
+			s.MirrorClusters = append(s.MirrorClusters, cluster)
+			clusterNames[cluster.ClusterName] = true
+		}
+
+		mirrorTargets = append(mirrorTargets, &MirrorTarget{
+			ClusterName: cluster.ClusterName,
+			Percentage:  target.Percentage,
+		})
+	}
+	return mirrorTargets, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessMirrorConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc              string
+		mirrorConfig      string
+		wantTargets       []*MirrorTarget
+		wantClusters      []*BackendRoutingCluster
+		wantMethodTargets map[string][]*MirrorTarget
+		wantedErrorMsg    string
+	}{
+		{
+			desc: "Global targets with a rule turning mirroring off",
+			mirrorConfig: `{
+				"targets": [
+					{"address": "http://bookstore-v2:8080", "percentage": 10},
+					{"address": "bookstore-v3", "percentage": 100}
+				],
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"targets": []
+					}
+				]
+			}`,
+			wantTargets: []*MirrorTarget{
+				{
+					ClusterName: "mirror_bookstore-v2:8080",
+					Percentage:  10,
+				},
+				{
+					ClusterName: "mirror_bookstore-v3:443",
+					Percentage:  100,
+				},
+			},
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "mirror_bookstore-v2:8080",
+					Hostname:    "bookstore-v2",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+				{
+					ClusterName: "mirror_bookstore-v3:443",
+					Hostname:    "bookstore-v3",
+					Port:        443,
+					UseTLS:      true,
+					Protocol:    util.HTTP1,
+				},
+			},
+			wantMethodTargets: map[string][]*MirrorTarget{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {},
+			},
+		},
+		{
+			desc: "Targets for an API share the clusters",
+			mirrorConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"targets": [
+							{"address": "http://bookstore-v2:8080", "percentage": 50}
+						]
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+						"targets": [
+							{"address": "http://bookstore-v2:8080", "percentage": 5}
+						]
+					}
+				]
+			}`,
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "mirror_bookstore-v2:8080",
+					Hostname:    "bookstore-v2",
+					Port:        8080,
+					Protocol:    util.HTTP1,
+				},
+			},
+			wantMethodTargets: map[string][]*MirrorTarget{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						ClusterName: "mirror_bookstore-v2:8080",
+						Percentage:  50,
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					{
+						ClusterName: "mirror_bookstore-v2:8080",
+						Percentage:  5,
+					},
+				},
+			},
+		},
+		{
+			desc: "Targets with and without a scheme",
+			mirrorConfig: `{
+				"targets": [
+					{"address": "bookstore-v2:8080", "percentage": 10},
+					{"address": "grpc://bookstore-v3:8081", "percentage": 20}
+				]
+			}`,
+			wantTargets: []*MirrorTarget{
+				{
+					ClusterName: "mirror_bookstore-v2:8080",
+					Percentage:  10,
+				},
+				{
+					ClusterName: "mirror_bookstore-v3:8081",
+					Percentage:  20,
+				},
+			},
+			wantClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "mirror_bookstore-v2:8080",
+					Hostname:    "bookstore-v2",
+					Port:        8080,
+					UseTLS:      true,
+					Protocol:    util.HTTP1,
+				},
+				{
+					ClusterName: "mirror_bookstore-v3:8081",
+					Hostname:    "bookstore-v3",
+					Port:        8081,
+					Protocol:    util.GRPC,
+				},
+			},
+			wantMethodTargets: map[string][]*MirrorTarget{},
+		},
+		{
+			desc: "Fail with zero percentage",
+			mirrorConfig: `{
+				"targets": [
+					{"address": "http://bookstore-v2:8080"}
+				]
+			}`,
+			wantedErrorMsg: "invalid global mirror targets: percentage 0 must be between 1 and 100",
+		},
+		{
+			desc: "Fail with invalid address",
+			mirrorConfig: `{
+				"rules": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"targets": [
+							{"address": "ftp://bookstore-v2", "percentage": 10}
+						]
+					}
+				]
+			}`,
+			wantedErrorMsg: `invalid mirror targets for selector "endpoints.examples.bookstore.Bookstore": unknown backend scheme [ftp]`,
+		},
+		{
+			desc: "Fail with a path in the address",
+			mirrorConfig: `{
+				"targets": [
+					{"address": "bookstore-v2:8080/v2", "percentage": 10}
+				]
+			}`,
+			wantedErrorMsg: `invalid global mirror targets: address "bookstore-v2:8080/v2" must not have a path`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.mirrorConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.MirrorConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantTargets, serviceInfo.MirrorTargets); diff != "" {
+			t.Errorf("Test Desc(%d): %s, global mirror targets diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		if diff := cmp.Diff(tc.wantClusters, serviceInfo.MirrorClusters); diff != "" {
+			t.Errorf("Test Desc(%d): %s, mirror clusters diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+		gotMethodTargets := make(map[string][]*MirrorTarget)
+		for operation, method := range serviceInfo.Methods {
+			if method.MirrorTargets != nil {
+				gotMethodTargets[operation] = method.MirrorTargets
+			}
+		}
+		if diff := cmp.Diff(tc.wantMethodTargets, gotMethodTargets); diff != "" {
+			t.Errorf("Test Desc(%d): %s, method mirror targets diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
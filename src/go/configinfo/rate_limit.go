@@ -0,0 +1,257 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+// RateLimitKey is what the requests of a rate limit are grouped by. Each
+// group has its own token bucket.
+type RateLimitKey string
+
+const (
+	// All the requests share one bucket.
+	RateLimitKeyNone RateLimitKey = ""
+	// Requests are grouped by their API key.
+	RateLimitKeyApiKey RateLimitKey = "api_key"
+	// Requests are grouped by the subject of their verified JWT.
+	RateLimitKeyJwtSubject RateLimitKey = "jwt_subject"
+	// Requests are grouped by the client IP address.
+	RateLimitKeyClientIP RateLimitKey = "client_ip"
+)
+
+// RateLimit is a local token bucket limit on the requests to a method.
+type RateLimit struct {
+	// Name of the limit. Methods with a limit of the same name share buckets.
+	Name string
+	Key  RateLimitKey
+	// Tokens refilled per Unit, which is also the size of the bucket.
+	Limit int64
+	Unit  time.Duration
+	// Tokens taken by one request.
+	Cost int64
+}
+
+// rateLimitConfig is the format of the file specified by
+// --rate_limit_config_path.
+//
+// Example:
+//
+//	{
+//	  "quota": {
+//	    "key": "api_key"
+//	  },
+//	  "limits": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+//	      "requests_per_unit": 10,
+//	      "unit": "second",
+//	      "key": "client_ip"
+//	    }
+//	  ]
+//	}
+//
+// When "quota" is set, the quota limits of the service config are enforced
+// locally for the methods with quota metric rules.
+type rateLimitConfig struct {
+	Quota  *rateLimitQuota  `json:"quota"`
+	Limits []*rateLimitRule `json:"limits"`
+}
+
+type rateLimitQuota struct {
+	Key RateLimitKey `json:"key"`
+}
+
+type rateLimitRule struct {
+	// A limit for an API applies to each of its operations separately.
+	ruleSelector
+	RequestsPerUnit int64        `json:"requests_per_unit"`
+	Unit            string       `json:"unit"`
+	Key             RateLimitKey `json:"key"`
+
+	// Index of the rule in the limits, which names the limits it makes.
+	index int
+}
+
+var (
+	rateLimitUnits = map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+	}
+
+	// Units of the quota limits in the service config, e.g. "1/min/{project}".
+	quotaLimitUnits = map[string]time.Duration{
+		"min": time.Minute,
+		"d":   24 * time.Hour,
+	}
+)
+
+func (s *ServiceInfo) processRateLimitConfig() error {
+	if err := s.processConfigFile(s.Options.RateLimitConfigPath, &rateLimitConfig{}); err != nil {
+		return err
+	}
+	return s.validateJwtSubjectRateLimits()
+}
+
+// validateJwtSubjectRateLimits checks that the methods with limits keyed by
+// the JWT subject require a JWT, as the subject is only taken from the payload
+// of a verified JWT.
+func (s *ServiceInfo) validateJwtSubjectRateLimits() error {
+	authRules := make(map[string]*confpb.AuthenticationRule)
+	for _, rule := range s.serviceConfig.GetAuthentication().GetRules() {
+		authRules[rule.GetSelector()] = rule
+	}
+
+	for operation, method := range s.Methods {
+		for _, limit := range method.RateLimits {
+			if limit.Key != RateLimitKeyJwtSubject {
+				continue
+			}
+			rule := authRules[operation]
+			if len(rule.GetRequirements()) == 0 || rule.GetAllowWithoutCredential() {
+				return fmt.Errorf("rate limit %s is keyed by JWT subject, but operation %s does not require a JWT", limit.Name, operation)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *rateLimitConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	if c.Quota != nil {
+		if err := validateRateLimitKey(c.Quota.Key); err != nil {
+			return nil, err
+		}
+		s.processQuotaRateLimits(c.Quota.Key)
+	}
+
+	var rules []selectorRule
+	for i, rule := range c.Limits {
+		if rule.RequestsPerUnit <= 0 {
+			return nil, fmt.Errorf("rate limit for selector %q must have a positive requests_per_unit", rule.Selector)
+		}
+		if _, ok := rateLimitUnits[rule.Unit]; !ok {
+			return nil, fmt.Errorf(`rate limit for selector %q has invalid unit %q, must be one of "second", "minute", "hour" and "day"`, rule.Selector, rule.Unit)
+		}
+		if err := validateRateLimitKey(rule.Key); err != nil {
+			return nil, err
+		}
+		rule.index = i
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *rateLimitRule) apply(method *methodInfo) error {
+	method.RateLimits = append(method.RateLimits, &RateLimit{
+		Name:  fmt.Sprintf("%s.%s/limits[%d]", method.ApiName, method.ShortName, r.index),
+		Key:   r.Key,
+		Limit: r.RequestsPerUnit,
+		Unit:  rateLimitUnits[r.Unit],
+		Cost:  1,
+	})
+	return nil
+}
+
+// processQuotaRateLimits makes a rate limit for each quota limit of the
+// service config charged by a method.
+func (s *ServiceInfo) processQuotaRateLimits(key RateLimitKey) {
+	limitsByMetric := make(map[string][]*RateLimit)
+	for _, limit := range s.ServiceConfig().GetQuota().GetLimits() {
+		parts := strings.Split(limit.GetUnit(), "/")
+		unit, ok := time.Duration(0), len(parts) == 3
+		if ok {
+			unit, ok = quotaLimitUnits[parts[1]]
+		}
+		if !ok {
+			glog.Warningf("quota limit %s with unit %q is not enforced locally", limit.GetName(), limit.GetUnit())
+			continue
+		}
+		value := limit.GetValues()["STANDARD"]
+		if value <= 0 {
+			// As in Service Control, negative, zero and unset values mean
+			// unlimited.
+			continue
+		}
+		limitsByMetric[limit.GetMetric()] = append(limitsByMetric[limit.GetMetric()], &RateLimit{
+			Name:  "quota/" + limit.GetName(),
+			Key:   key,
+			Limit: value,
+			Unit:  unit,
+		})
+	}
+
+	for _, method := range s.Methods {
+		for _, metricCost := range method.MetricCosts {
+			for _, limit := range limitsByMetric[metricCost.GetName()] {
+				rateLimit := *limit
+				rateLimit.Cost = metricCost.GetCost()
+				method.RateLimits = append(method.RateLimits, &rateLimit)
+			}
+		}
+		// MetricCosts are built from a map, keep the limits in a stable order.
+		sort.Slice(method.RateLimits, func(i, j int) bool {
+			return method.RateLimits[i].Name < method.RateLimits[j].Name
+		})
+	}
+}
+
+func validateRateLimitKey(key RateLimitKey) error {
+	switch key {
+	case RateLimitKeyNone, RateLimitKeyApiKey, RateLimitKeyJwtSubject, RateLimitKeyClientIP:
+		return nil
+	}
+	return fmt.Errorf(`invalid rate limit key %q, must be one of "", "api_key", "jwt_subject" and "client_ip"`, key)
+}
+
+// RateLimitApiKeyLocations returns the locations the API key of the method
+// is looked up in, in order, to group the requests of its rate limits.
+func (s *ServiceInfo) RateLimitApiKeyLocations(operation string) []*scpb.ApiKeyLocation {
+	if locations := s.Methods[operation].ApiKeyLocations; len(locations) != 0 {
+		return locations
+	}
+	return defaultApiKeyLocations()
+}
+
+// RateLimitJwtPayloadHeaders returns the distinct request headers the verified
+// JWT payloads of the providers of the method are forwarded in, to group the
+// requests of its rate limits keyed by JWT subject.
+func (s *ServiceInfo) RateLimitJwtPayloadHeaders(operation string) []*JwtPayloadHeader {
+	var headers []*JwtPayloadHeader
+	seen := make(map[string]bool)
+	for _, rule := range s.serviceConfig.GetAuthentication().GetRules() {
+		if rule.GetSelector() != operation {
+			continue
+		}
+		for _, requirement := range rule.GetRequirements() {
+			header := s.JwtPayloadHeader(requirement.GetProviderId())
+			if name := strings.ToLower(header.Name); !seen[name] {
+				seen[name] = true
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
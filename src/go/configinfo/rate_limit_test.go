@@ -0,0 +1,335 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessRateLimitConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+	fakeServiceConfig.Apis[0].Methods = append(fakeServiceConfig.Apis[0].Methods, &apipb.Method{
+		Name: "DeleteShelf",
+	})
+	fakeServiceConfig.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/shelves",
+				},
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				Pattern: &annotationspb.HttpRule_Post{
+					Post: "/shelves",
+				},
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+				Pattern: &annotationspb.HttpRule_Delete{
+					Delete: "/shelves/{shelf}",
+				},
+			},
+		},
+	}
+	fakeServiceConfig.Authentication = &confpb.Authentication{
+		Providers: []*confpb.AuthProvider{
+			{
+				Id:      "auth_provider",
+				Issuer:  "issuer",
+				JwksUri: "https://issuer.com/jwks",
+			},
+		},
+		Rules: []*confpb.AuthenticationRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Requirements: []*confpb.AuthRequirement{
+					{
+						ProviderId: "auth_provider",
+					},
+				},
+				AllowWithoutCredential: true,
+			},
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				Requirements: []*confpb.AuthRequirement{
+					{
+						ProviderId: "auth_provider",
+					},
+				},
+			},
+		},
+	}
+	fakeServiceConfig.Quota = &confpb.Quota{
+		Limits: []*confpb.QuotaLimit{
+			{
+				Name:   "write-limit",
+				Metric: "write-requests",
+				Unit:   "1/min/{project}",
+				Values: map[string]int64{
+					"STANDARD": 60,
+				},
+			},
+			{
+				Name:   "daily-write-limit",
+				Metric: "write-requests",
+				Unit:   "1/d/{project}",
+				Values: map[string]int64{
+					"STANDARD": 1000,
+				},
+			},
+			{
+				Name:   "unlimited-write-limit",
+				Metric: "write-requests",
+				Unit:   "1/min/{project}",
+				Values: map[string]int64{
+					"STANDARD": -1,
+				},
+			},
+			{
+				Name:   "zero-write-limit",
+				Metric: "write-requests",
+				Unit:   "1/min/{project}",
+				Values: map[string]int64{
+					"STANDARD": 0,
+				},
+			},
+			{
+				Name:   "unset-write-limit",
+				Metric: "write-requests",
+				Unit:   "1/d/{project}",
+			},
+		},
+		MetricRules: []*confpb.MetricRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+				MetricCosts: map[string]int64{
+					"write-requests": 2,
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		rateLimitConfig string
+		wantRateLimits  map[string][]*RateLimit
+		wantedErrorMsg  string
+	}{
+		{
+			desc: "Limit for an API applies to each of its methods",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"requests_per_unit": 10,
+						"unit": "second",
+						"key": "client_ip"
+					}
+				]
+			}`,
+			wantRateLimits: map[string][]*RateLimit{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					{
+						Name:  "endpoints.examples.bookstore.Bookstore.ListShelves/limits[0]",
+						Key:   RateLimitKeyClientIP,
+						Limit: 10,
+						Unit:  time.Second,
+						Cost:  1,
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Name:  "endpoints.examples.bookstore.Bookstore.CreateShelf/limits[0]",
+						Key:   RateLimitKeyClientIP,
+						Limit: 10,
+						Unit:  time.Second,
+						Cost:  1,
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+					{
+						Name:  "endpoints.examples.bookstore.Bookstore.DeleteShelf/limits[0]",
+						Key:   RateLimitKeyClientIP,
+						Limit: 10,
+						Unit:  time.Second,
+						Cost:  1,
+					},
+				},
+			},
+		},
+		{
+			desc: "Quota limits with a positive value are enforced with the costs of the metric rules",
+			rateLimitConfig: `{
+				"quota": {
+					"key": "api_key"
+				},
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"requests_per_unit": 5,
+						"unit": "minute"
+					}
+				]
+			}`,
+			wantRateLimits: map[string][]*RateLimit{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Name:  "quota/daily-write-limit",
+						Key:   RateLimitKeyApiKey,
+						Limit: 1000,
+						Unit:  24 * time.Hour,
+						Cost:  2,
+					},
+					{
+						Name:  "quota/write-limit",
+						Key:   RateLimitKeyApiKey,
+						Limit: 60,
+						Unit:  time.Minute,
+						Cost:  2,
+					},
+					{
+						Name:  "endpoints.examples.bookstore.Bookstore.CreateShelf/limits[0]",
+						Key:   RateLimitKeyNone,
+						Limit: 5,
+						Unit:  time.Minute,
+						Cost:  1,
+					},
+				},
+			},
+		},
+		{
+			desc: "Limit keyed by JWT subject for a method requiring a JWT",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"requests_per_unit": 10,
+						"unit": "minute",
+						"key": "jwt_subject"
+					}
+				]
+			}`,
+			wantRateLimits: map[string][]*RateLimit{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Name:  "endpoints.examples.bookstore.Bookstore.CreateShelf/limits[0]",
+						Key:   RateLimitKeyJwtSubject,
+						Limit: 10,
+						Unit:  time.Minute,
+						Cost:  1,
+					},
+				},
+			},
+		},
+		{
+			desc: "Fail with limit keyed by JWT subject for a method allowing requests without a JWT",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.ListShelves",
+						"requests_per_unit": 10,
+						"unit": "minute",
+						"key": "jwt_subject"
+					}
+				]
+			}`,
+			wantedErrorMsg: "rate limit endpoints.examples.bookstore.Bookstore.ListShelves/limits[0] is keyed by JWT subject, but operation endpoints.examples.bookstore.Bookstore.ListShelves does not require a JWT",
+		},
+		{
+			desc: "Fail with limit keyed by JWT subject for a method without authentication rule",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+						"requests_per_unit": 10,
+						"unit": "minute",
+						"key": "jwt_subject"
+					}
+				]
+			}`,
+			wantedErrorMsg: "rate limit endpoints.examples.bookstore.Bookstore.DeleteShelf/limits[0] is keyed by JWT subject, but operation endpoints.examples.bookstore.Bookstore.DeleteShelf does not require a JWT",
+		},
+		{
+			desc: "Fail with invalid unit",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"requests_per_unit": 10,
+						"unit": "week"
+					}
+				]
+			}`,
+			wantedErrorMsg: `rate limit for selector "endpoints.examples.bookstore.Bookstore" has invalid unit "week"`,
+		},
+		{
+			desc: "Fail with non-positive requests_per_unit",
+			rateLimitConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"unit": "second"
+					}
+				]
+			}`,
+			wantedErrorMsg: `rate limit for selector "endpoints.examples.bookstore.Bookstore" must have a positive requests_per_unit`,
+		},
+		{
+			desc: "Fail with invalid key",
+			rateLimitConfig: `{
+				"quota": {
+					"key": "project"
+				}
+			}`,
+			wantedErrorMsg: `invalid rate limit key "project"`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.rateLimitConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.RateLimitConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRateLimits := make(map[string][]*RateLimit)
+		for operation, method := range serviceInfo.Methods {
+			if len(method.RateLimits) > 0 {
+				gotRateLimits[operation] = method.RateLimits
+			}
+		}
+		if diff := cmp.Diff(tc.wantRateLimits, gotRateLimits); diff != "" {
+			t.Errorf("Test Desc(%d): %s, rate limits diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
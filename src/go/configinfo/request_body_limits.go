@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"math"
+)
+
+// requestBodyLimitsConfig is the format of the file specified by
+// --request_body_limits_config_path.
+//
+// Example:
+//
+//	{
+//	  "limits": [
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore",
+//	      "max_request_body_bytes": 2048
+//	    },
+//	    {
+//	      "selector": "endpoints.examples.bookstore.Bookstore.CreateBook",
+//	      "max_request_body_bytes": 1048576
+//	    }
+//	  ]
+//	}
+//
+// The limits override --max_request_body_bytes for the selected operations.
+type requestBodyLimitsConfig struct {
+	Limits []*requestBodyLimitRule `json:"limits"`
+}
+
+type requestBodyLimitRule struct {
+	ruleSelector
+	MaxRequestBodyBytes int64 `json:"max_request_body_bytes"`
+}
+
+func (s *ServiceInfo) processRequestBodyLimitsConfig() error {
+	if s.Options.MaxRequestBodyBytes < 0 || int64(s.Options.MaxRequestBodyBytes) > math.MaxUint32 {
+		return fmt.Errorf("invalid max request body bytes %d, must be between 0 and %d", s.Options.MaxRequestBodyBytes, uint32(math.MaxUint32))
+	}
+	return s.processConfigFile(s.Options.RequestBodyLimitsConfigPath, &requestBodyLimitsConfig{})
+}
+
+func (c *requestBodyLimitsConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	var rules []selectorRule
+	for _, rule := range c.Limits {
+		if rule.MaxRequestBodyBytes <= 0 || rule.MaxRequestBodyBytes > math.MaxUint32 {
+			return nil, fmt.Errorf("request body limit for selector %q must have max_request_body_bytes between 1 and %d", rule.Selector, uint32(math.MaxUint32))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *requestBodyLimitRule) apply(method *methodInfo) error {
+	method.MaxRequestBodyBytes = uint32(r.MaxRequestBodyBytes)
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessRequestBodyLimitsConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc                    string
+		maxRequestBodyBytes     int
+		requestBodyLimitsConfig string
+		wantLimits              map[string]uint32
+		wantedErrorMsg          string
+	}{
+		{
+			desc:                "Limit for an operation wins over the limit for its API",
+			maxRequestBodyBytes: 1024,
+			requestBodyLimitsConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf",
+						"max_request_body_bytes": 1048576
+					},
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"max_request_body_bytes": 2048
+					}
+				]
+			}`,
+			wantLimits: map[string]uint32{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": 2048,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": 1048576,
+			},
+		},
+		{
+			desc:                    "Fail with negative global limit",
+			maxRequestBodyBytes:     -1,
+			requestBodyLimitsConfig: `{}`,
+			wantedErrorMsg:          "invalid max request body bytes -1",
+		},
+		{
+			desc: "Fail without bytes",
+			requestBodyLimitsConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+					}
+				]
+			}`,
+			wantedErrorMsg: `request body limit for selector "endpoints.examples.bookstore.Bookstore.CreateShelf" must have max_request_body_bytes between 1 and 4294967295`,
+		},
+		{
+			desc: "Fail with too many bytes",
+			requestBodyLimitsConfig: `{
+				"limits": [
+					{
+						"selector": "endpoints.examples.bookstore.Bookstore",
+						"max_request_body_bytes": 4294967296
+					}
+				]
+			}`,
+			wantedErrorMsg: `request body limit for selector "endpoints.examples.bookstore.Bookstore" must have max_request_body_bytes between 1 and 4294967295`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.requestBodyLimitsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.MaxRequestBodyBytes = tc.maxRequestBodyBytes
+			opts.RequestBodyLimitsConfigPath = path
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotLimits := make(map[string]uint32)
+		for operation, method := range serviceInfo.Methods {
+			if method.MaxRequestBodyBytes > 0 {
+				gotLimits[operation] = method.MaxRequestBodyBytes
+			}
+		}
+		if diff := cmp.Diff(tc.wantLimits, gotLimits); diff != "" {
+			t.Errorf("Test Desc(%d): %s, request body limits diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServerCertificate is a certificate of the HTTPS listener, served to the
+// clients requesting one of its server names with SNI.
+type ServerCertificate struct {
+	// Lowercase server names, each an exact name or a wildcard such as
+	// *.example.com.
+	ServerNames []string `json:"server_names"`
+	CertPath    string   `json:"cert_path"`
+	KeyPath     string   `json:"key_path"`
+}
+
+// serverCertsConfig is the format of the file specified by
+// --ssl_server_certs_config_path.
+//
+// Example:
+//
+//	{
+//	  "certificates": [
+//	    {
+//	      "server_names": ["api.example.com", "*.api.example.com"],
+//	      "cert_path": "/etc/ssl/api/server.crt",
+//	      "key_path": "/etc/ssl/api/server.key"
+//	    }
+//	  ]
+//	}
+//
+// The certificate in --ssl_server_cert_path is served to the clients without
+// SNI or with other server names.
+type serverCertsConfig struct {
+	Certificates []*ServerCertificate `json:"certificates"`
+}
+
+func (s *ServiceInfo) processServerCertsConfig() error {
+	if s.Options.SslServerCertsConfigPath != "" && s.Options.SslServerCertPath == "" {
+		return fmt.Errorf("SSL server certificates by server name require the default certificate in the SSL server cert path")
+	}
+	return s.processConfigFile(s.Options.SslServerCertsConfigPath, &serverCertsConfig{})
+}
+
+func (c *serverCertsConfig) process(s *ServiceInfo) ([]selectorRule, error) {
+	serverNames := make(map[string]bool)
+	for _, cert := range c.Certificates {
+		if cert.CertPath == "" || cert.KeyPath == "" {
+			return nil, fmt.Errorf("SSL server certificate for server names %v must have cert_path and key_path", cert.ServerNames)
+		}
+		if len(cert.ServerNames) == 0 {
+			return nil, fmt.Errorf("SSL server certificate %s must have server names", cert.CertPath)
+		}
+		for i, name := range cert.ServerNames {
+			name = strings.ToLower(name)
+			if err := validateServerName(name); err != nil {
+				return nil, err
+			}
+			if serverNames[name] {
+				return nil, fmt.Errorf("server name %q is set to more than one SSL server certificate", name)
+			}
+			serverNames[name] = true
+			cert.ServerNames[i] = name
+		}
+		s.ServerCertificates = append(s.ServerCertificates, cert)
+	}
+	return nil, nil
+}
+
+// validateServerName checks the name is one Envoy can match SNI against,
+// which is an exact name or a wildcard for the subdomains of one.
+func validateServerName(name string) error {
+	domain := strings.TrimPrefix(name, "*.")
+	if domain == "" || strings.ContainsAny(domain, "*/: ") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.Contains(domain, "..") {
+		return fmt.Errorf("invalid server name %q, must be a domain name or a wildcard such as *.example.com", name)
+	}
+	return nil
+}
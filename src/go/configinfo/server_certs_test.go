@@ -0,0 +1,158 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessServerCertsConfig(t *testing.T) {
+	fakeServiceConfig := newTestServiceConfig()
+
+	testData := []struct {
+		desc                   string
+		serverCertsConfig      string
+		sslServerCertPath      string
+		wantServerCertificates []*ServerCertificate
+		wantedErrorMsg         string
+	}{
+		{
+			desc: "Certificates with exact and wildcard server names",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["API.example.com", "*.api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					},
+					{
+						"server_names": ["www.example.com"],
+						"cert_path": "/etc/ssl/www/server.crt",
+						"key_path": "/etc/ssl/www/server.key"
+					}
+				]
+			}`,
+			sslServerCertPath: "/etc/ssl/endpoints",
+			wantServerCertificates: []*ServerCertificate{
+				{
+					ServerNames: []string{"api.example.com", "*.api.example.com"},
+					CertPath:    "/etc/ssl/api/server.crt",
+					KeyPath:     "/etc/ssl/api/server.key",
+				},
+				{
+					ServerNames: []string{"www.example.com"},
+					CertPath:    "/etc/ssl/www/server.crt",
+					KeyPath:     "/etc/ssl/www/server.key",
+				},
+			},
+		},
+		{
+			desc: "Fail without the default certificate",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					}
+				]
+			}`,
+			wantedErrorMsg: "SSL server certificates by server name require the default certificate in the SSL server cert path",
+		},
+		{
+			desc: "Fail without a key path",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt"
+					}
+				]
+			}`,
+			sslServerCertPath: "/etc/ssl/endpoints",
+			wantedErrorMsg:    "SSL server certificate for server names [api.example.com] must have cert_path and key_path",
+		},
+		{
+			desc: "Fail without server names",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					}
+				]
+			}`,
+			sslServerCertPath: "/etc/ssl/endpoints",
+			wantedErrorMsg:    "SSL server certificate /etc/ssl/api/server.crt must have server names",
+		},
+		{
+			desc: "Fail with a wildcard in the middle of a server name",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.*.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					}
+				]
+			}`,
+			sslServerCertPath: "/etc/ssl/endpoints",
+			wantedErrorMsg:    `invalid server name "api.*.example.com", must be a domain name or a wildcard such as *.example.com`,
+		},
+		{
+			desc: "Fail with a server name of two certificates",
+			serverCertsConfig: `{
+				"certificates": [
+					{
+						"server_names": ["api.example.com"],
+						"cert_path": "/etc/ssl/api/server.crt",
+						"key_path": "/etc/ssl/api/server.key"
+					},
+					{
+						"server_names": ["Api.Example.com"],
+						"cert_path": "/etc/ssl/api2/server.crt",
+						"key_path": "/etc/ssl/api2/server.key"
+					}
+				]
+			}`,
+			sslServerCertPath: "/etc/ssl/endpoints",
+			wantedErrorMsg:    `server name "api.example.com" is set to more than one SSL server certificate`,
+		},
+	}
+
+	for i, tc := range testData {
+		serviceInfo, err := processTestConfigFile(t, fakeServiceConfig, tc.serverCertsConfig, func(opts *options.ConfigGeneratorOptions, path string) {
+			opts.SslServerCertsConfigPath = path
+			opts.SslServerCertPath = tc.sslServerCertPath
+		})
+		if tc.wantedErrorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedErrorMsg) {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantedErrorMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.wantServerCertificates, serviceInfo.ServerCertificates); diff != "" {
+			t.Errorf("Test Desc(%d): %s, server certificates diff (-want +got):\n%s", i, tc.desc, diff)
+		}
+	}
+}
@@ -65,6 +65,46 @@ type ServiceInfo struct {
 	GrpcSupportRequired    bool
 	CatchAllBackend        *BackendRoutingCluster
 	BackendRoutingClusters []*BackendRoutingCluster
+
+	// Header rules applied to all requests.
+	HeaderRules *HeaderRules
+
+	// Backend clusters of the API versions, and the request header selecting
+	// the version if routing is not by path only.
+	ApiVersionClusters []*BackendRoutingCluster
+	ApiVersionHeader   string
+
+	// Canary applied to all routes without their own, the clusters of the
+	// canary backends, and the header forcing requests to the canary.
+	Canary               *Canary
+	CanaryClusters       []*BackendRoutingCluster
+	CanaryOverrideHeader *HeaderValue
+
+	// Mirror targets applied to all routes without their own, and their
+	// clusters.
+	MirrorTargets  []*MirrorTarget
+	MirrorClusters []*BackendRoutingCluster
+
+	// External authorization service checking the requests, nil if none.
+	ExtAuthz *ExtAuthz
+
+	// JWKS of the authentication providers with local JWKS, keyed by provider
+	// ID, and the files they are read from.
+	LocalJwks      map[string]string
+	LocalJwksFiles []string
+
+	// Request headers the verified JWT payloads are forwarded in, keyed by
+	// provider ID, and the headers set to claims of the payloads.
+	JwtPayloadHeaders map[string]*JwtPayloadHeader
+	JwtClaimHeaders   []*JwtClaimHeader
+
+	// Cookies the JWTs of the authentication providers are also read from,
+	// keyed by provider ID.
+	JwtCookies map[string][]string
+
+	// Certificates of the HTTPS listener selected by SNI, besides the one in
+	// the SSL server cert path.
+	ServerCertificates []*ServerCertificate
 }
 
 type BackendRoutingCluster struct {
@@ -73,6 +113,8 @@ type BackendRoutingCluster struct {
 	Port        uint32
 	UseTLS      bool
 	Protocol    util.BackendProtocol
+	// TLS settings of the backend overriding the global ones, nil if none.
+	Tls *BackendTls
 }
 
 // NewServiceInfoFromServiceConfig returns an instance of ServiceInfo.
@@ -100,12 +142,23 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	// * BackendInfo map to MethodInfo
 	//    set by processApi
 	//    used by processBackendRule
+	// * CorsPolicy:
+	//    set by processCorsConfig
+	//    used by processHttpRule
 	// * GrpcSupportRequired:
-	//     set by processBackendRule, buildCatchAllBackend
+	//     set by processBackendRule, buildCatchAllBackend, processApiVersionRouting,
+	//       processCanaryConfig, processMirrorConfig
 	//     used by addGrpcHttpRules
 	// * Methods:
 	//		 set by processApis, processHttpRule, addGrpcHttpRules, processUsageRule
 	//     used by processApiKeyLocations
+	// * MetricCosts:
+	//    set by processQuota
+	//    used by processRateLimitConfig
+	// * Backend clusters:
+	//    set by buildCatchAllBackend, processBackendRule, processApiVersionRouting,
+	//      processCanaryConfig, processMirrorConfig, processExtAuthzConfig
+	//    used by processBackendTlsConfig
 	if err := serviceInfo.buildCatchAllBackend(); err != nil {
 		return nil, err
 	}
@@ -115,6 +168,18 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if err := serviceInfo.processBackendRule(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processApiVersionRouting(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processCanaryConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processMirrorConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processCorsConfig(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processHttpRule(); err != nil {
 		return nil, err
 	}
@@ -133,7 +198,41 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if err := serviceInfo.processApiKeyLocations(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processRateLimitConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processRequestBodyLimitsConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processHeaderRulesConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processFaultConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processExtAuthzConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtClaimsConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtHeadersConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtCookies(); err != nil {
+		return nil, err
+	}
 
+	if err := serviceInfo.processServerCertsConfig(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendTlsConfig(); err != nil {
+		return nil, err
+	}
+
+	if err := serviceInfo.processLocalJwks(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processEmptyJwksUriByOpenID(); err != nil {
 		return nil, err
 	}
@@ -181,6 +280,9 @@ func (s *ServiceInfo) ServiceConfig() *confpb.Service {
 func (s *ServiceInfo) processEmptyJwksUriByOpenID() error {
 	authn := s.serviceConfig.GetAuthentication()
 	for _, provider := range authn.GetProviders() {
+		if _, ok := s.LocalJwks[provider.GetId()]; ok {
+			continue
+		}
 		jwksUri := provider.GetJwksUri()
 
 		// Note: When jwksUri is empty, proxy will try to find jwksUri using the
@@ -348,17 +450,29 @@ func (s *ServiceInfo) processHttpRule() error {
 	}
 
 	// In order to support CORS. HTTP method OPTIONS needs to be added to all
-	// urls except the ones already with options.
-	if s.AllowCors {
-		for _, r := range s.ServiceConfig().GetHttp().GetRules() {
-			method := s.Methods[r.GetSelector()]
-			for _, httpRule := range method.HttpRule {
-				if httpRule.HttpMethod != "OPTIONS" {
-					if _, exist := httpPathWithOptionsSet[httpRule.UriTemplate]; !exist {
-						s.addOptionMethod(method.ApiName, httpRule.UriTemplate, method.BackendInfo)
-						httpPathWithOptionsSet[httpRule.UriTemplate] = true
+	// urls except the ones already with options. Methods with their own CORS
+	// policy get OPTIONS even if CORS is not allowed for the whole service.
+	// The OPTIONS method answers the preflight requests of all the methods of
+	// its url, so they must have the same CORS policy.
+	optionsMethods := make(map[string]*methodInfo)
+	for _, r := range s.ServiceConfig().GetHttp().GetRules() {
+		method := s.Methods[r.GetSelector()]
+		if !s.AllowCors && method.CorsPolicy == nil {
+			continue
+		}
+		for _, httpRule := range method.HttpRule {
+			if httpRule.HttpMethod != "OPTIONS" {
+				if other, exist := optionsMethods[httpRule.UriTemplate]; exist {
+					if !sameCorsPolicy(other.CorsPolicy, method.CorsPolicy) {
+						return fmt.Errorf("methods %s.%s and %s.%s share the url %s but have different CORS policies",
+							other.ApiName, other.ShortName, method.ApiName, method.ShortName, httpRule.UriTemplate)
 					}
-
+					continue
+				}
+				if _, exist := httpPathWithOptionsSet[httpRule.UriTemplate]; !exist {
+					s.addOptionMethod(method.ApiName, httpRule.UriTemplate, method.BackendInfo, method.CorsPolicy)
+					httpPathWithOptionsSet[httpRule.UriTemplate] = true
+					optionsMethods[httpRule.UriTemplate] = method
 				}
 			}
 		}
@@ -385,7 +499,7 @@ func (s *ServiceInfo) processHttpRule() error {
 	return nil
 }
 
-func (s *ServiceInfo) addOptionMethod(apiName string, path string, backendInfo *backendInfo) {
+func (s *ServiceInfo) addOptionMethod(apiName string, path string, backendInfo *backendInfo, corsPolicy *CorsPolicy) {
 	// All options have their operation as the following format: CORS_${suffix}.
 	// Appends ${suffix} to make sure it is not used by any http rules.
 	//
@@ -412,6 +526,7 @@ func (s *ServiceInfo) addOptionMethod(apiName string, path string, backendInfo *
 		},
 		IsGenerated: true,
 		BackendInfo: backendInfo,
+		CorsPolicy:  corsPolicy,
 	}
 }
 
@@ -571,6 +686,11 @@ func (s *ServiceInfo) processApiKeyLocations() error {
 		s.extractApiKeyLocations(method, apiKeyLocationParameters)
 	}
 
+	cookies, err := s.parseApiKeyCookies()
+	if err != nil {
+		return err
+	}
+
 	for _, method := range s.Methods {
 		// If any of method is not set with custom ApiKeyLocations, use the default
 		// one and set the custom ApiKeyLocations in query parameter for transcoder
@@ -578,13 +698,49 @@ func (s *ServiceInfo) processApiKeyLocations() error {
 		if len(method.ApiKeyLocations) == 0 {
 			s.AllTranscodingIgnoredQueryParams[util.DefaultApiKeyQueryParamKey] = true
 			s.AllTranscodingIgnoredQueryParams[util.DefaultApiKeyQueryParamApiKey] = true
+			// The default locations must be explicit to be kept with the
+			// cookies.
+			if len(cookies) > 0 {
+				method.ApiKeyLocations = defaultApiKeyLocations()
+			}
 		}
 
+		// Cookies are looked up after the other locations.
+		for _, cookie := range cookies {
+			s.AllTranscodingIgnoredQueryParams[cookie] = true
+			method.ApiKeyLocations = append(method.ApiKeyLocations, &scpb.ApiKeyLocation{
+				Key: &scpb.ApiKeyLocation_Cookie{
+					Cookie: cookie,
+				},
+			})
+		}
 	}
 
 	return nil
 }
 
+// defaultApiKeyLocations returns the locations the API key is looked up in
+// when the service config does not have any.
+func defaultApiKeyLocations() []*scpb.ApiKeyLocation {
+	return []*scpb.ApiKeyLocation{
+		{
+			Key: &scpb.ApiKeyLocation_Query{
+				Query: util.DefaultApiKeyQueryParamKey,
+			},
+		},
+		{
+			Key: &scpb.ApiKeyLocation_Query{
+				Query: util.DefaultApiKeyQueryParamApiKey,
+			},
+		},
+		{
+			Key: &scpb.ApiKeyLocation_Header{
+				Header: util.DefaultApiKeyHeaderName,
+			},
+		},
+	}
+}
+
 func (s *ServiceInfo) extractApiKeyLocations(method *methodInfo, parameters []*confpb.SystemParameter) {
 	var urlQueryNames, headerNames []*scpb.ApiKeyLocation
 	for _, parameter := range parameters {
@@ -657,6 +813,29 @@ func (s *ServiceInfo) getOrCreateMethod(name string) (*methodInfo, error) {
 	return s.Methods[name], nil
 }
 
+// makeBackendRoutingCluster makes the cluster of an additional backend at
+// address. The caller names the cluster.
+func (s *ServiceInfo) makeBackendRoutingCluster(address string) (*BackendRoutingCluster, error) {
+	scheme, hostname, port, _, err := util.ParseURI(address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing backend uri: %v", err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return nil, err
+	}
+	if protocol == util.GRPC {
+		s.GrpcSupportRequired = true
+	}
+
+	return &BackendRoutingCluster{
+		Hostname: hostname,
+		Port:     port,
+		UseTLS:   tls,
+		Protocol: protocol,
+	}, nil
+}
+
 func (s *ServiceInfo) BackendClusterName() string {
 	return fmt.Sprintf("%s_local", s.Name)
 }
@@ -22,11 +22,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/ratelimit"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/golang/glog"
@@ -50,6 +53,9 @@ var (
 					GCP metadata server will not be called to fetch access token, and
 					following flags will be ignored; --service_config_id, --service,
 					--rollout_strategy`)
+
+	checkConfigFilesInterval = flag.Duration("check_config_files_interval", 10*time.Second, `the interval periodically to check whether the file of --canary_config_path, the local JWKS files or
+					the TLS files served as SDS secrets changed.`)
 )
 
 // Config Manager handles service configuration fetching and updating.
@@ -59,12 +65,25 @@ type ConfigManager struct {
 	envoyConfigOptions options.ConfigGeneratorOptions
 	serviceInfo        *configinfo.ServiceInfo
 	cache              cache.SnapshotCache
+	rateLimitService   *ratelimit.RateLimitService
 
 	metadataFetcher         *metadata.MetadataFetcher
 	serviceConfigFetcher    *sc.ServiceConfigFetcher
 	rolloutIdChangeDetector *sc.RolloutIdChangeDetector
 
+	// Guards applying service configs, which happens on new rollouts and on
+	// changes of the watched config files.
+	mu               sync.Mutex
 	curServiceConfig *confpb.Service
+	// Modification times of the watched config files used by the current
+	// snapshot: the canary config, the local JWKS files and the TLS files of
+	// the SDS secrets.
+	configFileModTimes map[string]time.Time
+	// TLS files of the SDS secrets in the last snapshot made.
+	secretFiles []string
+	// Number of times the snapshot was remade without a new service config,
+	// which is part of its version so Envoy picks up the changes.
+	snapshotGeneration int
 }
 
 // NewConfigManager creates new instance of Config Manager.
@@ -73,6 +92,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 	m := &ConfigManager{
 		metadataFetcher:    mf,
 		envoyConfigOptions: opts,
+		rateLimitService:   ratelimit.NewRateLimitService(),
 	}
 	m.cache = cache.NewSnapshotCache(true, m, m)
 
@@ -92,6 +112,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 		if err := m.readAndApplyServiceConfig(*ServicePath); err != nil {
 			return nil, err
 		}
+		m.watchConfigFiles()
 
 		glog.Infof("create new Config Manager from static service config json file at %v", *ServicePath)
 		return m, nil
@@ -176,6 +197,9 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 	if rolloutStrategy == util.ManagedRolloutStrategy {
 		m.rolloutIdChangeDetector = sc.NewRolloutIdChangeDetector(client, opts.ServiceControlURL, m.serviceName, accessToken)
 		m.rolloutIdChangeDetector.SetDetectRolloutIdChangeTimer(*checkNewRolloutInterval, func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
 			latestConfigId, err := m.serviceConfigFetcher.LoadConfigIdFromRollouts()
 			if err != nil {
 				glog.Errorf("error occurred when getting configId by fetching rollout, %v", err)
@@ -187,6 +211,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 			}
 		})
 	}
+	m.watchConfigFiles()
 
 	glog.Infof("create new Config Manager for service (%v) with configuration id (%v), %v rollout strategy",
 		m.serviceName, m.curConfigId(), rolloutStrategy)
@@ -227,6 +252,18 @@ func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error
 		return fmt.Errorf("applid service config is empty")
 	}
 
+	// The modification times are taken before the files are read, so changes
+	// made meanwhile are applied by the next check. Files watched so far stay
+	// watched if the ServiceInfo cannot be made.
+	modTimes := make(map[string]time.Time)
+	for path := range m.configFileModTimes {
+		modTimes[path] = fileModTime(path)
+	}
+	if path := m.envoyConfigOptions.CanaryConfigPath; path != "" {
+		modTimes[path] = fileModTime(path)
+	}
+	m.configFileModTimes = modTimes
+
 	var err error
 	m.curServiceConfig = serviceConfig
 	m.serviceInfo, err = configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, m.envoyConfigOptions)
@@ -234,6 +271,18 @@ func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error
 		return fmt.Errorf("fail to initialize ServiceInfo, %s", err)
 	}
 
+	m.configFileModTimes = make(map[string]time.Time)
+	if path := m.envoyConfigOptions.CanaryConfigPath; path != "" {
+		m.configFileModTimes[path] = modTimes[path]
+	}
+	for _, path := range m.serviceInfo.LocalJwksFiles {
+		if modTime, ok := modTimes[path]; ok {
+			m.configFileModTimes[path] = modTime
+		} else {
+			m.configFileModTimes[path] = fileModTime(path)
+		}
+	}
+
 	if m.metadataFetcher != nil {
 		attrs, err := m.metadataFetcher.FetchGCPAttributes()
 		if err != nil {
@@ -247,6 +296,14 @@ func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error
 	if err != nil {
 		return fmt.Errorf("fail to make a snapshot, %s", err)
 	}
+	for _, path := range m.secretFiles {
+		if modTime, ok := modTimes[path]; ok {
+			m.configFileModTimes[path] = modTime
+		} else {
+			m.configFileModTimes[path] = fileModTime(path)
+		}
+	}
+	m.rateLimitService.Update(m.serviceInfo)
 	return m.cache.SetSnapshot(m.envoyConfigOptions.Node, *snapshot)
 }
 
@@ -271,11 +328,70 @@ func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
 		listenerResources = append(listenerResources, lis)
 	}
 
-	snapshot := cache.NewSnapshot(m.curConfigId(), endpoints, clusterResources, routes, listenerResources, runtimes)
+	var secretResources []types.Resource
+	m.secretFiles = nil
+	if m.envoyConfigOptions.EnableSds {
+		secrets, files, err := gen.MakeSecrets(listeners, clusters)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets {
+			secretResources = append(secretResources, secret)
+		}
+		m.secretFiles = files
+	}
+
+	snapshot := cache.NewSnapshot(m.snapshotVersion(), endpoints, clusterResources, routes, listenerResources, runtimes)
+	snapshot.Resources[types.Secret] = cache.NewResources(m.snapshotVersion(), secretResources)
 	m.Infof("Envoy Dynamic Configuration is cached for service: %v", m.serviceName)
 	return &snapshot, nil
 }
 
+// watchConfigFiles periodically remakes the snapshot with the current service
+// config if a watched config file changed, so canary weights and local JWKS
+// can be changed without a new rollout.
+func (m *ConfigManager) watchConfigFiles() {
+	go func() {
+		for range time.Tick(*checkConfigFilesInterval) {
+			m.mu.Lock()
+			if err := m.reloadConfigFiles(); err != nil {
+				glog.Errorf("error occurred when applying changed config files, %v", err)
+			}
+			m.mu.Unlock()
+		}
+	}()
+}
+
+func (m *ConfigManager) reloadConfigFiles() error {
+	for path, modTime := range m.configFileModTimes {
+		if fileModTime(path).Equal(modTime) {
+			continue
+		}
+
+		glog.Infof("config file %v changed, applying it with configuration id %v", path, m.curConfigId())
+		m.snapshotGeneration++
+		return m.applyServiceConfig(m.curServiceConfig)
+	}
+	return nil
+}
+
+// fileModTime returns the modification time of the file at path, or the zero
+// time if it cannot be read.
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (m *ConfigManager) snapshotVersion() string {
+	if m.snapshotGeneration == 0 {
+		return m.curConfigId()
+	}
+	return fmt.Sprintf("%s-%d", m.curConfigId(), m.snapshotGeneration)
+}
+
 func (m *ConfigManager) curConfigId() string {
 	if m.curServiceConfig == nil {
 		return ""
@@ -308,6 +424,9 @@ func (m *ConfigManager) Errorf(format string, args ...interface{}) { glog.Errorf
 // Cache returns snapshot cache.
 func (m *ConfigManager) Cache() cache.Cache { return m.cache }
 
+// RateLimitService returns the rate limit service for the local rate limits.
+func (m *ConfigManager) RateLimitService() *ratelimit.RateLimitService { return m.rateLimitService }
+
 func httpsClient(opts options.ConfigGeneratorOptions) (*http.Client, error) {
 	caCert, err := ioutil.ReadFile(opts.RootCertsPath)
 	if err != nil {
@@ -18,8 +18,11 @@ import (
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
@@ -1583,6 +1586,251 @@ func TestDynamicBackendRouting(t *testing.T) {
 	}
 }
 
+func TestCanaryConfigReload(t *testing.T) {
+	canaryConfig, err := ioutil.TempFile("", "canary-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(canaryConfig.Name())
+	canaryConfig.Close()
+
+	writeCanaryConfig := func(address string, modTime time.Time) {
+		content := fmt.Sprintf(`{"address": %q, "weight": 10}`, address)
+		if err := ioutil.WriteFile(canaryConfig.Name(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(canaryConfig.Name(), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetchClusters := func(manager *ConfigManager) (string, map[string]bool) {
+		resp, err := manager.cache.Fetch(context.Background(), v2pb.DiscoveryRequest{
+			Node: &corepb.Node{
+				Id: manager.envoyConfigOptions.Node,
+			},
+			TypeUrl: rspb.ClusterType,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]bool)
+		for _, r := range resp.Resources {
+			names[cache.GetResourceName(r)] = true
+		}
+		return resp.Version, names
+	}
+
+	modTime := time.Now().Add(-time.Minute)
+	writeCanaryConfig("http://canary-a:8080", modTime)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:8082"
+	opts.DisableTracing = true
+	opts.CanaryConfigPath = canaryConfig.Name()
+
+	_ = flag.Set("service_json_path", "testdata/service_config_for_dynamic_routing.json")
+	_ = flag.Set("check_config_files_interval", "100ms")
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	version, names := fetchClusters(manager)
+	if version != testConfigID || !names["canary_canary-a:8080"] {
+		t.Errorf("snapshot cache fetch got version %v with clusters %v, want version %v with cluster canary_canary-a:8080", version, names, testConfigID)
+	}
+
+	writeCanaryConfig("http://canary-b:8080", modTime.Add(time.Second))
+	time.Sleep(time.Duration(*checkConfigFilesInterval * 5))
+
+	wantVersion := testConfigID + "-1"
+	version, names = fetchClusters(manager)
+	if version != wantVersion || !names["canary_canary-b:8080"] || names["canary_canary-a:8080"] {
+		t.Errorf("snapshot cache fetch got version %v with clusters %v, want version %v with cluster canary_canary-b:8080 only", version, names, wantVersion)
+	}
+}
+
+func TestLocalJwksReload(t *testing.T) {
+	jwksFile, err := ioutil.TempFile("", "jwks-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(jwksFile.Name())
+	jwksFile.Close()
+
+	serviceConfig, err := ioutil.TempFile("", "service-config-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(serviceConfig.Name())
+	if _, err := serviceConfig.WriteString(fmt.Sprintf(`{
+		"name": "%s",
+		"id": "%s",
+		"apis": [
+			{
+				"name": "endpoints.examples.bookstore.Bookstore"
+			}
+		],
+		"authentication": {
+			"providers": [
+				{
+					"id": "auth_provider",
+					"issuer": "issuer-0",
+					"jwksUri": "file://%s"
+				}
+			]
+		}
+	}`, testProjectName, testConfigID, jwksFile.Name())); err != nil {
+		t.Fatal(err)
+	}
+	serviceConfig.Close()
+
+	writeJwks := func(kid string, modTime time.Time) {
+		content := fmt.Sprintf(`{"keys": [{"kid": %q}]}`, kid)
+		if err := ioutil.WriteFile(jwksFile.Name(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(jwksFile.Name(), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetchListener := func(manager *ConfigManager) (string, string) {
+		resp, err := manager.cache.Fetch(context.Background(), v2pb.DiscoveryRequest{
+			Node: &corepb.Node{
+				Id: manager.envoyConfigOptions.Node,
+			},
+			TypeUrl: rspb.ListenerType,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshaler := &jsonpb.Marshaler{
+			AnyResolver: util.Resolver,
+		}
+		listener, err := marshaler.MarshalToString(resp.Resources[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Version, listener
+	}
+
+	modTime := time.Now().Add(-time.Minute)
+	writeJwks("kid-a", modTime)
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:8082"
+	opts.DisableTracing = true
+
+	_ = flag.Set("service_json_path", serviceConfig.Name())
+	_ = flag.Set("check_config_files_interval", "100ms")
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	version, listener := fetchListener(manager)
+	if version != testConfigID || !strings.Contains(listener, "kid-a") {
+		t.Errorf("snapshot cache fetch got version %v with listener %v, want version %v with JWKS of kid-a", version, listener, testConfigID)
+	}
+
+	writeJwks("kid-b", modTime.Add(time.Second))
+	time.Sleep(time.Duration(*checkConfigFilesInterval * 5))
+
+	wantVersion := testConfigID + "-1"
+	version, listener = fetchListener(manager)
+	if version != wantVersion || !strings.Contains(listener, "kid-b") {
+		t.Errorf("snapshot cache fetch got version %v with listener %v, want version %v with JWKS of kid-b", version, listener, wantVersion)
+	}
+}
+
+func TestTlsSecretsReload(t *testing.T) {
+	sslDir, err := ioutil.TempDir("", "ssl-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sslDir)
+	certFile := filepath.Join(sslDir, "server.crt")
+
+	serviceConfig, err := ioutil.TempFile("", "service-config-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(serviceConfig.Name())
+	if _, err := serviceConfig.WriteString(fmt.Sprintf(`{
+		"name": "%s",
+		"id": "%s",
+		"apis": [
+			{
+				"name": "endpoints.examples.bookstore.Bookstore"
+			}
+		]
+	}`, testProjectName, testConfigID)); err != nil {
+		t.Fatal(err)
+	}
+	serviceConfig.Close()
+
+	writeCert := func(cert string, modTime time.Time) {
+		if err := ioutil.WriteFile(certFile, []byte(cert), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(certFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetchSecret := func(manager *ConfigManager) (string, *authpb.Secret) {
+		resp, err := manager.cache.Fetch(context.Background(), v2pb.DiscoveryRequest{
+			Node: &corepb.Node{
+				Id: manager.envoyConfigOptions.Node,
+			},
+			TypeUrl:       rspb.SecretType,
+			ResourceNames: []string{fmt.Sprintf("tls_certificate:%s:%s", certFile, filepath.Join(sslDir, "server.key"))},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Resources) != 1 {
+			t.Fatalf("snapshot cache fetch got %d secrets, want 1", len(resp.Resources))
+		}
+		return resp.Version, resp.Resources[0].(*authpb.Secret)
+	}
+
+	modTime := time.Now().Add(-time.Minute)
+	writeCert("cert-a", modTime)
+	if err := ioutil.WriteFile(filepath.Join(sslDir, "server.key"), []byte("key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:8082"
+	opts.DisableTracing = true
+	opts.SslServerCertPath = sslDir
+	opts.EnableSds = true
+
+	_ = flag.Set("service_json_path", serviceConfig.Name())
+	_ = flag.Set("check_config_files_interval", "100ms")
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	version, secret := fetchSecret(manager)
+	if gotCert := string(secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes()); version != testConfigID || gotCert != "cert-a" {
+		t.Errorf("snapshot cache fetch got version %v with certificate %v, want version %v with cert-a", version, gotCert, testConfigID)
+	}
+
+	writeCert("cert-b", modTime.Add(time.Second))
+	time.Sleep(time.Duration(*checkConfigFilesInterval * 5))
+
+	wantVersion := testConfigID + "-1"
+	version, secret = fetchSecret(manager)
+	if gotCert := string(secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes()); version != wantVersion || gotCert != "cert-b" {
+		t.Errorf("snapshot cache fetch got version %v with certificate %v, want version %v with cert-b", version, gotCert, wantVersion)
+	}
+}
+
 func TestServiceConfigAutoUpdate(t *testing.T) {
 	var oldConfigID, oldRolloutID, newConfigID, newRolloutID string
 	oldConfigID = "2018-12-05r0"
@@ -38,12 +38,51 @@ var (
 	CorsAllowOriginRegex = flag.String("cors_allow_origin_regex", "", "set Access-Control-Allow-Origin to a regular expression")
 	CorsExposeHeaders    = flag.String("cors_expose_headers", "", "set Access-Control-Expose-Headers to the specified headers")
 	CorsPreset           = flag.String("cors_preset", "", `enable CORS support, must be either "basic" or "cors_with_regex"`)
+	CorsConfigPath       = flag.String("cors_config_path", "", `Path to a JSON file with CORS policies applied to individual operations or APIs. Each policy selects
+	an operation name or an API name and overrides the --cors_* flags for the routes of the selected methods. The policies
+	of the file also override the ones set by the "espv2.cors_policy" options of the APIs and methods in the service config.`)
 
 	// Backend routing configurations.
 	BackendDnsLookupFamily = flag.String("backend_dns_lookup_family", "auto", `Define the dns lookup family for all backends. The options are "auto", "v4only" and "v6only". The default is "auto".`)
 
 	// Envoy specific configurations.
 	ClusterConnectTimeout = flag.Duration("cluster_connect_timeout", 20*time.Second, "cluster connect timeout in seconds")
+	RateLimitConfigPath   = flag.String("rate_limit_config_path", "", `Path to a JSON file with local token bucket rate limits for operations or APIs, optionally keyed by
+	API key, JWT subject or client IP. It can also enforce the quota limits of the service config locally. Requests over a limit
+	get 429 with a Retry-After header. Limits are checked by a rate limit service in the config manager, so they work with
+	--non_gcp and --service_json_path but cannot be used with a static bootstrap config. They are not enforced when the config
+	manager is unreachable, unless --rate_limit_failure_mode_deny is set.`)
+	RateLimitFailureModeDeny = flag.Bool("rate_limit_failure_mode_deny", false, `If true, requests to operations with rate limits
+	get 500 when the rate limits served by the config manager cannot be checked. By default they are allowed.`)
+
+	HeaderRulesConfigPath = flag.String("header_rules_config_path", "", `Path to a JSON file with rules to add, set and remove request headers sent to the backend and
+	response headers sent to the client, globally or for operations or APIs. Headers to remove must be exact names, patterns such as x-internal-* are
+	not supported.`)
+
+	ApiVersionRoutingConfigPath = flag.String("api_version_routing_config_path", "", `Path to a JSON file with a backend address for each API version. Requests to the methods
+	of an API are routed to the backend of its version, optionally only when a request header selects that version.`)
+
+	CanaryConfigPath = flag.String("canary_config_path", "", `Path to a JSON file with a canary backend and the percentage of requests sent to it, globally or
+	for operations or APIs. Requests with the override header always go to the canary. The file is watched by the config
+	manager, so weights can be changed without a service config rollout.`)
+
+	MirrorConfigPath = flag.String("mirror_config_path", "", `Path to a JSON file with backends that get a copy of a percentage of the requests, globally or for
+	operations or APIs. Their responses are discarded, and the copies are not reported to Service Control. Each backend
+	address is either scheme://host:port or host:port, which uses https.`)
+
+	FaultConfigPath = flag.String("fault_config_path", "", `Path to a JSON file with delays and aborts injected into a percentage of the requests to operations or
+	APIs, optionally only into requests with given headers. Meant for resilience testing, not for production.`)
+
+	ExtAuthzConfigPath = flag.String("ext_authz_config_path", "", `Path to a JSON file with a gRPC or HTTP external authorization service that must approve requests
+	after JWT authentication, its timeout, whether requests are allowed when it fails, the headers sent to it and the operations
+	or APIs it does not check.`)
+
+	JwtClaimsConfigPath = flag.String("jwt_claims_config_path", "", `Path to a JSON file with claims the verified JWT must have for operations or APIs, matched exactly,
+	by containing a value, by prefix or against a list of values. Nested claims are named with dots, such as realm_access.roles.
+	Requests without them are rejected with 403 naming the first claim they do not meet. Other operations are not checked.`)
+
+	JwtHeadersConfigPath = flag.String("jwt_headers_config_path", "", `Path to a JSON file mapping claims of the verified JWT, including nested ones as dotted paths, to
+	request headers sent to the backend, and with the header and the encoding of the forwarded JWT payload of each provider.`)
 
 	// Network related configurations.
 	BackendAddress       = flag.String("backend_address", "http://127.0.0.1:8082", `The application server URI to which ESPv2 proxies requests.`)
@@ -61,6 +100,39 @@ var (
 	RootCertsPath      = flag.String("root_certs_path", util.DefaultRootCAPaths, "Path to the root certificates to make TLS connection.")
 	EnableHSTS         = flag.Bool("enable_strict_transport_security", false, "Enable HSTS (HTTP Strict Transport Security).")
 
+	SslPort = flag.Int("ssl_port", 0, `Port of an HTTPS listener using the certificate in --ssl_server_cert_path, besides the plaintext listener on
+	--listener_port. By default, there is only one listener on --listener_port, which uses HTTPS if --ssl_server_cert_path is set.`)
+	HttpToHttpsRedirect = flag.Bool("http_to_https_redirect", false, `Redirect the requests to the plaintext listener to the HTTPS listener on --ssl_port, except health checks.`)
+
+	SslServerRootCertsPath = flag.String("ssl_server_root_certs_path", "", `Path to the root certificates that ESPv2 uses to validate the client certificates of HTTPS
+	requests. The subject and the SANs of a verified client certificate are forwarded to the backend in the x-forwarded-client-cert header,
+	which is also logged through service control. Requires --ssl_server_cert_path.`)
+	SslServerRequireClientCert = flag.Bool("ssl_server_require_client_cert", false, `Reject the HTTPS connections without a valid client certificate. Otherwise, only the
+	client certificates sent are validated. Requires --ssl_server_root_certs_path, and --http_to_https_redirect with --ssl_port.`)
+	SslServerClientSans = flag.String("ssl_server_client_sans", "", `The subject alt names allowed in the client certificates, separated by comma. A client
+	certificate must have one of them. Requires --ssl_server_root_certs_path, and --http_to_https_redirect with --ssl_port.`)
+	SslServerCipherSuites = flag.String("ssl_server_cipher_suites", "", `Cipher suites of TLS 1.0-1.2 allowed for Downstream connections in order of preference,
+	separated by comma, such as ECDHE-ECDSA-AES128-GCM-SHA256,ECDHE-RSA-AES128-GCM-SHA256. Suites of equal preference can be grouped as
+	[ECDHE-ECDSA-AES128-GCM-SHA256|ECDHE-ECDSA-CHACHA20-POLY1305]. By default, the cipher suites of Envoy are allowed.`)
+	SslServerEcdhCurves = flag.String("ssl_server_ecdh_curves", "", `ECDH curves allowed for Downstream connections, separated by comma, among X25519, P-256,
+	P-384 and P-521. By default, X25519 and P-256 are allowed.`)
+	SslServerSessionTimeout        = flag.Duration("ssl_server_session_timeout", 0, `Lifetime of the TLS sessions of Downstream connections. By default, it is 2 hours.`)
+	SslServerDisableSessionTickets = flag.Bool("ssl_server_disable_session_tickets", false, `Do not issue TLS session tickets to Downstream clients, so only the sessions
+	cached by Envoy are resumed.`)
+	SslClientCipherSuites = flag.String("ssl_client_cipher_suites", "", `Cipher suites allowed for Upstream connections to the backends and the other clusters, in
+	the format of --ssl_server_cipher_suites.`)
+	SslClientEcdhCurves               = flag.String("ssl_client_ecdh_curves", "", `ECDH curves allowed for Upstream connections, in the format of --ssl_server_ecdh_curves.`)
+	SslClientDisableSessionResumption = flag.Bool("ssl_client_disable_session_resumption", false, `Do not resume TLS sessions of Upstream connections, so every
+	connection makes a full handshake.`)
+	SslServerCertsConfigPath = flag.String("ssl_server_certs_config_path", "", `Path to a JSON file with more certificates of the HTTPS listener, each with the server
+	names it is served to with SNI. The certificate in --ssl_server_cert_path is served to the other clients.`)
+	BackendTlsConfigPath = flag.String("backend_tls_config_path", "", `Path to a JSON file with TLS settings of individual backends, keyed by backend address: the
+	root certificates, the client certificate and key, the subject alt names the backend certificate must have and the SNI. They
+	override --root_certs_path and --ssl_client_cert_path for those backends.`)
+	EnableSds = flag.Bool("enable_sds", false, `Serve the certificates, the keys and the root certificates of the listeners and the clusters
+	to Envoy as SDS secrets, instead of referencing their files. The config manager watches the files and updates the secrets when they
+	change, so certificates are rotated without restarts.`)
+
 	// Flags for non_gcp deployment.
 	ServiceAccountKey = flag.String("service_account_key", "", `Use the service account key JSON file to access the service control and the
 	service management.  You can also set {creds_key} environment variable to the location of the service account credentials JSON file. If the option is
@@ -68,7 +140,43 @@ var (
 
 	// Envoy configurations.
 	EnvoyUseRemoteAddress  = flag.Bool("envoy_use_remote_address", false, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
-	EnvoyXffNumTrustedHops = flag.Int("envoy_xff_num_trusted_hops", 2, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
+	EnvoyXffNumTrustedHops = flag.Int("envoy_xff_num_trusted_hops", 2, `Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.
+	With --enable_proxy_protocol, it is 0 unless set.`)
+	EnableProxyProtocol = flag.Bool("enable_proxy_protocol", false, `Read the client address from the PROXY protocol header that a TCP load balancer sends at the
+	start of each connection, so it is used as the remote address for logging and IP-based policies. Connections without the
+	header are rejected. Set --envoy_use_remote_address too, so that the address is appended to x-forwarded-for and trusted as the
+	client address. As the load balancer appends nothing to x-forwarded-for, --envoy_xff_num_trusted_hops is 0 unless set.`)
+
+	HttpIdleTimeout = flag.Duration("http_idle_timeout", 0, `Downstream connections without active requests for this long are closed. By default, it is
+	1 hour.`)
+	StreamIdleTimeout = flag.Duration("stream_idle_timeout", 0, `Requests without activity in either direction for this long are reset, which also protects against
+	clients sending headers or bodies slowly. By default, it is 5 minutes.`)
+	StreamingMethodIdleTimeout = flag.Duration("streaming_method_idle_timeout", 0, `Idle timeout of the requests to streaming methods, replacing --stream_idle_timeout
+	for them, so long-lived streams can stay quiet longer than the other requests.`)
+	RequestTimeout            = flag.Duration("request_timeout", 0, `Time to receive the whole request, including streamed requests. By default, it is unlimited.`)
+	MaxConnectionDuration     = flag.Duration("max_connection_duration", 0, `Downstream connections are drained after being open this long. By default, it is unlimited.`)
+	Http2MaxConcurrentStreams = flag.Int("http2_max_concurrent_streams", 0, `Maximum concurrent streams of a Downstream HTTP/2 connection, from 1 to 2147483647. By
+	default, it is 2147483647.`)
+	Http2InitialStreamWindowSize = flag.Int("http2_initial_stream_window_size", 0, `Initial flow-control window of the streams of Downstream HTTP/2 connections in
+	bytes, from 65535 to 2147483647. By default, it is 268435456.`)
+	Http2InitialConnectionWindowSize = flag.Int("http2_initial_connection_window_size", 0, `Initial flow-control window of Downstream HTTP/2 connections in bytes,
+	from 65535 to 2147483647. By default, it is 268435456.`)
+
+	EnableResponseCompression = flag.Bool("enable_response_compression", false, `Enable gzip compression of responses to clients that accept it. Streaming methods and responses that
+	are already compressed are not compressed.`)
+	ResponseCompressionMinContentLength = flag.Int("response_compression_min_content_length", 30, "Minimum response length in bytes to be compressed.")
+	ResponseCompressionContentTypes     = flag.String("response_compression_content_types", "", `A list of content types (separated by comma) to be compressed. The default is the
+	Envoy gzip filter default, which includes application/json.`)
+	ResponseCompressionLevel = flag.String("response_compression_level", "default", `Gzip compression level, must be one of "default", "best" and "speed".`)
+
+	AccessLogPath   = flag.String("access_log", "", `Path of the access log of the requests, such as /dev/stdout. The access log is off by default.`)
+	AccessLogFormat = flag.String("access_log_format", "json", `Format of the access log, must be "json" for one JSON object per request or "text" for one line of
+	key=value pairs per request.`)
+
+	MaxRequestBodyBytes = flag.Int("max_request_body_bytes", 0, `Maximum size of request bodies in bytes. Larger requests are rejected with 413. The default 0 means unlimited.
+	Requests are buffered before they are sent to the backend. Streaming gRPC methods are exempt.`)
+	RequestBodyLimitsConfigPath = flag.String("request_body_limits_config_path", "", `Path to a JSON file with request body size limits for operations or APIs,
+	overriding --max_request_body_bytes.`)
 
 	LogJwtPayloads = flag.String("log_jwt_payloads", "", `Log corresponding JWT JSON payload primitive fields through service control, separated by comma. Example, when --log_jwt_payload=sub,project_id, log
 	will have jwt_payload: sub=[SUBJECT];project_id=[PROJECT_ID] if the fields are available. The value must be a primitive field, JSON objects and arrays will not be logged.`)
@@ -86,6 +194,14 @@ var (
         the requests will be allowed if this flag is on. The default is on.`)
 
 	JwksCacheDurationInS = flag.Int("jwks_cache_duration_in_s", 300, "Specify JWT public key cache duration in seconds. The default is 5 minutes.")
+	JwksFiles            = flag.String("jwks_files", "", `A list of provider_id=path (separated by comma) of local JWKS files used instead of the jwks_uri of the
+	authentication providers. Providers with a file:// or data: jwks_uri also use local JWKS. Local JWKS files are watched by the
+	config manager, so keys can be rotated without a service config rollout.`)
+	JwtCookies = flag.String("jwt_cookies", "", `A list of provider_id=cookie_name (separated by comma) of cookies the JWTs of the authentication providers
+	are also read from, besides their JWT locations in the service config, which cannot set cookies. A provider can have more
+	than one cookie.`)
+	ApiKeyCookies = flag.String("api_key_cookies", "", `A list of cookie names (separated by comma) the API keys of all the methods are also read from, after
+	their API key locations in the service config or the default ones. The service config cannot set cookies.`)
 
 	ScCheckTimeoutMs  = flag.Int("service_control_check_timeout_ms", 0, `Set the timeout in millisecond for service control Check request. Must be > 0 and the default is 1000 if not set.`)
 	ScQuotaTimeoutMs  = flag.Int("service_control_quota_timeout_ms", 0, `Set the timeout in millisecond for service control Quota request. Must be > 0 and the default is 1000 if not set.`)
@@ -120,8 +236,19 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		CorsAllowOriginRegex:                    *CorsAllowOriginRegex,
 		CorsExposeHeaders:                       *CorsExposeHeaders,
 		CorsPreset:                              *CorsPreset,
+		CorsConfigPath:                          *CorsConfigPath,
 		BackendDnsLookupFamily:                  *BackendDnsLookupFamily,
 		ClusterConnectTimeout:                   *ClusterConnectTimeout,
+		RateLimitConfigPath:                     *RateLimitConfigPath,
+		RateLimitFailureModeDeny:                *RateLimitFailureModeDeny,
+		HeaderRulesConfigPath:                   *HeaderRulesConfigPath,
+		ApiVersionRoutingConfigPath:             *ApiVersionRoutingConfigPath,
+		CanaryConfigPath:                        *CanaryConfigPath,
+		MirrorConfigPath:                        *MirrorConfigPath,
+		FaultConfigPath:                         *FaultConfigPath,
+		ExtAuthzConfigPath:                      *ExtAuthzConfigPath,
+		JwtClaimsConfigPath:                     *JwtClaimsConfigPath,
+		JwtHeadersConfigPath:                    *JwtHeadersConfigPath,
 		ListenerAddress:                         *ListenerAddress,
 		ServiceManagementURL:                    *ServiceManagementURL,
 		ServiceControlURL:                       *ServiceControlURL,
@@ -129,6 +256,21 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		Healthz:                                 *Healthz,
 		RootCertsPath:                           *RootCertsPath,
 		SslServerCertPath:                       *SslServerCertPath,
+		SslPort:                                 *SslPort,
+		HttpToHttpsRedirect:                     *HttpToHttpsRedirect,
+		SslServerRootCertsPath:                  *SslServerRootCertsPath,
+		SslServerRequireClientCert:              *SslServerRequireClientCert,
+		SslServerClientSans:                     *SslServerClientSans,
+		SslServerCipherSuites:                   *SslServerCipherSuites,
+		SslServerEcdhCurves:                     *SslServerEcdhCurves,
+		SslServerSessionTimeout:                 *SslServerSessionTimeout,
+		SslServerDisableSessionTickets:          *SslServerDisableSessionTickets,
+		SslClientCipherSuites:                   *SslClientCipherSuites,
+		SslClientEcdhCurves:                     *SslClientEcdhCurves,
+		SslClientDisableSessionResumption:       *SslClientDisableSessionResumption,
+		SslServerCertsConfigPath:                *SslServerCertsConfigPath,
+		BackendTlsConfigPath:                    *BackendTlsConfigPath,
+		EnableSds:                               *EnableSds,
 		SslClientCertPath:                       *SslClientCertPath,
 		SslMinimumProtocol:                      *SslMinimumProtocol,
 		SslMaximumProtocol:                      *SslMaximumProtocol,
@@ -138,6 +280,23 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		SkipServiceControlFilter:                *SkipServiceControlFilter,
 		EnvoyUseRemoteAddress:                   *EnvoyUseRemoteAddress,
 		EnvoyXffNumTrustedHops:                  *EnvoyXffNumTrustedHops,
+		EnableProxyProtocol:                     *EnableProxyProtocol,
+		HttpIdleTimeout:                         *HttpIdleTimeout,
+		StreamIdleTimeout:                       *StreamIdleTimeout,
+		StreamingMethodIdleTimeout:              *StreamingMethodIdleTimeout,
+		RequestTimeout:                          *RequestTimeout,
+		MaxConnectionDuration:                   *MaxConnectionDuration,
+		Http2MaxConcurrentStreams:               *Http2MaxConcurrentStreams,
+		Http2InitialStreamWindowSize:            *Http2InitialStreamWindowSize,
+		Http2InitialConnectionWindowSize:        *Http2InitialConnectionWindowSize,
+		EnableResponseCompression:               *EnableResponseCompression,
+		ResponseCompressionMinContentLength:     *ResponseCompressionMinContentLength,
+		ResponseCompressionContentTypes:         *ResponseCompressionContentTypes,
+		ResponseCompressionLevel:                *ResponseCompressionLevel,
+		AccessLogPath:                           *AccessLogPath,
+		AccessLogFormat:                         *AccessLogFormat,
+		MaxRequestBodyBytes:                     *MaxRequestBodyBytes,
+		RequestBodyLimitsConfigPath:             *RequestBodyLimitsConfigPath,
 		LogJwtPayloads:                          *LogJwtPayloads,
 		LogRequestHeaders:                       *LogRequestHeaders,
 		LogResponseHeaders:                      *LogResponseHeaders,
@@ -146,6 +305,9 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		UnderscoresInHeaders:                    *UnderscoresInHeaders,
 		ServiceControlNetworkFailOpen:           *ServiceControlNetworkFailOpen,
 		JwksCacheDurationInS:                    *JwksCacheDurationInS,
+		JwksFiles:                               *JwksFiles,
+		JwtCookies:                              *JwtCookies,
+		ApiKeyCookies:                           *ApiKeyCookies,
 		ScCheckTimeoutMs:                        *ScCheckTimeoutMs,
 		ScQuotaTimeoutMs:                        *ScQuotaTimeoutMs,
 		ScReportTimeoutMs:                       *ScReportTimeoutMs,
@@ -159,6 +321,20 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		TranscodingIgnoreUnknownQueryParameters: *TranscodingIgnoreUnknownQueryParameters,
 	}
 
+	// The load balancer sending the PROXY protocol header is a TCP proxy,
+	// which appends nothing to x-forwarded-for.
+	if opts.EnableProxyProtocol {
+		xffNumTrustedHopsSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "envoy_xff_num_trusted_hops" {
+				xffNumTrustedHopsSet = true
+			}
+		})
+		if !xffNumTrustedHopsSet {
+			opts.EnvoyXffNumTrustedHops = 0
+		}
+	}
+
 	glog.Infof("Config Generator options: %+v", opts)
 	return opts
 }
@@ -15,6 +15,7 @@
 package flags
 
 import (
+	"flag"
 	"reflect"
 	"testing"
 
@@ -30,3 +31,39 @@ func TestDefaultEnvoyConfigOptions(t *testing.T) {
 			defaultOptions, actualOptions)
 	}
 }
+
+func TestEnvoyXffNumTrustedHopsWithProxyProtocol(t *testing.T) {
+	defer func() {
+		flag.Set("enable_proxy_protocol", "false")
+		flag.Set("envoy_xff_num_trusted_hops", "2")
+	}()
+
+	// Flags stay set once set, so the cases are in order.
+	testData := []struct {
+		desc                  string
+		flags                 map[string]string
+		wantXffNumTrustedHops int
+	}{
+		{
+			desc:                  "No trusted hops with PROXY protocol by default",
+			flags:                 map[string]string{"enable_proxy_protocol": "true"},
+			wantXffNumTrustedHops: 0,
+		},
+		{
+			desc:                  "Trusted hops set with PROXY protocol are kept",
+			flags:                 map[string]string{"envoy_xff_num_trusted_hops": "1"},
+			wantXffNumTrustedHops: 1,
+		},
+	}
+
+	for i, tc := range testData {
+		for name, value := range tc.flags {
+			if err := flag.Set(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := EnvoyConfigOptionsFromFlags().EnvoyXffNumTrustedHops; got != tc.wantXffNumTrustedHops {
+			t.Errorf("Test Desc(%d): %s, got xff num trusted hops %d, want %d", i, tc.desc, got, tc.wantXffNumTrustedHops)
+		}
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"google.golang.org/grpc"
 
 	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	rlsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
 	xds "github.com/envoyproxy/go-control-plane/pkg/server/v2"
 )
 
@@ -60,6 +61,8 @@ func main() {
 
 	// Register Envoy discovery services.
 	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
+	// Register the rate limit service for local rate limits.
+	rlsgrpc.RegisterRateLimitServiceServer(grpcServer, m.RateLimitService())
 
 	fmt.Printf("config manager server is running at %s .......\n", lis.Addr())
 
@@ -25,6 +25,11 @@ type AdsBootstrapperOptions struct {
 	// Flags for ADS
 	AdsConnectTimeout time.Duration
 	DiscoveryAddress  string
+
+	// Service name and service config ID the stats are tagged with, if they
+	// are not empty. The config ID is only known with a fixed rollout.
+	ServiceName     string
+	ServiceConfigId string
 }
 
 // DefaultAdsBootstrapperOptions returns AdsBootstrapperOptions with default values.
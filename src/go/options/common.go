@@ -48,6 +48,22 @@ type CommonOptions struct {
 	ServiceControlCredentials *IAMCredentialsOptions
 	// Configures the identity used when making requests to backends.
 	BackendAuthCredentials *IAMCredentialsOptions
+
+	// Flags for the overload manager, which is off without a max heap size.
+	// The thresholds are ratios of the max heap size, and 0 turns an action
+	// off.
+	MaxHeapSizeBytes                       uint64
+	OverloadShrinkHeapThreshold            float64
+	OverloadDisableKeepaliveThreshold      float64
+	OverloadStopAcceptingRequestsThreshold float64
+	// Global limit of downstream connections, 0 for unlimited.
+	MaxDownstreamConnections int
+
+	// Flags for stats. The sinks are UDP addresses as ip:port, and the stats
+	// are served in Prometheus format on the stats port if it is not 0.
+	StatsdAddress    string
+	DogStatsdAddress string
+	StatsPort        int
 }
 
 // IamTokenKind specifies which type of token to generate using the IAM Credentials API.
@@ -88,5 +104,8 @@ func DefaultCommonOptions() CommonOptions {
 		TracingMaxNumLinks:         128,
 		MetadataURL:                "http://169.254.169.254/computeMetadata",
 		IamURL:                     "https://iamcredentials.googleapis.com",
+
+		OverloadShrinkHeapThreshold:            0.95,
+		OverloadStopAcceptingRequestsThreshold: 0.98,
 	}
 }
@@ -33,6 +33,8 @@ type ConfigGeneratorOptions struct {
 	CorsAllowOriginRegex string
 	CorsExposeHeaders    string
 	CorsPreset           string
+	// Path to a JSON file with CORS policies for individual operations or APIs.
+	CorsConfigPath string
 
 	// Backend routing configurations.
 	BackendDnsLookupFamily string
@@ -40,6 +42,30 @@ type ConfigGeneratorOptions struct {
 	// Envoy specific configurations.
 	ClusterConnectTimeout time.Duration
 
+	// Path to a JSON file with local rate limits.
+	RateLimitConfigPath string
+	// Whether requests with rate limits are rejected when the rate limit
+	// server fails, instead of allowed.
+	RateLimitFailureModeDeny bool
+	// Path to a JSON file with request and response header rules.
+	HeaderRulesConfigPath string
+	// Path to a JSON file with the backends of the API versions.
+	ApiVersionRoutingConfigPath string
+	// Path to a JSON file with the canary backends and their weights.
+	CanaryConfigPath string
+	// Path to a JSON file with the backends requests are mirrored to.
+	MirrorConfigPath string
+	// Path to a JSON file with faults injected into the requests.
+	FaultConfigPath string
+	// Path to a JSON file with the external authorization service approving
+	// the requests.
+	ExtAuthzConfigPath string
+	// Path to a JSON file with the JWT claims required by operations.
+	JwtClaimsConfigPath string
+	// Path to a JSON file with the request headers set to JWT claims, and the
+	// headers the JWT payloads are forwarded in.
+	JwtHeadersConfigPath string
+
 	// Full URI to the backend: scheme, address/hostname, port
 	BackendAddress string
 
@@ -56,6 +82,39 @@ type ConfigGeneratorOptions struct {
 	EnableHSTS           bool
 	RootCertsPath        string
 
+	// Port of the HTTPS listener besides the plaintext one, which redirects
+	// requests to it if HttpToHttpsRedirect. 0 means one listener on
+	// ListenerPort, with TLS if SslServerCertPath is set.
+	SslPort             int
+	HttpToHttpsRedirect bool
+
+	// Validation of the client certificates by the HTTPS listener. The
+	// client certificates are not requested without SslServerRootCertsPath.
+	SslServerRootCertsPath     string
+	SslServerRequireClientCert bool
+	SslServerClientSans        string
+
+	// TLS parameters of the HTTPS listener, and of the connections to the
+	// backends and the other clusters. Cipher suites and curves are separated
+	// by comma.
+	SslServerCipherSuites             string
+	SslServerEcdhCurves               string
+	SslServerSessionTimeout           time.Duration
+	SslServerDisableSessionTickets    bool
+	SslClientCipherSuites             string
+	SslClientEcdhCurves               string
+	SslClientDisableSessionResumption bool
+
+	// More certificates of the HTTPS listener, selected by SNI.
+	SslServerCertsConfigPath string
+
+	// Path to a JSON file with TLS settings of individual backends.
+	BackendTlsConfigPath string
+
+	// Serve the TLS files as SDS secrets from the config manager, which
+	// updates them when the files change.
+	EnableSds bool
+
 	// Flags for non_gcp deployment.
 	ServiceAccountKey string
 
@@ -66,6 +125,37 @@ type ConfigGeneratorOptions struct {
 	// Envoy configurations.
 	EnvoyUseRemoteAddress  bool
 	EnvoyXffNumTrustedHops int
+	// Read the client addresses from the PROXY protocol headers sent by a
+	// load balancer in front of the listeners.
+	EnableProxyProtocol bool
+
+	// Timeouts of the downstream connections and requests, and HTTP/2 limits.
+	// 0 means the default of Envoy.
+	HttpIdleTimeout                  time.Duration
+	StreamIdleTimeout                time.Duration
+	StreamingMethodIdleTimeout       time.Duration
+	RequestTimeout                   time.Duration
+	MaxConnectionDuration            time.Duration
+	Http2MaxConcurrentStreams        int
+	Http2InitialStreamWindowSize     int
+	Http2InitialConnectionWindowSize int
+
+	// Gzip compression of responses.
+	EnableResponseCompression           bool
+	ResponseCompressionMinContentLength int
+	ResponseCompressionContentTypes     string
+	ResponseCompressionLevel            string
+
+	// Access log of the requests, which is off without a path. The format is
+	// "json" or "text".
+	AccessLogPath   string
+	AccessLogFormat string
+
+	// Request body size limit. 0 means unlimited.
+	MaxRequestBodyBytes int
+	// Path to a JSON file with request body size limits for individual
+	// operations or APIs.
+	RequestBodyLimitsConfigPath string
 
 	LogJwtPayloads            string
 	LogRequestHeaders         string
@@ -77,6 +167,13 @@ type ConfigGeneratorOptions struct {
 	ServiceControlNetworkFailOpen bool
 
 	JwksCacheDurationInS int
+	// A list of provider_id=path, separated by comma, of local JWKS files.
+	JwksFiles string
+	// A list of provider_id=cookie_name, separated by comma, of cookies JWTs
+	// are also read from.
+	JwtCookies string
+	// Cookies, separated by comma, API keys are also read from.
+	ApiKeyCookies string
 
 	ScCheckTimeoutMs  int
 	ScQuotaTimeoutMs  int
@@ -101,21 +198,24 @@ type ConfigGeneratorOptions struct {
 func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 
 	return ConfigGeneratorOptions{
-		CommonOptions:                 DefaultCommonOptions(),
-		BackendDnsLookupFamily:        "auto",
-		BackendAddress:                "http://127.0.0.1:8082",
-		ClusterConnectTimeout:         20 * time.Second,
-		EnvoyXffNumTrustedHops:        2,
-		JwksCacheDurationInS:          300,
-		ListenerAddress:               "0.0.0.0",
-		ListenerPort:                  8080,
-		RootCertsPath:                 util.DefaultRootCAPaths,
-		SuppressEnvoyHeaders:          true,
-		ServiceControlNetworkFailOpen: true,
-		ServiceManagementURL:          "https://servicemanagement.googleapis.com",
-		ServiceControlURL:             "https://servicecontrol.googleapis.com",
-		ScCheckRetries:                -1,
-		ScQuotaRetries:                -1,
-		ScReportRetries:               -1,
+		CommonOptions:                       DefaultCommonOptions(),
+		AccessLogFormat:                     "json",
+		BackendDnsLookupFamily:              "auto",
+		BackendAddress:                      "http://127.0.0.1:8082",
+		ClusterConnectTimeout:               20 * time.Second,
+		EnvoyXffNumTrustedHops:              2,
+		JwksCacheDurationInS:                300,
+		ListenerAddress:                     "0.0.0.0",
+		ListenerPort:                        8080,
+		ResponseCompressionMinContentLength: 30,
+		ResponseCompressionLevel:            "default",
+		RootCertsPath:                       util.DefaultRootCAPaths,
+		SuppressEnvoyHeaders:                true,
+		ServiceControlNetworkFailOpen:       true,
+		ServiceManagementURL:                "https://servicemanagement.googleapis.com",
+		ServiceControlURL:                   "https://servicecontrol.googleapis.com",
+		ScCheckRetries:                      -1,
+		ScQuotaRetries:                      -1,
+		ScReportRetries:                     -1,
 	}
 }
@@ -0,0 +1,302 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit implements the Envoy rate limit service for the local
+// rate limits of the methods, using in-memory token buckets.
+package ratelimit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	rlspb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+)
+
+const (
+	retryAfterHeader = "Retry-After"
+
+	// Interval to drop the buckets that are full again, which are the same as
+	// new buckets.
+	pruneInterval = time.Minute
+)
+
+// RateLimitService decides whether the requests to the methods are over their
+// local rate limits.
+type RateLimitService struct {
+	mu         sync.Mutex
+	operations map[string]*operationLimits
+	buckets    map[bucketKey]*bucket
+	lastPrune  time.Time
+	now        func() time.Time
+}
+
+type operationLimits struct {
+	limits            []*configinfo.RateLimit
+	apiKeyLocations   []*scpb.ApiKeyLocation
+	jwtPayloadHeaders []*configinfo.JwtPayloadHeader
+}
+
+type bucketKey struct {
+	limit    string
+	consumer string
+}
+
+type bucket struct {
+	tokens float64
+	// Time the tokens were last refilled.
+	updated time.Time
+	// Time the bucket is full again, if nothing is taken.
+	full time.Time
+}
+
+// NewRateLimitService creates a RateLimitService without any limits.
+func NewRateLimitService() *RateLimitService {
+	return &RateLimitService{
+		operations: make(map[string]*operationLimits),
+		buckets:    make(map[bucketKey]*bucket),
+		now:        time.Now,
+	}
+}
+
+// Update replaces the limits with the ones of serviceInfo. Buckets of the
+// limits that still exist are kept.
+func (s *RateLimitService) Update(serviceInfo *configinfo.ServiceInfo) {
+	operations := make(map[string]*operationLimits)
+	for operation, method := range serviceInfo.Methods {
+		if len(method.RateLimits) == 0 {
+			continue
+		}
+		operations[operation] = &operationLimits{
+			limits:            method.RateLimits,
+			apiKeyLocations:   serviceInfo.RateLimitApiKeyLocations(operation),
+			jwtPayloadHeaders: serviceInfo.RateLimitJwtPayloadHeaders(operation),
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations = operations
+}
+
+// ShouldRateLimit implements the Envoy rate limit service.
+//
+// Envoy sends the descriptors made by the rate limit actions of the route.
+// The request is allowed only if all the limits of its operation have enough
+// tokens, in which case the tokens are taken from all of them.
+func (s *RateLimitService) ShouldRateLimit(ctx context.Context, req *rlspb.RateLimitRequest) (*rlspb.RateLimitResponse, error) {
+	entries := make(map[string]string)
+	for _, descriptor := range req.GetDescriptors() {
+		for _, entry := range descriptor.GetEntries() {
+			entries[entry.GetKey()] = entry.GetValue()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := &rlspb.RateLimitResponse{
+		OverallCode: rlspb.RateLimitResponse_OK,
+	}
+	operation, found := s.operations[entries[util.RateLimitOperationKey]]
+	if req.GetDomain() != util.RateLimitDomain || !found {
+		return ok, nil
+	}
+
+	now := s.now()
+	s.prune(now)
+
+	buckets := make([]*bucket, len(operation.limits))
+	var retryAfter time.Duration
+	for i, limit := range operation.limits {
+		key := bucketKey{
+			limit:    limit.Name,
+			consumer: operation.consumer(limit.Key, entries),
+		}
+		b, found := s.buckets[key]
+		if !found {
+			b = &bucket{
+				tokens:  float64(limit.Limit),
+				updated: now,
+			}
+			s.buckets[key] = b
+		}
+		b.refill(limit, now)
+		buckets[i] = b
+
+		if wait := b.wait(limit); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		seconds := int64(math.Ceil(retryAfter.Seconds()))
+		return &rlspb.RateLimitResponse{
+			OverallCode: rlspb.RateLimitResponse_OVER_LIMIT,
+			Headers: []*corepb.HeaderValue{
+				{
+					Key:   retryAfterHeader,
+					Value: strconv.FormatInt(seconds, 10),
+				},
+			},
+		}, nil
+	}
+
+	for i, limit := range operation.limits {
+		buckets[i].take(limit, now)
+	}
+	return ok, nil
+}
+
+// prune drops the buckets that are full again. It must be called with mu
+// held.
+func (s *RateLimitService) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < pruneInterval {
+		return
+	}
+	s.lastPrune = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// consumer returns the value the requests of a limit with the given key are
+// grouped by. Requests without the value share one bucket.
+func (o *operationLimits) consumer(key configinfo.RateLimitKey, entries map[string]string) string {
+	switch key {
+	case configinfo.RateLimitKeyApiKey:
+		for _, location := range o.apiKeyLocations {
+			if query := location.GetQuery(); query != "" {
+				if apiKey := queryParam(entries[util.RateLimitPathKey], query); apiKey != "" {
+					return apiKey
+				}
+			} else if header := location.GetHeader(); header != "" {
+				if apiKey := entries[util.RateLimitRequestHeaderPrefix+strings.ToLower(header)]; apiKey != "" {
+					return apiKey
+				}
+			} else if cookie := location.GetCookie(); cookie != "" {
+				if apiKey := cookieValue(entries[util.RateLimitRequestHeaderPrefix+"cookie"], cookie); apiKey != "" {
+					return apiKey
+				}
+			}
+		}
+	case configinfo.RateLimitKeyJwtSubject:
+		for _, header := range o.jwtPayloadHeaders {
+			if payload := entries[util.RateLimitRequestHeaderPrefix+strings.ToLower(header.Name)]; payload != "" {
+				return jwtSubject(payload, header.Encoding)
+			}
+		}
+	case configinfo.RateLimitKeyClientIP:
+		return entries[util.RateLimitRemoteAddressKey]
+	}
+	return ""
+}
+
+func queryParam(path, name string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return ""
+	}
+	values, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return ""
+	}
+	return values.Get(name)
+}
+
+func cookieValue(cookies, name string) string {
+	if cookies == "" {
+		return ""
+	}
+	request := http.Request{
+		Header: http.Header{"Cookie": {cookies}},
+	}
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// jwtSubject returns the subject of the JWT payload forwarded by the JWT
+// Authn filter, in the encoding of the payload header of its provider.
+func jwtSubject(payload string, encoding configinfo.JwtPayloadEncoding) string {
+	var decoded []byte
+	var err error
+	if encoding == configinfo.JwtPayloadEncodingBase64 {
+		decoded, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	if err != nil {
+		glog.V(1).Infof("fail to decode JWT payload: %v", err)
+		return ""
+	}
+	claims := struct {
+		Subject string `json:"sub"`
+	}{}
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		glog.V(1).Infof("fail to parse JWT payload: %v", err)
+		return ""
+	}
+	return claims.Subject
+}
+
+func (b *bucket) refill(limit *configinfo.RateLimit, now time.Time) {
+	if limit.Limit > 0 {
+		rate := float64(limit.Limit) / float64(limit.Unit)
+		b.tokens = math.Min(float64(limit.Limit), b.tokens+rate*float64(now.Sub(b.updated)))
+	}
+	b.updated = now
+}
+
+// wait returns how long until the bucket has enough tokens for a request, or
+// 0 if it has enough now.
+func (b *bucket) wait(limit *configinfo.RateLimit) time.Duration {
+	missing := float64(limit.Cost) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	if limit.Cost > limit.Limit {
+		// The bucket never has enough tokens.
+		return limit.Unit
+	}
+	rate := float64(limit.Limit) / float64(limit.Unit)
+	return time.Duration(math.Ceil(missing / rate))
+}
+
+func (b *bucket) take(limit *configinfo.RateLimit, now time.Time) {
+	if limit.Cost <= 0 {
+		return
+	}
+	b.tokens -= float64(limit.Cost)
+	missing := float64(limit.Limit) - b.tokens
+	rate := float64(limit.Limit) / float64(limit.Unit)
+	b.full = now.Add(time.Duration(math.Ceil(missing / rate)))
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	ratelimitpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rlspb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+)
+
+const testOperation = "endpoints.examples.bookstore.Bookstore.CreateShelf"
+
+type testRequest struct {
+	// Time since the first request.
+	after   time.Duration
+	entries map[string]string
+	// Empty if the request is allowed.
+	wantRetryAfter string
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	subject := func(sub string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	}
+
+	testData := []struct {
+		desc     string
+		limits   []*configinfo.RateLimit
+		requests []testRequest
+	}{
+		{
+			desc: "Shared bucket refills over time",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "limit",
+					Limit: 2,
+					Unit:  time.Minute,
+					Cost:  1,
+				},
+			},
+			requests: []testRequest{
+				{},
+				{},
+				{wantRetryAfter: "30"},
+				{after: 20 * time.Second, wantRetryAfter: "10"},
+				{after: 30 * time.Second},
+				{after: 30 * time.Second, wantRetryAfter: "30"},
+			},
+		},
+		{
+			desc: "Requests over any limit are rejected without taking tokens",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "per-second",
+					Limit: 1,
+					Unit:  time.Second,
+					Cost:  1,
+				},
+				{
+					Name:  "per-minute",
+					Limit: 2,
+					Unit:  time.Minute,
+					Cost:  1,
+				},
+			},
+			requests: []testRequest{
+				{},
+				{wantRetryAfter: "1"},
+				{after: time.Second},
+				{after: 2 * time.Second, wantRetryAfter: "28"},
+			},
+		},
+		{
+			desc: "Cost above the limit is always rejected",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "limit",
+					Limit: 1,
+					Unit:  time.Hour,
+					Cost:  2,
+				},
+			},
+			requests: []testRequest{
+				{wantRetryAfter: "3600"},
+			},
+		},
+		{
+			desc: "Buckets keyed by API key from query or header",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "limit",
+					Key:   configinfo.RateLimitKeyApiKey,
+					Limit: 1,
+					Unit:  time.Second,
+					Cost:  1,
+				},
+			},
+			requests: []testRequest{
+				{entries: map[string]string{"path": "/shelves?key=key-1"}},
+				{entries: map[string]string{"path": "/shelves?key=key-2"}},
+				{entries: map[string]string{"path": "/shelves", "header:x-api-key": "key-1"}, wantRetryAfter: "1"},
+				{entries: map[string]string{"path": "/shelves", "header:cookie": "session=abc; api-key=key-2"}, wantRetryAfter: "1"},
+				{entries: map[string]string{"path": "/shelves"}},
+				{entries: map[string]string{"path": "/shelves"}, wantRetryAfter: "1"},
+			},
+		},
+		{
+			desc: "Buckets keyed by JWT subject",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "limit",
+					Key:   configinfo.RateLimitKeyJwtSubject,
+					Limit: 1,
+					Unit:  time.Second,
+					Cost:  1,
+				},
+			},
+			requests: []testRequest{
+				{entries: map[string]string{"header:x-endpoint-api-userinfo": subject("alice")}},
+				{entries: map[string]string{"header:x-endpoint-api-userinfo": subject("bob")}},
+				{entries: map[string]string{"header:x-endpoint-api-userinfo": subject("alice")}, wantRetryAfter: "1"},
+				// Payloads of a provider with its own header and base64 encoding.
+				{entries: map[string]string{"header:x-jwt-payload": base64.StdEncoding.EncodeToString([]byte(`{"sub":"alice"}`))}, wantRetryAfter: "1"},
+				{entries: map[string]string{"header:x-jwt-payload": base64.StdEncoding.EncodeToString([]byte(`{"sub":"carol"}`))}},
+			},
+		},
+		{
+			desc: "Buckets keyed by client IP",
+			limits: []*configinfo.RateLimit{
+				{
+					Name:  "limit",
+					Key:   configinfo.RateLimitKeyClientIP,
+					Limit: 1,
+					Unit:  time.Second,
+					Cost:  1,
+				},
+			},
+			requests: []testRequest{
+				{entries: map[string]string{"remote_address": "10.0.0.1"}},
+				{entries: map[string]string{"remote_address": "10.0.0.2"}},
+				{entries: map[string]string{"remote_address": "10.0.0.1"}, wantRetryAfter: "1"},
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		start := time.Unix(0, 0)
+		now := start
+		s := NewRateLimitService()
+		s.now = func() time.Time { return now }
+		s.operations[testOperation] = &operationLimits{
+			limits: tc.limits,
+			apiKeyLocations: []*scpb.ApiKeyLocation{
+				{
+					Key: &scpb.ApiKeyLocation_Query{
+						Query: "key",
+					},
+				},
+				{
+					Key: &scpb.ApiKeyLocation_Header{
+						Header: "x-api-key",
+					},
+				},
+				{
+					Key: &scpb.ApiKeyLocation_Cookie{
+						Cookie: "api-key",
+					},
+				},
+			},
+			jwtPayloadHeaders: []*configinfo.JwtPayloadHeader{
+				{
+					Name:     "X-Endpoint-API-UserInfo",
+					Encoding: configinfo.JwtPayloadEncodingBase64Url,
+				},
+				{
+					Name:     "X-Jwt-Payload",
+					Encoding: configinfo.JwtPayloadEncodingBase64,
+				},
+			},
+		}
+
+		for j, r := range tc.requests {
+			now = start.Add(r.after)
+			resp, err := s.ShouldRateLimit(context.Background(), makeRequest(testOperation, r.entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotRetryAfter := ""
+			for _, header := range resp.GetHeaders() {
+				if header.GetKey() == "Retry-After" {
+					gotRetryAfter = header.GetValue()
+				}
+			}
+			wantCode := rlspb.RateLimitResponse_OK
+			if r.wantRetryAfter != "" {
+				wantCode = rlspb.RateLimitResponse_OVER_LIMIT
+			}
+			if resp.GetOverallCode() != wantCode || gotRetryAfter != r.wantRetryAfter {
+				t.Errorf("Test Desc(%d): %s, request %d got code %v with Retry-After %q, want code %v with Retry-After %q",
+					i, tc.desc, j, resp.GetOverallCode(), gotRetryAfter, wantCode, r.wantRetryAfter)
+			}
+		}
+	}
+}
+
+func TestShouldRateLimitUnknownOperation(t *testing.T) {
+	s := NewRateLimitService()
+	resp, err := s.ShouldRateLimit(context.Background(), makeRequest("endpoints.examples.bookstore.Bookstore.ListShelves", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetOverallCode() != rlspb.RateLimitResponse_OK {
+		t.Errorf("got code %v for an operation without limits, want OK", resp.GetOverallCode())
+	}
+}
+
+func makeRequest(operation string, entries map[string]string) *rlspb.RateLimitRequest {
+	descriptor := &ratelimitpb.RateLimitDescriptor{
+		Entries: []*ratelimitpb.RateLimitDescriptor_Entry{
+			{
+				Key:   "generic_key",
+				Value: operation,
+			},
+		},
+	}
+	for key, value := range entries {
+		descriptor.Entries = append(descriptor.Entries, &ratelimitpb.RateLimitDescriptor_Entry{
+			Key:   key,
+			Value: value,
+		})
+	}
+	return &rlspb.RateLimitRequest{
+		Domain:      "espv2",
+		Descriptors: []*ratelimitpb.RateLimitDescriptor{descriptor},
+	}
+}
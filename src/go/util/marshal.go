@@ -26,11 +26,19 @@ import (
 	pmpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/path_matcher"
 	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
 	authpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	filelogpb "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
+	bufpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	eapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	faultpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/fault/v2"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/grpc_stats/v2alpha"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	luapb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	rlpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
@@ -69,6 +77,8 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(wrapperspb.Int32Value), nil
 	case "type.googleapis.com/google.protobuf.UInt32Value":
 		return new(wrapperspb.UInt32Value), nil
+	case "type.googleapis.com/google.protobuf.Struct":
+		return new(structpb.Struct), nil
 	case "type.googleapis.com/google.api.Service":
 		return new(confpb.Service), nil
 	case "type.googleapis.com/envoy.config.filter.http.grpc_stats.v2alpha.FilterConfig":
@@ -87,6 +97,24 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(bapb.FilterConfig), nil
 	case "type.googleapis.com/google.api.envoy.http.backend_routing.FilterConfig":
 		return new(drpb.FilterConfig), nil
+	case "type.googleapis.com/envoy.config.accesslog.v2.FileAccessLog":
+		return new(filelogpb.FileAccessLog), nil
+	case "type.googleapis.com/envoy.config.filter.http.buffer.v2.Buffer":
+		return new(bufpb.Buffer), nil
+	case "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute":
+		return new(bufpb.BufferPerRoute), nil
+	case "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz":
+		return new(eapb.ExtAuthz), nil
+	case "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute":
+		return new(eapb.ExtAuthzPerRoute), nil
+	case "type.googleapis.com/envoy.config.filter.http.fault.v2.HTTPFault":
+		return new(faultpb.HTTPFault), nil
+	case "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip":
+		return new(gzippb.Gzip), nil
+	case "type.googleapis.com/envoy.config.filter.http.lua.v2.Lua":
+		return new(luapb.Lua), nil
+	case "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit":
+		return new(rlpb.RateLimit), nil
 	case "type.googleapis.com/envoy.config.filter.http.router.v2.Router":
 		return new(routerpb.Router), nil
 	case "type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext":
@@ -17,11 +17,14 @@ package util
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/ptypes"
 
 	authpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 const (
@@ -29,7 +32,76 @@ const (
 	defaultClientSslFilename = "client"
 )
 
+// TlsParams are the parameters of TLS connections besides the certificates.
+type TlsParams struct {
+	// Protocol versions such as TLSv1.2, only for Downstream.
+	MinimumProtocol string
+	MaximumProtocol string
+	// Cipher suites of TLS 1.0-1.2 in order of preference, each a name or
+	// names of equal preference such as [ECDHE-ECDSA-AES128-GCM-SHA256|ECDHE-ECDSA-CHACHA20-POLY1305].
+	CipherSuites []string
+	EcdhCurves   []string
+}
+
+// DownstreamTlsParams are the parameters of the TLS connections of the HTTPS
+// listener.
+type DownstreamTlsParams struct {
+	TlsParams
+	// Client certificates are validated against ClientRootCertsPath if it is
+	// set, and must have one of ClientSans as a subject alt name if it is not
+	// empty.
+	ClientRootCertsPath string
+	RequireClientCert   bool
+	ClientSans          []string
+	// Lifetime of the TLS sessions, 0 for the default of Envoy.
+	SessionTimeout time.Duration
+	// Disable the session resumption by session tickets, so only the
+	// sessions cached by Envoy are resumed.
+	DisableSessionTickets bool
+}
+
+// UpstreamTlsParams are the parameters of the TLS connections of a cluster.
+type UpstreamTlsParams struct {
+	TlsParams
+	// The certificate of the server must have one of ServerSans as a subject
+	// alt name if it is not empty.
+	ServerSans []string
+	// Do not resume sessions, so every connection makes a full handshake.
+	DisableSessionResumption bool
+}
+
 var (
+	// Cipher suites of TLS 1.0-1.2 supported by Envoy, whose cipher suites of
+	// TLS 1.3 cannot be configured.
+	cipherSuites = map[string]bool{
+		"ECDHE-ECDSA-AES128-GCM-SHA256": true,
+		"ECDHE-RSA-AES128-GCM-SHA256":   true,
+		"ECDHE-ECDSA-AES256-GCM-SHA384": true,
+		"ECDHE-RSA-AES256-GCM-SHA384":   true,
+		"ECDHE-ECDSA-CHACHA20-POLY1305": true,
+		"ECDHE-RSA-CHACHA20-POLY1305":   true,
+		"ECDHE-PSK-CHACHA20-POLY1305":   true,
+		"ECDHE-ECDSA-AES128-SHA":        true,
+		"ECDHE-RSA-AES128-SHA":          true,
+		"ECDHE-PSK-AES128-CBC-SHA":      true,
+		"ECDHE-ECDSA-AES256-SHA":        true,
+		"ECDHE-RSA-AES256-SHA":          true,
+		"ECDHE-PSK-AES256-CBC-SHA":      true,
+		"AES128-GCM-SHA256":             true,
+		"AES256-GCM-SHA384":             true,
+		"AES128-SHA":                    true,
+		"PSK-AES128-CBC-SHA":            true,
+		"AES256-SHA":                    true,
+		"PSK-AES256-CBC-SHA":            true,
+		"DES-CBC3-SHA":                  true,
+	}
+	ecdhCurves = map[string]bool{
+		"X25519": true,
+		"P-256":  true,
+		"P-384":  true,
+		"P-521":  true,
+	}
+
 	tlsProtocolVersionMap = map[string]authpb.TlsParameters_TlsProtocol{
 		"TLSv1.0": authpb.TlsParameters_TLSv1_0,
 		"TLSv1.1": authpb.TlsParameters_TLSv1_1,
@@ -38,8 +110,9 @@ var (
 	}
 )
 
-// CreateUpstreamTransportSocket creates a TransportSocket for Upstream
-func CreateUpstreamTransportSocket(hostname, rootCertsPath, sslClientPath string, alpnProtocols []string) (*corepb.TransportSocket, error) {
+// CreateUpstreamTransportSocket creates a TransportSocket for Upstream. params
+// can be nil for the defaults.
+func CreateUpstreamTransportSocket(hostname, rootCertsPath, sslClientPath string, alpnProtocols []string, params *UpstreamTlsParams) (*corepb.TransportSocket, error) {
 	if rootCertsPath == "" {
 		return nil, fmt.Errorf("root certs path cannot be empty.")
 	}
@@ -50,19 +123,42 @@ func CreateUpstreamTransportSocket(hostname, rootCertsPath, sslClientPath string
 		sslFileName = "backend"
 	}
 
-	common_tls, err := createCommonTlsContext(rootCertsPath, sslClientPath, sslFileName, "", "")
+	certPath, keyPath := sslFilePaths(sslClientPath, sslFileName)
+	return CreateUpstreamTransportSocketWithCert(hostname, rootCertsPath, certPath, keyPath, alpnProtocols, params)
+}
+
+// CreateUpstreamTransportSocketWithCert creates a TransportSocket for Upstream
+// with the client certificate and key in the files, instead of the ones in a
+// directory. sni is sent as the server name. params can be nil for the
+// defaults.
+func CreateUpstreamTransportSocketWithCert(sni, rootCertsPath, certPath, keyPath string, alpnProtocols []string, params *UpstreamTlsParams) (*corepb.TransportSocket, error) {
+	if rootCertsPath == "" {
+		return nil, fmt.Errorf("root certs path cannot be empty.")
+	}
+	if params == nil {
+		params = &UpstreamTlsParams{}
+	}
+	if params.MinimumProtocol != "" || params.MaximumProtocol != "" {
+		return nil, fmt.Errorf("TLS protocol versions can only be set for Downstream.")
+	}
+
+	common_tls, err := createCommonTlsContext(rootCertsPath, certPath, keyPath, &params.TlsParams)
 	if err != nil {
 		return nil, err
 	}
 	if len(alpnProtocols) > 0 {
 		common_tls.AlpnProtocols = alpnProtocols
 	}
+	addMatchSubjectAltNames(common_tls, params.ServerSans)
 
-	tlsContext, err := ptypes.MarshalAny(&authpb.UpstreamTlsContext{
-		Sni:              hostname,
+	upstreamTlsContext := &authpb.UpstreamTlsContext{
+		Sni:              sni,
 		CommonTlsContext: common_tls,
-	},
-	)
+	}
+	if params.DisableSessionResumption {
+		upstreamTlsContext.MaxSessionKeys = &wrapperspb.UInt32Value{Value: 0}
+	}
+	tlsContext, err := ptypes.MarshalAny(upstreamTlsContext)
 	if err != nil {
 		return nil, err
 	}
@@ -74,8 +170,8 @@ func CreateUpstreamTransportSocket(hostname, rootCertsPath, sslClientPath string
 	}, nil
 }
 
-// CreateDownstreamTransportSocket creates a TransportSocket for Downstream
-func CreateDownstreamTransportSocket(sslServerPath, sslMinimumProtocol, sslMaximumProtocol string) (*corepb.TransportSocket, error) {
+// CreateDownstreamTransportSocket creates a TransportSocket for Downstream.
+func CreateDownstreamTransportSocket(sslServerPath string, params *DownstreamTlsParams) (*corepb.TransportSocket, error) {
 	if sslServerPath == "" {
 		return nil, fmt.Errorf("SSL path cannot be empty.")
 	}
@@ -86,15 +182,43 @@ func CreateDownstreamTransportSocket(sslServerPath, sslMinimumProtocol, sslMaxim
 		sslFileName = "nginx"
 	}
 
-	common_tls, err := createCommonTlsContext("", sslServerPath, sslFileName, sslMinimumProtocol, sslMaximumProtocol)
+	certPath, keyPath := sslFilePaths(sslServerPath, sslFileName)
+	return CreateDownstreamTransportSocketWithCert(certPath, keyPath, params)
+}
+
+// CreateDownstreamTransportSocketWithCert creates a TransportSocket for
+// Downstream with the certificate and the key in the files, instead of the
+// ones in a directory.
+func CreateDownstreamTransportSocketWithCert(certPath, keyPath string, params *DownstreamTlsParams) (*corepb.TransportSocket, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("SSL certificate and key paths cannot be empty.")
+	}
+	if params.ClientRootCertsPath == "" && (params.RequireClientCert || len(params.ClientSans) > 0) {
+		return nil, fmt.Errorf("client certificates cannot be required or matched without the root certificates to validate them")
+	}
+
+	common_tls, err := createCommonTlsContext(params.ClientRootCertsPath, certPath, keyPath, &params.TlsParams)
 	if err != nil {
 		return nil, err
 	}
 	common_tls.AlpnProtocols = []string{"h2", "http/1.1"}
-	tlsContext, err := ptypes.MarshalAny(&authpb.DownstreamTlsContext{
+	addMatchSubjectAltNames(common_tls, params.ClientSans)
+
+	downstreamTlsContext := &authpb.DownstreamTlsContext{
 		CommonTlsContext: common_tls,
-	},
-	)
+	}
+	if params.RequireClientCert {
+		downstreamTlsContext.RequireClientCertificate = &wrapperspb.BoolValue{Value: true}
+	}
+	if params.SessionTimeout > 0 {
+		downstreamTlsContext.SessionTimeout = ptypes.DurationProto(params.SessionTimeout)
+	}
+	if params.DisableSessionTickets {
+		downstreamTlsContext.SessionTicketKeysType = &authpb.DownstreamTlsContext_DisableStatelessSessionResumption{
+			DisableStatelessSessionResumption: true,
+		}
+	}
+	tlsContext, err := ptypes.MarshalAny(downstreamTlsContext)
 	if err != nil {
 		return nil, err
 	}
@@ -106,24 +230,45 @@ func CreateDownstreamTransportSocket(sslServerPath, sslMinimumProtocol, sslMaxim
 	}, nil
 }
 
-func createCommonTlsContext(rootCertsPath, sslPath, sslFileName, sslMinimumProtocol, sslMaximumProtocol string) (*authpb.CommonTlsContext, error) {
+// sslFilePaths returns the paths of the certificate and the key named
+// sslFileName in the directory sslPath, or empty paths if sslPath is empty.
+func sslFilePaths(sslPath, sslFileName string) (string, string) {
+	if sslPath == "" || sslFileName == "" {
+		return "", ""
+	}
+	if !strings.HasSuffix(sslPath, "/") {
+		sslPath = fmt.Sprintf("%s/", sslPath)
+	}
+	return fmt.Sprintf("%s%s.crt", sslPath, sslFileName), fmt.Sprintf("%s%s.key", sslPath, sslFileName)
+}
+
+// addMatchSubjectAltNames requires the peer certificate to have one of the
+// subject alt names, matched exactly.
+func addMatchSubjectAltNames(commonTls *authpb.CommonTlsContext, sans []string) {
+	for _, san := range sans {
+		validationContext := commonTls.GetValidationContext()
+		validationContext.MatchSubjectAltNames = append(validationContext.MatchSubjectAltNames, &matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_Exact{
+				Exact: san,
+			},
+		})
+	}
+}
+
+func createCommonTlsContext(rootCertsPath, certPath, keyPath string, params *TlsParams) (*authpb.CommonTlsContext, error) {
 	common_tls := &authpb.CommonTlsContext{}
 	// Add TLS certificate
-	if sslPath != "" && sslFileName != "" {
-		if !strings.HasSuffix(sslPath, "/") {
-			sslPath = fmt.Sprintf("%s/", sslPath)
-		}
-
+	if certPath != "" && keyPath != "" {
 		common_tls.TlsCertificates = []*authpb.TlsCertificate{
 			{
 				CertificateChain: &corepb.DataSource{
 					Specifier: &corepb.DataSource_Filename{
-						Filename: fmt.Sprintf("%s%s.crt", sslPath, sslFileName),
+						Filename: certPath,
 					},
 				},
 				PrivateKey: &corepb.DataSource{
 					Specifier: &corepb.DataSource_Filename{
-						Filename: fmt.Sprintf("%s%s.key", sslPath, sslFileName),
+						Filename: keyPath,
 					},
 				},
 			},
@@ -143,14 +288,45 @@ func createCommonTlsContext(rootCertsPath, sslPath, sslFileName, sslMinimumProto
 		}
 	}
 
-	if sslMinimumProtocol != "" || sslMaximumProtocol != "" {
-		common_tls.TlsParams = &authpb.TlsParameters{}
-		if minVersion, ok := tlsProtocolVersionMap[sslMinimumProtocol]; ok {
+	if err := validateCipherSuites(params.CipherSuites); err != nil {
+		return nil, err
+	}
+	for _, curve := range params.EcdhCurves {
+		if !ecdhCurves[curve] {
+			return nil, fmt.Errorf("invalid ECDH curve %q, must be one of X25519, P-256, P-384 and P-521", curve)
+		}
+	}
+
+	if params.MinimumProtocol != "" || params.MaximumProtocol != "" || len(params.CipherSuites) > 0 || len(params.EcdhCurves) > 0 {
+		common_tls.TlsParams = &authpb.TlsParameters{
+			CipherSuites: params.CipherSuites,
+			EcdhCurves:   params.EcdhCurves,
+		}
+		if minVersion, ok := tlsProtocolVersionMap[params.MinimumProtocol]; ok {
 			common_tls.TlsParams.TlsMinimumProtocolVersion = minVersion
 		}
-		if maxVersion, ok := tlsProtocolVersionMap[sslMaximumProtocol]; ok {
+		if maxVersion, ok := tlsProtocolVersionMap[params.MaximumProtocol]; ok {
 			common_tls.TlsParams.TlsMaximumProtocolVersion = maxVersion
 		}
 	}
 	return common_tls, nil
 }
+
+func validateCipherSuites(suites []string) error {
+	for _, suite := range suites {
+		names := []string{suite}
+		if strings.HasPrefix(suite, "[") && strings.HasSuffix(suite, "]") {
+			names = strings.Split(strings.TrimSuffix(strings.TrimPrefix(suite, "["), "]"), "|")
+		}
+		for _, name := range names {
+			if cipherSuites[name] {
+				continue
+			}
+			if strings.HasPrefix(name, "TLS_") {
+				return fmt.Errorf("cipher suite %q of TLS 1.3 cannot be configured", name)
+			}
+			return fmt.Errorf("invalid cipher suite %q", name)
+		}
+	}
+	return nil
+}
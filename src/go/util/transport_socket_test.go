@@ -16,6 +16,7 @@ package util
 
 import (
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/jsonpb"
 )
@@ -27,7 +28,9 @@ func TestCreateUpstreamTransportSocket(t *testing.T) {
 		rootCertsPath       string
 		sslBackendPath      string
 		alpnProtocols       []string
+		params              *UpstreamTlsParams
 		wantTransportSocket string
+		wantErr             string
 	}{
 		{
 			desc:          "Upstream Transport Socket for TLS",
@@ -110,10 +113,69 @@ func TestCreateUpstreamTransportSocket(t *testing.T) {
 						},
 						"sni":"https://echo-http-12345-uc.a.run.app"}}`,
 		},
+		{
+			desc:          "Upstream Transport Socket for TLS, with cipher suites and curves, without session resumption",
+			hostName:      "https://echo-http-12345-uc.a.run.app",
+			rootCertsPath: "/etc/ssl/certs/ca-certificates.crt",
+			params: &UpstreamTlsParams{
+				TlsParams: TlsParams{
+					CipherSuites: []string{"[ECDHE-ECDSA-AES128-GCM-SHA256|ECDHE-ECDSA-CHACHA20-POLY1305]", "ECDHE-RSA-AES128-GCM-SHA256"},
+					EcdhCurves:   []string{"X25519", "P-384"},
+				},
+				DisableSessionResumption: true,
+			},
+			wantTransportSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext",
+					"commonTlsContext":{
+						"tlsParams":{
+							"cipherSuites":["[ECDHE-ECDSA-AES128-GCM-SHA256|ECDHE-ECDSA-CHACHA20-POLY1305]","ECDHE-RSA-AES128-GCM-SHA256"],
+							"ecdhCurves":["X25519","P-384"]
+						},
+						"validationContext":{
+							"trustedCa":{
+								"filename":"/etc/ssl/certs/ca-certificates.crt"
+							}
+						}
+					},
+					"maxSessionKeys":0,
+					"sni":"https://echo-http-12345-uc.a.run.app"
+				}
+			}`,
+		},
+		{
+			desc:          "Fail with a cipher suite of TLS 1.3",
+			hostName:      "https://echo-http-12345-uc.a.run.app",
+			rootCertsPath: "/etc/ssl/certs/ca-certificates.crt",
+			params: &UpstreamTlsParams{
+				TlsParams: TlsParams{
+					CipherSuites: []string{"TLS_AES_128_GCM_SHA256"},
+				},
+			},
+			wantErr: `cipher suite "TLS_AES_128_GCM_SHA256" of TLS 1.3 cannot be configured`,
+		},
+		{
+			desc:          "Fail with protocol versions",
+			hostName:      "https://echo-http-12345-uc.a.run.app",
+			rootCertsPath: "/etc/ssl/certs/ca-certificates.crt",
+			params: &UpstreamTlsParams{
+				TlsParams: TlsParams{
+					MinimumProtocol: "TLSv1.2",
+				},
+			},
+			wantErr: "TLS protocol versions can only be set for Downstream.",
+		},
 	}
 
 	for i, tc := range testData {
-		gotTransportSocket, err := CreateUpstreamTransportSocket(tc.hostName, tc.rootCertsPath, tc.sslBackendPath, tc.alpnProtocols)
+		gotTransportSocket, err := CreateUpstreamTransportSocket(tc.hostName, tc.rootCertsPath, tc.sslBackendPath, tc.alpnProtocols, tc.params)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -128,13 +190,69 @@ func TestCreateUpstreamTransportSocket(t *testing.T) {
 	}
 }
 
+func TestCreateUpstreamTransportSocketWithCert(t *testing.T) {
+	gotTransportSocket, err := CreateUpstreamTransportSocketWithCert("internal.svc", "/etc/ssl/internal/ca.crt",
+		"/etc/ssl/internal/client.crt", "/etc/ssl/internal/client.key", []string{"h2"}, &UpstreamTlsParams{
+			ServerSans: []string{"spiffe://example.com/internal", "internal.example.com"},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTransportSocket := `{
+		"name":"envoy.transport_sockets.tls",
+		"typedConfig":{
+			"@type":"type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext",
+			"commonTlsContext":{
+				"alpnProtocols":["h2"],
+				"tlsCertificates":[
+					{
+						"certificateChain":{
+							"filename":"/etc/ssl/internal/client.crt"
+						},
+						"privateKey":{
+							"filename":"/etc/ssl/internal/client.key"
+						}
+					}
+				],
+				"validationContext":{
+					"matchSubjectAltNames":[
+						{"exact":"spiffe://example.com/internal"},
+						{"exact":"internal.example.com"}
+					],
+					"trustedCa":{
+						"filename":"/etc/ssl/internal/ca.crt"
+					}
+				}
+			},
+			"sni":"internal.svc"
+		}
+	}`
+
+	marshaler := &jsonpb.Marshaler{}
+	gotConfig, err := marshaler.MarshalToString(gotTransportSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := JsonEqual(wantTransportSocket, gotConfig); err != nil {
+		t.Errorf("CreateUpstreamTransportSocketWithCert failed,\n %v", err)
+	}
+}
+
 func TestCreateDownstreamTransportSocket(t *testing.T) {
 	testData := []struct {
 		desc                string
 		sslPath             string
 		sslMinimumProtocol  string
 		sslMaximumProtocol  string
+		clientRootCertsPath string
+		requireClientCert   bool
+		clientSans          []string
+		cipherSuites        []string
+		ecdhCurves          []string
+		sessionTimeout      time.Duration
+		disableTickets      bool
 		wantTransportSocket string
+		wantErr             string
 	}{
 		{
 			desc:               "Downstream Transport Socket for TLS",
@@ -219,10 +337,148 @@ func TestCreateDownstreamTransportSocket(t *testing.T) {
 				}
 			}`,
 		},
+		{
+			desc:                "Downstream Transport Socket for mutual TLS, with allowed subject alt names",
+			sslPath:             "/etc/ssl/endpoints/",
+			clientRootCertsPath: "/etc/ssl/clients/ca.crt",
+			requireClientCert:   true,
+			clientSans:          []string{"spiffe://cluster.local/ns/default/sa/client", "client.example.com"},
+			wantTransportSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"tlsCertificates":[
+							{
+								"certificateChain":{
+									"filename":"/etc/ssl/endpoints/server.crt"
+								},
+								"privateKey":{
+									"filename":"/etc/ssl/endpoints/server.key"
+								}
+							}
+						],
+						"validationContext":{
+							"matchSubjectAltNames":[
+								{
+									"exact":"spiffe://cluster.local/ns/default/sa/client"
+								},
+								{
+									"exact":"client.example.com"
+								}
+							],
+							"trustedCa":{
+								"filename":"/etc/ssl/clients/ca.crt"
+							}
+						}
+					},
+					"requireClientCertificate":true
+				}
+			}`,
+		},
+		{
+			desc:                "Downstream Transport Socket for optional client certificates",
+			sslPath:             "/etc/ssl/endpoints/",
+			clientRootCertsPath: "/etc/ssl/clients/ca.crt",
+			wantTransportSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"tlsCertificates":[
+							{
+								"certificateChain":{
+									"filename":"/etc/ssl/endpoints/server.crt"
+								},
+								"privateKey":{
+									"filename":"/etc/ssl/endpoints/server.key"
+								}
+							}
+						],
+						"validationContext":{
+							"trustedCa":{
+								"filename":"/etc/ssl/clients/ca.crt"
+							}
+						}
+					}
+				}
+			}`,
+		},
+		{
+			desc:           "Downstream Transport Socket for TLS, with cipher suites, curves and session settings",
+			sslPath:        "/etc/ssl/endpoints/",
+			cipherSuites:   []string{"ECDHE-ECDSA-AES256-GCM-SHA384", "ECDHE-RSA-AES256-GCM-SHA384"},
+			ecdhCurves:     []string{"P-256"},
+			sessionTimeout: 30 * time.Minute,
+			disableTickets: true,
+			wantTransportSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.api.v2.auth.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"tlsCertificates":[
+							{
+								"certificateChain":{
+									"filename":"/etc/ssl/endpoints/server.crt"
+								},
+								"privateKey":{
+									"filename":"/etc/ssl/endpoints/server.key"
+								}
+							}
+						],
+						"tlsParams":{
+							"cipherSuites":["ECDHE-ECDSA-AES256-GCM-SHA384","ECDHE-RSA-AES256-GCM-SHA384"],
+							"ecdhCurves":["P-256"]
+						}
+					},
+					"disableStatelessSessionResumption":true,
+					"sessionTimeout":"1800s"
+				}
+			}`,
+		},
+		{
+			desc:         "Fail with an unknown cipher suite in a group",
+			sslPath:      "/etc/ssl/endpoints/",
+			cipherSuites: []string{"[ECDHE-ECDSA-AES128-GCM-SHA256|RC4-MD5]"},
+			wantErr:      `invalid cipher suite "RC4-MD5"`,
+		},
+		{
+			desc:       "Fail with an unknown curve",
+			sslPath:    "/etc/ssl/endpoints/",
+			ecdhCurves: []string{"secp256r1"},
+			wantErr:    `invalid ECDH curve "secp256r1", must be one of X25519, P-256, P-384 and P-521`,
+		},
+		{
+			desc:              "Fail to require client certificates without the root certificates",
+			sslPath:           "/etc/ssl/endpoints/",
+			requireClientCert: true,
+			wantErr:           "client certificates cannot be required or matched without the root certificates to validate them",
+		},
 	}
 
 	for i, tc := range testData {
-		gotTransportSocket, err := CreateDownstreamTransportSocket(tc.sslPath, tc.sslMinimumProtocol, tc.sslMaximumProtocol)
+		gotTransportSocket, err := CreateDownstreamTransportSocket(tc.sslPath, &DownstreamTlsParams{
+			TlsParams: TlsParams{
+				MinimumProtocol: tc.sslMinimumProtocol,
+				MaximumProtocol: tc.sslMaximumProtocol,
+				CipherSuites:    tc.cipherSuites,
+				EcdhCurves:      tc.ecdhCurves,
+			},
+			ClientRootCertsPath:   tc.clientRootCertsPath,
+			RequireClientCert:     tc.requireClientCert,
+			ClientSans:            tc.clientSans,
+			SessionTimeout:        tc.sessionTimeout,
+			DisableSessionTickets: tc.disableTickets,
+		})
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want error: %s", i, tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -23,10 +23,20 @@ const (
 	Buffer = "envoy.filters.http.buffer"
 	// CORS HTTP filter
 	CORS = "envoy.filters.http.cors"
+	// External Authorization HTTP filter
+	ExtAuthz = "envoy.filters.http.ext_authz"
+	// Fault HTTP filter
+	Fault = "envoy.filters.http.fault"
+	// Gzip HTTP filter
+	Gzip = "envoy.filters.http.gzip"
 	// GRPCJSONTranscoder HTTP filter
 	GRPCJSONTranscoder = "envoy.filters.http.grpc_json_transcoder"
 	// GRPCWeb HTTP filter
 	GRPCWeb = "envoy.filters.http.grpc_web"
+	// Lua HTTP filter
+	Lua = "envoy.filters.http.lua"
+	// RateLimit HTTP filter
+	RateLimit = "envoy.filters.http.ratelimit"
 	// Router HTTP filter
 	Router = "envoy.filters.http.router"
 	// Health checking HTTP filter
@@ -47,14 +57,41 @@ const (
 	BackendRouting = "envoy.filters.http.backend_routing"
 	// GrpcStats filter name
 	GrpcStatsFilterName = "envoy.filters.http.grpc_stats"
+	// TLSInspector is Envoy TLS Inspector listener filter name.
+	TLSInspector = "envoy.filters.listener.tls_inspector"
+	// ProxyProtocol is Envoy PROXY protocol listener filter name.
+	ProxyProtocol = "envoy.filters.listener.proxy_protocol"
 	// TLSTransportSocket is Envoy TLS Transport Socket name.
 	TLSTransportSocket = "envoy.transport_sockets.tls"
 	// DefaultRootCAPaths is the default certs path.
 	DefaultRootCAPaths = "/etc/ssl/certs/ca-certificates.crt"
 
+	// FileAccessLog is Envoy file access logger name.
+	FileAccessLog = "envoy.access_loggers.file"
+
+	// OperationFilterStateKey is the filter state key of the operation name set
+	// by Path Matcher filter.
+	OperationFilterStateKey = "envoy.filters.http.path_matcher.operation"
+
+	// OperationMetadataKey is the key of the operation name in the dynamic
+	// metadata of Path Matcher filter.
+	OperationMetadataKey = "operation"
+
 	// JwtPayloadMetadataName is the field name passed into metadata
 	JwtPayloadMetadataName = "jwt_payloads"
 
+	// JwtPayloadHeaderName is the request header the verified JWT payload is
+	// forwarded in.
+	JwtPayloadHeaderName = "X-Endpoint-API-UserInfo"
+
+	// JwtCookieHeaderPrefix is the prefix of the request headers JWTs in
+	// cookies are copied to, for JWT Authn filter to read them.
+	JwtCookieHeaderPrefix = "x-endpoint-jwt-cookie-"
+
+	// ClientCertHeaderName is the request header the verified client
+	// certificate of a downstream TLS connection is forwarded in.
+	ClientCertHeaderName = "x-forwarded-client-cert"
+
 	// Supported Http Methods.
 
 	GET     = "GET"
@@ -95,6 +132,20 @@ const (
 	// The service control server cluster name.
 	ServiceControlClusterName = "service-control-cluster"
 
+	// The external authorization server cluster name.
+	ExtAuthzClusterName = "ext-authz-cluster"
+
+	// The rate limit server cluster name.
+	RateLimitClusterName = "rate-limit-cluster"
+
+	// Rate limit domain and descriptor keys shared by the rate limit filter
+	// config and the rate limit server.
+	RateLimitDomain              = "espv2"
+	RateLimitOperationKey        = "generic_key"
+	RateLimitRemoteAddressKey    = "remote_address"
+	RateLimitPathKey             = "path"
+	RateLimitRequestHeaderPrefix = "header:"
+
 	// Platforms
 
 	GAEFlex = "GAE_FLEX(ESPv2)"
@@ -121,6 +172,7 @@ const (
 	// Default api key locations
 	DefaultApiKeyQueryParamKey    = "key"
 	DefaultApiKeyQueryParamApiKey = "api_key"
+	DefaultApiKeyHeaderName       = "x-api-key"
 
 	// Strict Transport Security header key and value
 	HSTSHeaderKey   = "Strict-Transport-Security"
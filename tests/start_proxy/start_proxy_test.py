@@ -66,6 +66,38 @@ class TestStartProxy(unittest.TestCase):
               '--logtostderr', '--admin_port', '0',
               '--tracing_sample_rate', '0',
               '/tmp/bootstrap.json']),
+            # overload manager and downstream connection limit
+            (['--max_heap_size_bytes=1073741824',
+              '--overload_shrink_heap_threshold=0.9',
+              '--overload_disable_keepalive_threshold=0.92',
+              '--overload_stop_accepting_requests_threshold=0',
+              '--max_downstream_connections=10000'],
+             ['bin/bootstrap',
+              '--logtostderr', '--admin_port', '0',
+              '--tracing_sample_rate', '0.001',
+              '--max_heap_size_bytes', '1073741824',
+              '--overload_shrink_heap_threshold', '0.9',
+              '--overload_disable_keepalive_threshold', '0.92',
+              '--overload_stop_accepting_requests_threshold', '0.0',
+              '--max_downstream_connections', '10000',
+              '/tmp/bootstrap.json']),
+            # stats sinks, stats listener and stats tags
+            (['--admin_port=8001', '--admin_address=127.0.0.1',
+              '--statsd_address=127.0.0.1:8125',
+              '--dogstatsd_address=127.0.0.1:8126',
+              '--stats_port=9901',
+              '--service=test_bookstore.gloud.run',
+              '--version=2019-12-16r0'],
+             ['bin/bootstrap',
+              '--logtostderr', '--admin_port', '8001',
+              '--tracing_sample_rate', '0.001',
+              '--admin_address', '127.0.0.1',
+              '--statsd_address', '127.0.0.1:8125',
+              '--dogstatsd_address', '127.0.0.1:8126',
+              '--stats_port', '9901',
+              '--service', 'test_bookstore.gloud.run',
+              '--service_config_id', '2019-12-16r0',
+              '/tmp/bootstrap.json']),
         ]
 
         for flags, wantedArgs in testcases:
@@ -129,7 +161,17 @@ class TestStartProxy(unittest.TestCase):
               '--backend_address', 'http://127.0.0.1:8082',
               '--rollout_strategy', 'managed', '--v', '0',
               '--ssl_server_cert_path', '/etc/nginx/ssl',
-              '--listener_port', '443',
+              '--ssl_port', '443',
+              ]),
+            # ssl_port with ssl_server_cert_path and the redirect
+            (['-R=managed','--ssl_port=443',
+              '--ssl_server_cert_path=/etc/endpoint/ssl',
+              '--http_to_https_redirect'],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'http://127.0.0.1:8082',
+              '--rollout_strategy', 'managed', '--v', '0',
+              '--ssl_server_cert_path', '/etc/endpoint/ssl',
+              '--ssl_port', '443', '--http_to_https_redirect',
               ]),
             # ssl_client_cert_path specified
             (['-R=managed','--listener_port=8080',  '--disable_tracing',
@@ -324,6 +366,318 @@ class TestStartProxy(unittest.TestCase):
               '--service', 'test_bookstore.gloud.run',
               '--suppress_envoy_headers=false'
               ]),
+            # per-operation CORS policies
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--cors_config_path=/etc/espv2/cors.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--cors_config_path', '/etc/espv2/cors.json',
+              ]),
+            # local rate limits
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--rate_limit_config_path=/etc/espv2/rate_limits.json',
+              '--rate_limit_failure_mode_deny',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--rate_limit_config_path', '/etc/espv2/rate_limits.json',
+              '--rate_limit_failure_mode_deny',
+              ]),
+            # request body limits
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--max_request_body_bytes=1024',
+              '--request_body_limits_config_path=/etc/espv2/body_limits.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--max_request_body_bytes', '1024',
+              '--request_body_limits_config_path', '/etc/espv2/body_limits.json',
+              ]),
+            # response compression
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--enable_response_compression',
+              '--response_compression_min_content_length=0',
+              '--response_compression_content_types=application/json,text/html',
+              '--response_compression_level=best',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--enable_response_compression',
+              '--response_compression_min_content_length', '0',
+              '--response_compression_content_types', 'application/json,text/html',
+              '--response_compression_level', 'best',
+              ]),
+            # header rules
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--header_rules_config_path=/etc/espv2/header_rules.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--header_rules_config_path', '/etc/espv2/header_rules.json',
+              ]),
+            # API version routing
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--api_version_routing_config_path=/etc/espv2/api_versions.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--api_version_routing_config_path', '/etc/espv2/api_versions.json',
+              ]),
+            # canary routing
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--canary_config_path=/etc/espv2/canary.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--canary_config_path', '/etc/espv2/canary.json',
+              ]),
+            # request mirroring
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--mirror_config_path=/etc/espv2/mirror.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--mirror_config_path', '/etc/espv2/mirror.json',
+              ]),
+            # fault injection
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--fault_config_path=/etc/espv2/faults.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--fault_config_path', '/etc/espv2/faults.json',
+              ]),
+            # external authorization
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--ext_authz_config_path=/etc/espv2/ext_authz.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--ext_authz_config_path', '/etc/espv2/ext_authz.json',
+              ]),
+            # JWT claim requirements
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--jwt_claims_config_path=/etc/espv2/jwt_claims.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--jwt_claims_config_path', '/etc/espv2/jwt_claims.json',
+              ]),
+            # local JWKS files
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--jwks_files=auth0=/etc/espv2/auth0_jwks.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--jwks_files', 'auth0=/etc/espv2/auth0_jwks.json',
+              ]),
+            # JWT claim and payload headers
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--jwt_headers_config_path=/etc/espv2/jwt_headers.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--jwt_headers_config_path', '/etc/espv2/jwt_headers.json',
+              ]),
+            # JWT and API key cookies
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--jwt_cookies=auth0=session',
+              '--api_key_cookies=api-key',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--jwt_cookies', 'auth0=session',
+              '--api_key_cookies', 'api-key',
+              ]),
+            # access log
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--access_log=/dev/stdout',
+              '--access_log_format=text',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--access_log', '/dev/stdout',
+              '--access_log_format', 'text',
+              ]),
+            # client certificates of the HTTPS listener
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--ssl_server_cert_path=/etc/endpoint/ssl',
+              '--ssl_server_root_certs_path=/etc/endpoint/client-ca.crt',
+              '--ssl_server_require_client_cert',
+              '--ssl_server_client_sans=client.example.com',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--ssl_server_cert_path', '/etc/endpoint/ssl',
+              '--service', 'test_bookstore.gloud.run',
+              '--ssl_server_root_certs_path', '/etc/endpoint/client-ca.crt',
+              '--ssl_server_require_client_cert',
+              '--ssl_server_client_sans', 'client.example.com',
+              ]),
+            # server certificates by SNI
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--ssl_server_cert_path=/etc/endpoint/ssl',
+              '--ssl_server_certs_config_path=/etc/espv2/server_certs.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--ssl_server_cert_path', '/etc/endpoint/ssl',
+              '--service', 'test_bookstore.gloud.run',
+              '--ssl_server_certs_config_path', '/etc/espv2/server_certs.json',
+              ]),
+            # SDS secrets
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--enable_sds',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--enable_sds',
+              ]),
+            # TLS cipher suites, curves and sessions
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--ssl_server_cipher_suites=ECDHE-RSA-AES128-GCM-SHA256',
+              '--ssl_server_ecdh_curves=X25519,P-256',
+              '--ssl_server_session_timeout=1h',
+              '--ssl_server_disable_session_tickets',
+              '--ssl_client_cipher_suites=ECDHE-RSA-AES256-GCM-SHA384',
+              '--ssl_client_ecdh_curves=P-256',
+              '--ssl_client_disable_session_resumption',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--ssl_server_cipher_suites', 'ECDHE-RSA-AES128-GCM-SHA256',
+              '--ssl_server_ecdh_curves', 'X25519,P-256',
+              '--ssl_server_session_timeout', '1h',
+              '--ssl_server_disable_session_tickets',
+              '--ssl_client_cipher_suites', 'ECDHE-RSA-AES256-GCM-SHA384',
+              '--ssl_client_ecdh_curves', 'P-256',
+              '--ssl_client_disable_session_resumption',
+              ]),
+            # per-backend TLS settings
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--backend_tls_config_path=/etc/espv2/backend_tls.json',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--backend_tls_config_path', '/etc/espv2/backend_tls.json',
+              ]),
+            # connection timeouts and HTTP/2 limits
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--http_idle_timeout=30m',
+              '--stream_idle_timeout=1m',
+              '--streaming_method_idle_timeout=1h',
+              '--request_timeout=30s',
+              '--max_connection_duration=24h',
+              '--http2_max_concurrent_streams=100',
+              '--http2_initial_stream_window_size=65536',
+              '--http2_initial_connection_window_size=1048576',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--http_idle_timeout', '30m',
+              '--stream_idle_timeout', '1m',
+              '--streaming_method_idle_timeout', '1h',
+              '--request_timeout', '30s',
+              '--max_connection_duration', '24h',
+              '--http2_max_concurrent_streams', '100',
+              '--http2_initial_stream_window_size', '65536',
+              '--http2_initial_connection_window_size', '1048576',
+              ]),
+            # PROXY protocol
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--enable_proxy_protocol',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--rollout_strategy', 'fixed',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--enable_proxy_protocol',
+              ]),
         ]
 
         for flags, wantedArgs in testcases:
@@ -345,7 +699,7 @@ class TestStartProxy(unittest.TestCase):
             ['--non_gcp'],
             ['--http_port=80', '--http2_port=80'],
             ['--http_port=80', '--listener_port=80'],
-            ['--ssl_server_cert_path=/etc/endpoint/ssl', '--ssl_port=443'],
+            ['--ssl_server_cert_path=/etc/endpoint/ssl', '--http_to_https_redirect'],
             ['--ssl_server_cert_path=/etc/endpoint/ssl', '--generate_self_signed_cert'],
             ['--ssl_client_cert_path=/etc/endpoint/ssl', '--tls_mutual_auth'],
             ['--ssl_protocols=TLSv1.3',  '--ssl_minimum_protocol=TLSv1.1'],